@@ -5,7 +5,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // An API instance hosts the Splenda HTTP API.
@@ -176,7 +178,18 @@ func (a *api) NewGameAPI(userID string, res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	id, err := a.impl.NewGame(userID, game.Players)
+	var id string
+	var err error
+	switch game.Type {
+	case "", gameSplendor:
+		id, err = a.impl.NewGame(userID, game.Players, game.Options, game.TimeControl)
+	case gameDuel:
+		id, err = a.impl.NewDuel(userID, game.Players)
+	default:
+		res.WriteHeader(400)
+		res.Write([]byte("unknown game type\n"))
+		return
+	}
 	if err != nil {
 		res.WriteHeader(500)
 		res.Write([]byte(err.Error() + "\n"))
@@ -188,7 +201,7 @@ func (a *api) NewGameAPI(userID string, res http.ResponseWriter, req *http.Reque
 	write(game, res)
 }
 
-// GameAPI dispatches GET|POST|DELETE /api/games/<id> to the right handler.
+// GameAPI dispatches GET|POST|DELETE /api/games/<id>[/<trailer>] to the right handler.
 func (a *api) GameAPI(res http.ResponseWriter, req *http.Request) {
 	userID, err := a.authorize(req)
 	if err != nil {
@@ -200,7 +213,11 @@ func (a *api) GameAPI(res http.ResponseWriter, req *http.Request) {
 
 	switch req.Method {
 	case http.MethodGet:
-		a.GetGameAPI(userID, path, res, req)
+		if strings.IndexByte(path, '/') == -1 {
+			a.GetGameAPI(userID, path, res, req)
+		} else {
+			a.QueryAPI(userID, path, res, req)
+		}
 
 	case http.MethodDelete:
 		a.DeleteGameAPI(userID, path, res, req)
@@ -214,133 +231,444 @@ func (a *api) GameAPI(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// GetGameAPI handles GET /api/games/<id>, getting the current state of a particular game.
+// The longest GetGameAPI will wait for a game to change.
+const maxWait = time.Minute
+
+// GetGameAPI handles GET /api/games/<id>[?ts=<version>[&wait=<duration>]],
+// getting the current state of a particular game. It returns 304 if the caller
+// already has the game at the given version, either from ts or If-None-Match.
+// The game's ts alone won't do for this, since it repeats after an undo. With
+// a wait, it holds on to the request until the game moves on from the given
+// version, or the wait runs out.
 func (a *api) GetGameAPI(userID string, path string, res http.ResponseWriter, req *http.Request) {
 	gameID := path
-	ts := req.URL.Query().Get("ts")
+	version := req.URL.Query().Get("ts")
+
+	if w := req.URL.Query().Get("wait"); w != "" {
+		wait, err := time.ParseDuration(w)
+		if err != nil || version == "" {
+			res.WriteHeader(400)
+			res.Write([]byte("wait needs a duration and a ts\n"))
+			return
+		}
+		if wait > maxWait {
+			wait = maxWait
+		}
+
+		if err := a.waitGame(gameID, userID, version, wait, req); err != nil {
+			res.WriteHeader(500)
+			res.Write([]byte(err.Error() + "\n"))
+			return
+		}
+	}
+
+	// Everyone sees their own view of the game, so no cache should ever
+	// hand one player's copy to another.
+	res.Header().Set("Cache-Control", "private")
+	res.Header().Set("Vary", "Cookie, Authorization")
 
-	game, err := a.impl.GetGame(gameID, userID, ts)
+	game, err := a.impl.GetGame(gameID, userID, version)
+	if err == ErrNotModified {
+		res.WriteHeader(304)
+		return
+	}
 	if err != nil {
 		res.WriteHeader(500)
 		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
 
+	etag := `"` + game.Version + `"`
+	res.Header().Set("ETag", etag)
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		res.WriteHeader(304)
+		return
+	}
+
 	write(game, res)
 }
 
-// DeleteGameAPI handles DELETE /api/games/<id>, deleting a game.
-func (a *api) DeleteGameAPI(userID string, path string, res http.ResponseWriter, req *http.Request) {
-	gameID := path
+// WaitGame waits for a game to move on from the given version, or for the
+// wait to run out or the caller to go away, whichever comes first.
+func (a *api) waitGame(gameID string, userID string, version string, wait time.Duration, req *http.Request) error {
+	cur, updates, stop, err := a.impl.Watch(gameID, userID)
+	if err != nil {
+		return err
+	}
+	defer stop()
 
-	if err := a.impl.DeleteGame(gameID, userID); err != nil {
-		res.WriteHeader(500)
-		res.Write([]byte(err.Error() + "\n"))
-		return
+	if cur.Version != version {
+		return nil
 	}
 
-	res.WriteHeader(204)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-updates:
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+	return nil
 }
 
-// MoveAPI handles POST /api/games/<id>/<move>, performing a move.
-func (a *api) MoveAPI(userID string, path string, res http.ResponseWriter, req *http.Request) {
-	idx := strings.IndexByte(path, '/')
-	if idx == -1 {
-		res.WriteHeader(405)
-		return
+// EtagMatches checks an If-None-Match header against the given ETag.
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
 	}
+	return false
+}
 
+// QueryAPI handles GET /api/games/<id>/<query>, getting extra information about a game.
+func (a *api) QueryAPI(userID string, path string, res http.ResponseWriter, req *http.Request) {
+	idx := strings.IndexByte(path, '/')
 	gameID := path[:idx]
 	trailer := path[idx+1:]
 
 	switch trailer {
-	case "take3":
-		a.Take3API(gameID, userID, res, req)
+	case "moves":
+		a.LegalMovesAPI(gameID, userID, res, req)
+
+	case "duel/moves":
+		a.LegalDuelMovesAPI(gameID, userID, res, req)
 
-	case "take2":
-		a.Take2API(gameID, userID, res, req)
+	case "history":
+		a.HistoryAPI(gameID, userID, res, req)
 
-	case "reserve":
-		a.ReserveAPI(gameID, userID, res, req)
+	case "replay":
+		a.ReplayAPI(gameID, userID, res, req)
 
-	case "buy":
-		a.BuyAPI(gameID, userID, res, req)
+	case "events":
+		a.EventsAPI(gameID, userID, res, req)
+
+	case "socket":
+		a.SocketAPI(gameID, userID, res, req)
 
 	default:
 		res.WriteHeader(404)
 	}
 }
 
-// Take3API handles POST /api/games/<id>/take3, taking three coins from the table.
-func (a *api) Take3API(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
-	move := Take3{}
-	if err := unmarshal(req.Body, &move); err != nil {
-		res.WriteHeader(400)
+// LegalMovesAPI handles GET /api/games/<id>/moves, listing the moves the user could make.
+func (a *api) LegalMovesAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
+	moves, err := a.impl.LegalMoves(gameID, userID)
+	if err != nil {
+		res.WriteHeader(500)
+		res.Write([]byte(err.Error() + "\n"))
+		return
+	}
+
+	write(MoveList{moves}, res)
+}
+
+// LegalDuelMovesAPI handles GET /api/games/<id>/duel/moves, listing the moves
+// the user could make in a Splendor Duel game.
+func (a *api) LegalDuelMovesAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
+	moves, err := a.impl.LegalDuelMoves(gameID, userID)
+	if err != nil {
+		res.WriteHeader(500)
+		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
 
-	ts, err := a.impl.Take3(gameID, userID, move.Colors)
+	write(DuelMoveList{moves}, res)
+}
+
+// HistoryAPI handles GET /api/games/<id>/history, listing the moves made so far.
+func (a *api) HistoryAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
+	history, err := a.impl.History(gameID, userID)
 	if err != nil {
 		res.WriteHeader(500)
 		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
 
-	write(TS{ts}, res)
+	write(History{history}, res)
 }
 
-// Take2API handles POST /games/<id>/take2, taking two coins from the table.
-func (a *api) Take2API(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
-	move := Take2{}
-	if err := unmarshal(req.Body, &move); err != nil {
+// ReplayAPI handles GET /api/games/<id>/replay?ts=<ts>, getting the state of a
+// finished game as it was at an earlier timestamp.
+func (a *api) ReplayAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
+	ts, err := strconv.Atoi(req.URL.Query().Get("ts"))
+	if err != nil {
 		res.WriteHeader(400)
+		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
 
-	ts, err := a.impl.Take2(gameID, userID, move.Color)
+	game, err := a.impl.Replay(gameID, userID, ts)
 	if err != nil {
 		res.WriteHeader(500)
 		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
 
-	write(TS{ts}, res)
+	write(game, res)
 }
 
-// ReserveAPI handles POST /games/<id>/reserve, reserving a card.
-func (a *api) ReserveAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
-	move := Buy{}
-	if err := unmarshal(req.Body, &move); err != nil {
-		res.WriteHeader(400)
+// How often EventsAPI pings an idle stream, so proxies don't give up on it.
+const eventsPing = 30 * time.Second
+
+// EventsAPI handles GET /api/games/<id>/events, a stream of server-sent events
+// with the game's timestamp and version: once when it starts, and again every
+// time it changes. Clients can fetch the game when they see a new one instead
+// of polling for it.
+func (a *api) EventsAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		res.WriteHeader(500)
+		res.Write([]byte("streaming not supported\n"))
 		return
 	}
 
-	ts, err := a.impl.Reserve(gameID, userID, move.Tier, move.Index)
+	cur, updates, stop, err := a.impl.Watch(gameID, userID)
 	if err != nil {
 		res.WriteHeader(500)
 		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
+	defer stop()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(200)
+
+	send := func(msg []byte) {
+		res.Write(msg)
+		flusher.Flush()
+	}
+	event := func(change Change) []byte {
+		bs, err := json.Marshal(change)
+		if err != nil {
+			panic(err)
+		}
+		return []byte("data: " + string(bs) + "\n\n")
+	}
 
-	write(TS{ts}, res)
+	ping := time.NewTicker(eventsPing)
+	defer ping.Stop()
+
+	send(event(*cur))
+	for {
+		select {
+		case change := <-updates:
+			send(event(change))
+		case <-ping.C:
+			send([]byte(": ping\n\n"))
+		case <-req.Context().Done():
+			return
+		}
+	}
 }
 
-// BuyAPI handles POST /games/<id>/buy, buying a card.
-func (a *api) BuyAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
-	move := Buy{}
-	if err := unmarshal(req.Body, &move); err != nil {
-		res.WriteHeader(400)
+// DeleteGameAPI handles DELETE /api/games/<id>, deleting a game. If the game
+// is still going this only counts as a vote to delete it, and it returns 202.
+func (a *api) DeleteGameAPI(userID string, path string, res http.ResponseWriter, req *http.Request) {
+	gameID := path
+
+	deleted, err := a.impl.DeleteGame(gameID, userID)
+	if err != nil {
+		res.WriteHeader(500)
+		res.Write([]byte(err.Error() + "\n"))
+		return
+	}
+
+	if !deleted {
+		res.WriteHeader(202)
 		return
 	}
+	res.WriteHeader(204)
+}
 
-	ts, err := a.impl.Buy(gameID, userID, move.Tier, move.Index)
+// MoveAPI handles POST /api/games/<id>/<move>, performing one of the moves
+// listed in gameMoves.
+func (a *api) MoveAPI(userID string, path string, res http.ResponseWriter, req *http.Request) {
+	idx := strings.IndexByte(path, '/')
+	if idx == -1 {
+		res.WriteHeader(405)
+		return
+	}
+
+	gameID := path[:idx]
+	trailer := path[idx+1:]
+
+	move, ok := gameMoves[trailer]
+	if !ok {
+		res.WriteHeader(404)
+		return
+	}
+
+	result, err := move(a.impl, gameID, userID, func(dst interface{}) error {
+		if err := unmarshal(req.Body, dst); err != nil {
+			return badRequest{err}
+		}
+		return nil
+	})
 	if err != nil {
-		res.WriteHeader(500)
+		res.WriteHeader(errorStatus(err))
 		res.Write([]byte(err.Error() + "\n"))
 		return
 	}
 
-	write(TS{ts}, res)
+	write(result, res)
+}
+
+// ErrorStatus picks the HTTP status for an error making a move: 400 for a
+// body that didn't decode, whatever a structured Error says, and 500 for
+// anything else.
+func errorStatus(err error) int {
+	switch e := err.(type) {
+	case badRequest:
+		return 400
+	case *Error:
+		return e.HTTP
+	}
+	return 500
+}
+
+// A badRequest is an error decoding the body of a move, as opposed to an
+// error making it.
+type badRequest struct {
+	error
+}
+
+// A gameMove decodes the body of a move and makes it, returning what to send
+// back. It's shared by MoveAPI and the WebSocket, so both take the same moves.
+type gameMove func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error)
+
+// GameMoves lists the moves that can be made in a game, by the end of their
+// POST path.
+var gameMoves = map[string]gameMove{
+	// Takes three coins from the table.
+	"take3": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		move := Take3{}
+		if err := decode(&move); err != nil {
+			return nil, err
+		}
+		return newTS(impl.Take3(gameID, userID, move.Colors))
+	},
+
+	// Takes two coins from the table.
+	"take2": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		move := Take2{}
+		if err := decode(&move); err != nil {
+			return nil, err
+		}
+		return newTS(impl.Take2(gameID, userID, move.Color, move.Extra))
+	},
+
+	// Reserves a card, from the table or the top of a deck.
+	"reserve": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		move := Buy{}
+		if err := decode(&move); err != nil {
+			return nil, err
+		}
+		if move.Deck {
+			return newTS(impl.ReserveTop(gameID, userID, move.Tier, move.Orient))
+		}
+		return newTS(impl.Reserve(gameID, userID, move.Tier, move.Index, move.Orient))
+	},
+
+	// Buys a card.
+	"buy": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		move := Buy{}
+		if err := decode(&move); err != nil {
+			return nil, err
+		}
+		return newTS(impl.Buy(gameID, userID, move.Tier, move.Index, move.Orient, move.Payment, move.Color))
+	},
+
+	// Picks a noble.
+	"picknoble": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		move := PickNoble{}
+		if err := decode(&move); err != nil {
+			return nil, err
+		}
+		return newTS(impl.PickNoble(gameID, userID, move.Noble))
+	},
+
+	// Returns excess coins.
+	"returncoins": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		move := ReturnCoins{}
+		if err := decode(&move); err != nil {
+			return nil, err
+		}
+		return newTS(impl.ReturnCoins(gameID, userID, move.Coins))
+	},
+
+	// Passes when there's nothing else to do.
+	"pass": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		return newTS(impl.Pass(gameID, userID))
+	},
+
+	// Drops out of the game.
+	"resign": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		return newTS(impl.Resign(gameID, userID))
+	},
+
+	// Asks to take back the last move, or responds to such a request.
+	"undo": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		return newTS(impl.RequestUndo(gameID, userID))
+	},
+	"undo/accept": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		return newTS(impl.AcceptUndo(gameID, userID))
+	},
+	"undo/decline": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		return newTS(impl.DeclineUndo(gameID, userID))
+	},
+
+	// Copies the game into a new sandbox as it was at the given timestamp,
+	// or as it is now, returning its summary.
+	"fork": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		body := TS{}
+		if err := decode(&body); err != nil {
+			return nil, err
+		}
+		return impl.Fork(gameID, userID, body.TS)
+	},
+
+	// Puts a sandbox back the way it was at an earlier timestamp.
+	"rewind": func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+		body := TS{}
+		if err := decode(&body); err != nil {
+			return nil, err
+		}
+		ts, err := strconv.Atoi(body.TS)
+		if err != nil {
+			return nil, badRequest{err}
+		}
+		return newTS(impl.Rewind(gameID, userID, ts))
+	},
+}
+
+// Moves in a Splendor Duel game are all made the same way, under duel/.
+func init() {
+	types := []string{"take", "privilege", "refill", "reserve", "buy",
+		"taketoken", "steal", "pickroyal", "returncoins", "resign"}
+
+	for _, t := range types {
+		moveType := t
+		gameMoves["duel/"+moveType] = func(impl *Impl, gameID string, userID string, decode func(interface{}) error) (interface{}, error) {
+			move := DuelMove{}
+			if err := decode(&move); err != nil {
+				return nil, err
+			}
+			move.Type = moveType
+			return newTS(impl.DuelMove(gameID, userID, move))
+		}
+	}
+}
+
+// NewTS wraps the timestamp returned by a move to send it back.
+func newTS(ts string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return TS{ts}, nil
 }
 
 func write(d interface{}, w http.ResponseWriter) {
@@ -0,0 +1,63 @@
+package splenda
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		match  bool
+	}{
+		{"", false},
+		{`"5.3.0"`, true},
+		{`W/"5.3.0"`, true},
+		{`"4.2.0", "5.3.0"`, true},
+		{"*", true},
+		{`"5.4.0"`, false},
+		{`5.3.0`, false},
+	}
+
+	for _, test := range tests {
+		if match := etagMatches(test.header, `"5.3.0"`); match != test.match {
+			t.Errorf("%q: expected %v, got %v", test.header, test.match, match)
+		}
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{badRequest{errors.New("bad json")}, 400},
+		{ErrOverpayment, 400},
+		{ErrUnderpayment, 400},
+		{errors.New("database on fire"), 500},
+	}
+
+	for _, test := range tests {
+		if status := errorStatus(test.err); status != test.status {
+			t.Errorf("%v: expected %v, got %v", test.err, test.status, status)
+		}
+	}
+}
+
+func TestGameMoves(t *testing.T) {
+	for _, name := range []string{"take3", "undo/accept", "fork", "rewind", "duel/take", "duel/resign"} {
+		if _, ok := gameMoves[name]; !ok {
+			t.Errorf("expected a move called %v", name)
+		}
+	}
+
+	// Bad input is told apart from a move that fails.
+	decode := func(dst interface{}) error {
+		dst.(*TS).TS = "yesterday"
+		return nil
+	}
+	_, err := gameMoves["rewind"](nil, "game", "user1", decode)
+	if _, ok := err.(badRequest); !ok {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+}
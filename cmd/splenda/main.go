@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/fernomac/splenda"
 )
@@ -31,7 +33,22 @@ func main() {
 		panic(err)
 	}
 
+	sets := os.Getenv("CARD_SETS")
+	if sets == "" {
+		sets = "sets"
+	}
+	if err := splenda.LoadCardSets(sets); err != nil {
+		panic(err)
+	}
+	if err := splenda.LoadDuelSets(filepath.Join(sets, "duel")); err != nil {
+		panic(err)
+	}
+
 	impl := splenda.NewImpl(db)
+	if err := impl.CheckCardSets(); err != nil {
+		panic(err)
+	}
+	go impl.RunSweeper(time.Minute)
 	api := splenda.NewAPI(auth, impl)
 
 	port := os.Getenv("PORT")
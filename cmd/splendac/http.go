@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 func get(url string, sid string, result interface{}) error {
@@ -41,6 +43,46 @@ func get(url string, sid string, result interface{}) error {
 	return nil
 }
 
+// Stream reads a stream of server-sent events, unmarshaling the data of each
+// one and passing it to the given callback until the server hangs up.
+func stream(url string, sid string, result interface{}, callback func()) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if sid != "" {
+		req.AddCookie(&http.Cookie{
+			Name:  "sid",
+			Value: sid,
+		})
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		bs, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("http request failed: %v: %v", res.Status, string(bs))
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if err := json.Unmarshal([]byte(data), result); err != nil {
+			return err
+		}
+		callback()
+	}
+	return scanner.Err()
+}
+
 func post(url string, sid string, body interface{}, result interface{}) error {
 	bs, err := json.Marshal(body)
 	if err != nil {
@@ -81,10 +123,10 @@ func post(url string, sid string, body interface{}, result interface{}) error {
 	return nil
 }
 
-func delete(url string, sid string) error {
+func delete(url string, sid string) (int, error) {
 	req, err := http.NewRequest(http.MethodDelete, url, http.NoBody)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if sid != "" {
 		req.AddCookie(&http.Cookie{
@@ -95,17 +137,17 @@ func delete(url string, sid string) error {
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	bs, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if res.StatusCode >= 300 {
-		return fmt.Errorf("http request failed: %v: %v", res.Status, string(bs))
+		return 0, fmt.Errorf("http request failed: %v: %v", res.Status, string(bs))
 	}
 
-	return nil
+	return res.StatusCode, nil
 }
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fernomac/splenda"
 )
@@ -69,7 +73,14 @@ var cmds = map[string]func(*args){
 		}
 
 		for _, game := range games.Games {
-			fmt.Println(game.ID)
+			switch {
+			case game.Sandbox:
+				fmt.Println(game.ID, "(sandbox)")
+			case game.Type == "duel":
+				fmt.Println(game.ID, "(duel)")
+			default:
+				fmt.Println(game.ID)
+			}
 			for _, player := range game.Players {
 				fmt.Println("\t", player)
 			}
@@ -77,10 +88,88 @@ var cmds = map[string]func(*args){
 	},
 
 	"newgame": func(a *args) {
+		usage := "usage: splendac newgame [--time=<move|total>:<seconds>[:<pass|resign|bot>]]\n" +
+			"                         [--points=N] [--coins=N] [--gold=N] [--nobles=N]\n" +
+			"                         [--cards=N] [--reserve=N] [--fixed] [--set=<card set>]\n" +
+			"                         [--mode=<cities|posts|orient>] <player>...\n" +
+			"       splendac newgame --duel <player> <player>"
+
+		game := splenda.GameSummary{Options: &splenda.Options{}}
+		opts := map[string]*int{
+			"--points":  &game.Options.Points,
+			"--coins":   &game.Options.Coins,
+			"--gold":    &game.Options.Gold,
+			"--nobles":  &game.Options.Nobles,
+			"--cards":   &game.Options.CardsPerTier,
+			"--reserve": &game.Options.ReserveSlots,
+		}
+
+		for _, arg := range a.args {
+			if !strings.HasPrefix(arg, "--") {
+				game.Players = append(game.Players, arg)
+				continue
+			}
+			if arg == "--fixed" {
+				game.Options.FixedSeats = true
+				continue
+			}
+			if arg == "--duel" {
+				game.Type = "duel"
+				continue
+			}
+
+			kv := strings.SplitN(arg, "=", 2)
+			if len(kv) < 2 {
+				fmt.Println(usage)
+				return
+			}
+
+			if kv[0] == "--set" {
+				game.Options.CardSet = kv[1]
+				continue
+			}
+			if kv[0] == "--mode" {
+				game.Options.Mode = kv[1]
+				continue
+			}
+
+			// Time controls look like --time=<move|total>:<seconds>[:<timeout>].
+			if kv[0] == "--time" {
+				parts := strings.Split(kv[1], ":")
+				if len(parts) < 2 {
+					fmt.Println(usage)
+					return
+				}
+				secs, err := strconv.Atoi(parts[1])
+				if err != nil {
+					panic(err)
+				}
+
+				game.TimeControl = &splenda.TimeControl{Mode: parts[0], Seconds: secs}
+				if len(parts) > 2 {
+					game.TimeControl.Timeout = parts[2]
+				}
+				continue
+			}
+
+			opt, ok := opts[kv[0]]
+			if !ok {
+				fmt.Println(usage)
+				return
+			}
+			n, err := strconv.Atoi(kv[1])
+			if err != nil {
+				panic(err)
+			}
+			*opt = n
+		}
+
+		if game.Type == "duel" {
+			game.Options = nil
+		}
+
 		result := splenda.GameSummary{}
-		err := post(a.url+"/api/games", a.sid, splenda.GameSummary{
-			Players: a.args,
-		}, &result)
+		err := post(a.url+"/api/games", a.sid, game, &result)
 		if err != nil {
 			panic(err)
 		}
@@ -100,67 +189,191 @@ var cmds = map[string]func(*args){
 			panic(err)
 		}
 
-		fmt.Printf("id: %v\tts: %v\tstate: %v\tcurrent: %v\n",
-			result.ID, result.TS, result.State, result.Current)
+		printGame(&result)
+	},
 
-		fmt.Println()
-		fmt.Printf("coins: %v\n", result.Table.Coins)
+	"watch": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac watch <id>")
+			return
+		}
+		event := splenda.Change{}
 
-		fmt.Println("nobles:")
-		for _, n := range result.Table.Nobles {
-			fmt.Printf("  %v\t%v\n", n.Points, n.Cost)
+		err := stream(a.url+"/api/games/"+a.args[0]+"/events", a.sid, &event, func() {
+			result := splenda.Game{}
+			if err := get(a.url+"/api/games/"+a.args[0], a.sid, &result); err != nil {
+				panic(err)
+			}
+			printGame(&result)
+			fmt.Println()
+		})
+		if err != nil {
+			panic(err)
 		}
+	},
 
-		fmt.Println("tier 3:")
-		for _, c := range result.Table.Cards[2] {
-			fmt.Printf("  %v\t%v\t%v\n", c.Color, c.Points, c.Cost)
+	"moves": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac moves <id>")
+			return
 		}
+		result := splenda.MoveList{}
 
-		fmt.Println("tier 2:")
-		for _, c := range result.Table.Cards[1] {
-			fmt.Printf("  %v\t%v\t%v\n", c.Color, c.Points, c.Cost)
+		err := get(a.url+"/api/games/"+a.args[0]+"/moves", a.sid, &result)
+		if err != nil {
+			panic(err)
 		}
 
-		fmt.Println("tier 1:")
-		for _, c := range result.Table.Cards[0] {
-			fmt.Printf("  %v\t%v\t%v\n", c.Color, c.Points, c.Cost)
+		for _, m := range result.Moves {
+			switch m.Type {
+			case "take3", "take2":
+				fmt.Println(m.Type, m.Colors)
+			case "reserve", "buy":
+				tier := strconv.Itoa(m.Tier)
+				if m.Orient {
+					tier = "o" + tier
+				}
+				if m.Deck {
+					fmt.Println(m.Type, tier, "deck")
+				} else {
+					fmt.Println(m.Type, tier, m.Index, strings.Join(m.Colors, " "))
+				}
+			case "picknoble":
+				fmt.Println(m.Type, m.Noble)
+			default:
+				fmt.Println(m.Type, m.Coins)
+			}
 		}
+	},
 
-		fmt.Println()
-		fmt.Println("players:")
+	"history": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac history <id>")
+			return
+		}
+		result := splenda.History{}
 
-		for _, p := range result.Players {
-			fmt.Println(" ", p.ID, ":", p.Points)
-			fmt.Printf("    coins: %v\n", p.Coins)
+		err := get(a.url+"/api/games/"+a.args[0]+"/history", a.sid, &result)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, e := range result.Moves {
+			fmt.Printf("%v\t%v\t%v\t%v", e.TS, e.Time.Local().Format("2006-01-02 15:04:05"), e.Player, e.Type)
+			if len(e.Params) > 0 {
+				fmt.Printf("\t%s", e.Params)
+			}
+			if len(e.Coins) > 0 {
+				fmt.Printf("\tcoins: %v", e.Coins)
+			}
+			if e.Card != "" {
+				fmt.Printf("\tdealt: %v", e.Card)
+			}
+			if e.Noble != "" {
+				fmt.Printf("\tclaimed: %v", e.Noble)
+			}
+			fmt.Println()
+		}
+	},
+
+	"replay": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac replay <id> [ts]")
+			return
+		}
+		show := func(ts int) {
+			result := splenda.Game{}
+			err := get(a.url+"/api/games/"+a.args[0]+"/replay?ts="+strconv.Itoa(ts), a.sid, &result)
+			if err != nil {
+				panic(err)
+			}
+			printGame(&result)
+		}
 
-			fmt.Println("    nobles:")
-			for _, n := range p.Nobles {
-				fmt.Printf("      %v\t%v\n", n.Points, n.Cost)
+		if len(a.args) > 1 {
+			ts, err := strconv.Atoi(a.args[1])
+			if err != nil {
+				panic(err)
 			}
+			show(ts)
+			return
+		}
 
-			m := map[string]int{}
-			for color, cards := range p.Cards {
-				m[color] = len(cards)
+		history := splenda.History{}
+		if err := get(a.url+"/api/games/"+a.args[0]+"/history", a.sid, &history); err != nil {
+			panic(err)
+		}
+
+		// Skip over moves that were taken back.
+		moves := []*splenda.HistoryEntry{}
+		for _, e := range history.Moves {
+			if e.Type != "undo" {
+				moves = append(moves, e)
+				continue
+			}
+			for len(moves) > 0 && moves[len(moves)-1].TS > e.TS {
+				moves = moves[:len(moves)-1]
 			}
-			fmt.Println("    cards:", m)
+		}
 
-			fmt.Println("    reserved:")
-			for _, r := range p.Reserved {
-				fmt.Printf("      %v\t%v\t%v\n", r.Color, r.Points, r.Cost)
+		in := bufio.NewReader(os.Stdin)
+		show(0)
+		for _, e := range moves {
+			fmt.Printf("\nnext: %v %v %s [enter]", e.Player, e.Type, e.Params)
+			if _, err := in.ReadString('\n'); err != nil {
+				return
 			}
+			fmt.Println()
+			show(e.TS)
 		}
 	},
 
+	"fork": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac fork <id> [ts]")
+			return
+		}
+		body := splenda.TS{}
+		if len(a.args) > 1 {
+			body.TS = a.args[1]
+		}
+
+		result := splenda.GameSummary{}
+		if err := post(a.url+"/api/games/"+a.args[0]+"/fork", a.sid, body, &result); err != nil {
+			panic(err)
+		}
+
+		fmt.Println(result.ID)
+	},
+
+	"rewind": func(a *args) {
+		if len(a.args) < 2 {
+			fmt.Println("usage: splendac rewind <id> <ts>")
+			return
+		}
+
+		ts := splenda.TS{}
+		if err := post(a.url+"/api/games/"+a.args[0]+"/rewind", a.sid, splenda.TS{TS: a.args[1]}, &ts); err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	},
+
 	"rmgame": func(a *args) {
 		if len(a.args) < 1 {
-			fmt.Println("usage: splendac take3 <id>")
+			fmt.Println("usage: splendac rmgame <id>")
 			return
 		}
 
-		err := delete(a.url+"/api/games/"+a.args[0], a.sid)
+		status, err := delete(a.url+"/api/games/"+a.args[0], a.sid)
 		if err != nil {
 			panic(err)
 		}
+
+		if status == http.StatusAccepted {
+			fmt.Println("voted to delete; waiting on the other players")
+		}
 	},
 
 	"take3": func(a *args) {
@@ -182,14 +395,17 @@ var cmds = map[string]func(*args){
 
 	"take2": func(a *args) {
 		if len(a.args) < 2 {
-			fmt.Println("usage: splendac take2 <id> <color>")
+			fmt.Println("usage: splendac take2 <id> <color> [extra color]")
 			return
 		}
 
+		move := splenda.Take2{Color: a.args[1]}
+		if len(a.args) > 2 {
+			move.Extra = a.args[2]
+		}
+
 		ts := splenda.TS{}
-		err := post(a.url+"/api/games/"+a.args[0]+"/take2", a.sid, splenda.Take2{
-			Color: a.args[1],
-		}, &ts)
+		err := post(a.url+"/api/games/"+a.args[0]+"/take2", a.sid, move, &ts)
 		if err != nil {
 			panic(err)
 		}
@@ -199,23 +415,28 @@ var cmds = map[string]func(*args){
 
 	"reserve": func(a *args) {
 		if len(a.args) < 3 {
-			fmt.Println("usage: splendac reserve <id> <tier> <index>")
+			fmt.Println("usage: splendac reserve <id> <tier|o<tier>> <index|deck>")
+			return
 		}
 
-		tier, err := strconv.Atoi(a.args[1])
+		tier, orient, err := parseTier(a.args[1])
 		if err != nil {
 			panic(err)
 		}
-		index, err := strconv.Atoi(a.args[2])
-		if err != nil {
-			panic(err)
+
+		move := splenda.Buy{Tier: tier, Orient: orient}
+		if a.args[2] == "deck" {
+			move.Deck = true
+		} else {
+			index, err := strconv.Atoi(a.args[2])
+			if err != nil {
+				panic(err)
+			}
+			move.Index = index
 		}
 
 		ts := splenda.TS{}
-		err = post(a.url+"/api/games/"+a.args[0]+"/reserve", a.sid, splenda.Buy{
-			Tier:  tier,
-			Index: index,
-		}, &ts)
+		err = post(a.url+"/api/games/"+a.args[0]+"/reserve", a.sid, move, &ts)
 		if err != nil {
 			panic(err)
 		}
@@ -225,10 +446,11 @@ var cmds = map[string]func(*args){
 
 	"buy": func(a *args) {
 		if len(a.args) < 3 {
-			fmt.Println("usage: splendac buy <id> <tier> <index>")
+			fmt.Println("usage: splendac buy <id> <tier|o<tier>> <index> [--joker=<color>] [<color>...]")
+			return
 		}
 
-		tier, err := strconv.Atoi(a.args[1])
+		tier, orient, err := parseTier(a.args[1])
 		if err != nil {
 			panic(err)
 		}
@@ -237,10 +459,62 @@ var cmds = map[string]func(*args){
 			panic(err)
 		}
 
+		move := splenda.Buy{
+			Tier:   tier,
+			Index:  index,
+			Orient: orient,
+		}
+		for _, arg := range a.args[3:] {
+			if strings.HasPrefix(arg, "--joker=") {
+				move.Color = strings.TrimPrefix(arg, "--joker=")
+				continue
+			}
+			if move.Payment == nil {
+				move.Payment = map[string]int{}
+			}
+			move.Payment[arg]++
+		}
+
+		ts := splenda.TS{}
+		err = post(a.url+"/api/games/"+a.args[0]+"/buy", a.sid, move, &ts)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	},
+
+	"picknoble": func(a *args) {
+		if len(a.args) < 2 {
+			fmt.Println("usage: splendac picknoble <id> <noble>")
+			return
+		}
+
+		ts := splenda.TS{}
+		err := post(a.url+"/api/games/"+a.args[0]+"/picknoble", a.sid, splenda.PickNoble{
+			Noble: a.args[1],
+		}, &ts)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	},
+
+	"returncoins": func(a *args) {
+		if len(a.args) < 2 {
+			fmt.Println("usage: splendac returncoins <id> <color> [<color>...]")
+			return
+		}
+
+		coins := map[string]int{}
+		for _, color := range a.args[1:] {
+			coins[color]++
+		}
+
 		ts := splenda.TS{}
-		err = post(a.url+"/api/games/"+a.args[0]+"/buy", a.sid, splenda.Buy{
-			Tier:  tier,
-			Index: index,
+		err := post(a.url+"/api/games/"+a.args[0]+"/returncoins", a.sid, splenda.ReturnCoins{
+			Coins: coins,
 		}, &ts)
 		if err != nil {
 			panic(err)
@@ -248,6 +522,388 @@ var cmds = map[string]func(*args){
 
 		fmt.Println(ts.TS)
 	},
+
+	"pass": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac pass <id>")
+			return
+		}
+
+		ts := splenda.TS{}
+		err := post(a.url+"/api/games/"+a.args[0]+"/pass", a.sid, struct{}{}, &ts)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	},
+
+	"resign": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac resign <id>")
+			return
+		}
+
+		ts := splenda.TS{}
+		err := post(a.url+"/api/games/"+a.args[0]+"/resign", a.sid, struct{}{}, &ts)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	},
+
+	"undo": func(a *args) {
+		if len(a.args) < 1 {
+			fmt.Println("usage: splendac undo <id> [accept|decline]")
+			return
+		}
+
+		url := a.url + "/api/games/" + a.args[0] + "/undo"
+		if len(a.args) > 1 {
+			url += "/" + a.args[1]
+		}
+
+		ts := splenda.TS{}
+		if err := post(url, a.sid, struct{}{}, &ts); err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	},
+}
+
+// PrintGame prints the state of a game.
+func printGame(result *splenda.Game) {
+	fmt.Printf("id: %v\tts: %v\tstate: %v\tcurrent: %v\n",
+		result.ID, result.TS, result.State, result.Current)
+	if result.Sandbox {
+		fmt.Println("sandbox: you're moving for every seat")
+	}
+	if result.Duel != nil {
+		printDuel(result)
+		return
+	}
+	if result.Options != nil {
+		set := strings.SplitN(result.Options.CardSet, "@", 2)[0]
+		fmt.Printf("playing to %v points with the %v cards\n", result.Options.Points, set)
+	}
+
+	if result.Undo != nil && result.Undo.Requested {
+		fmt.Printf("%v wants to take back their last move; waiting on %v\n",
+			result.Undo.Player, result.Undo.Responder)
+	}
+
+	if len(result.DeleteVotes) > 0 {
+		fmt.Println("voted to delete:", result.DeleteVotes)
+	}
+
+	if len(result.Standings) > 0 {
+		fmt.Println()
+		if result.Winner != "" {
+			fmt.Println("winner:", result.Winner)
+		} else {
+			fmt.Println("winner: (shared)")
+		}
+		fmt.Println("standings:")
+		for _, s := range result.Standings {
+			fmt.Printf("  %v\t%v\t%v points\t%v cards", s.Rank, s.ID, s.Points, s.Cards)
+			if s.Resigned {
+				fmt.Print("\t(resigned)")
+			}
+			fmt.Println()
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("coins: %v\n", result.Table.Coins)
+
+	if len(result.Table.Cities) > 0 {
+		fmt.Println("cities:")
+		for _, c := range result.Table.Cities {
+			fmt.Printf("  %v\t%v\t%v\n", c.ID, c.Points, c.Cost)
+		}
+	} else {
+		fmt.Println("nobles:")
+		for _, n := range result.Table.Nobles {
+			fmt.Printf("  %v\t%v\t%v\n", n.ID, n.Points, n.Cost)
+		}
+	}
+
+	for tier := 3; tier >= 1; tier-- {
+		fmt.Printf("tier %v:\n", tier)
+		for _, c := range result.Table.Cards[tier-1] {
+			printCard(c)
+		}
+		if len(result.Table.Orient) >= tier {
+			fmt.Printf("  orient (o%v):\n", tier)
+			for _, c := range result.Table.Orient[tier-1] {
+				printCard(c)
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("players:")
+
+	for _, p := range result.Players {
+		if p.Resigned {
+			fmt.Println(" ", p.ID, ":", p.Points, "(resigned)")
+		} else {
+			fmt.Println(" ", p.ID, ":", p.Points)
+		}
+		if p.City != nil {
+			fmt.Printf("    city: %v\n", p.City.ID)
+		}
+		for _, post := range p.Posts {
+			fmt.Printf("    post: %v (%v)\n", post.ID, post.Description)
+		}
+		if left, ok := result.TimeLeft[p.ID]; ok {
+			fmt.Printf("    time left: %v\n", time.Duration(left)*time.Second)
+		}
+		fmt.Printf("    coins: %v\n", p.Coins)
+
+		fmt.Println("    nobles:")
+		for _, n := range p.Nobles {
+			fmt.Printf("      %v\t%v\n", n.Points, n.Cost)
+		}
+
+		m := map[string]int{}
+		for color, cards := range p.Cards {
+			m[color] = len(cards)
+		}
+		fmt.Println("    cards:", m)
+
+		fmt.Println("    reserved:")
+		for _, r := range p.Reserved {
+			fmt.Print("    ")
+			printCard(r)
+		}
+	}
+}
+
+// Usage for the duel command.
+const duelUsage = `usage: splendac duel <id> moves
+       splendac duel <id> take <cell>...
+       splendac duel <id> privilege <cell>...
+       splendac duel <id> refill
+       splendac duel <id> reserve <gold cell> <tier> <index|deck>
+       splendac duel <id> buy <tier> <index> [joker color]
+       splendac duel <id> taketoken <cell>
+       splendac duel <id> steal <color>
+       splendac duel <id> pickroyal <royal>
+       splendac duel <id> returncoins <color>...
+       splendac duel <id> resign`
+
+func init() {
+	// Splendor Duel moves all go through the one command.
+	cmds["duel"] = func(a *args) {
+		if len(a.args) < 2 {
+			fmt.Println(duelUsage)
+			return
+		}
+		id, verb, rest := a.args[0], a.args[1], a.args[2:]
+
+		if verb == "moves" {
+			result := splenda.DuelMoveList{}
+			if err := get(a.url+"/api/games/"+id+"/duel/moves", a.sid, &result); err != nil {
+				panic(err)
+			}
+			for _, m := range result.Moves {
+				fmt.Println(m.Type, m.Cells, m.Tier, m.Index, m.Deck, m.Color, m.Royal, m.Coins)
+			}
+			return
+		}
+
+		move, err := parseDuelMove(verb, rest)
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println(duelUsage)
+			return
+		}
+
+		ts := splenda.TS{}
+		if err := post(a.url+"/api/games/"+id+"/duel/"+verb, a.sid, move, &ts); err != nil {
+			panic(err)
+		}
+
+		fmt.Println(ts.TS)
+	}
+}
+
+// ParseDuelMove parses the arguments to a Splendor Duel move.
+func parseDuelMove(verb string, args []string) (splenda.DuelMove, error) {
+	move := splenda.DuelMove{}
+	ints := func(strs []string) ([]int, error) {
+		ret := []int{}
+		for _, str := range strs {
+			n, err := strconv.Atoi(str)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, n)
+		}
+		return ret, nil
+	}
+
+	var err error
+	switch verb {
+	case "take", "privilege", "taketoken":
+		move.Cells, err = ints(args)
+	case "reserve":
+		if len(args) < 3 {
+			return move, fmt.Errorf("not enough arguments")
+		}
+		if move.Cells, err = ints(args[:1]); err != nil {
+			return move, err
+		}
+		if move.Tier, err = strconv.Atoi(args[1]); err != nil {
+			return move, err
+		}
+		if args[2] == "deck" {
+			move.Deck = true
+		} else {
+			move.Index, err = strconv.Atoi(args[2])
+		}
+	case "buy":
+		if len(args) < 2 {
+			return move, fmt.Errorf("not enough arguments")
+		}
+		if move.Tier, err = strconv.Atoi(args[0]); err != nil {
+			return move, err
+		}
+		if move.Index, err = strconv.Atoi(args[1]); err != nil {
+			return move, err
+		}
+		if len(args) > 2 {
+			move.Color = args[2]
+		}
+	case "steal":
+		if len(args) < 1 {
+			return move, fmt.Errorf("not enough arguments")
+		}
+		move.Color = args[0]
+	case "pickroyal":
+		if len(args) < 1 {
+			return move, fmt.Errorf("not enough arguments")
+		}
+		move.Royal = args[0]
+	case "returncoins":
+		move.Coins = map[string]int{}
+		for _, color := range args {
+			move.Coins[color]++
+		}
+	case "refill", "resign":
+	default:
+		return move, fmt.Errorf("bad move: %v", verb)
+	}
+	return move, err
+}
+
+// PrintDuel prints the table and players of a Splendor Duel game.
+func printDuel(game *splenda.Game) {
+	d := game.Duel
+
+	if len(game.DeleteVotes) > 0 {
+		fmt.Println("voted to delete:", game.DeleteVotes)
+	}
+	if game.State == "gameover" {
+		fmt.Printf("\nwinner: %v (%v)\n", game.Winner, d.Victory)
+	}
+	if d.Again {
+		fmt.Println("another turn for", game.Current)
+	}
+
+	fmt.Println()
+	fmt.Printf("board (%v in the bag, %v privileges on the table):\n", d.Bag, d.Privileges)
+	for row := 0; row < 5; row++ {
+		fmt.Print(" ")
+		for col := 0; col < 5; col++ {
+			cell := row*5 + col
+			color := d.Board[cell]
+			if color == "" {
+				color = "-"
+			}
+			fmt.Printf(" %2d:%-6v", cell, color)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("royals:")
+	for _, r := range d.Royals {
+		fmt.Printf("  %v\t%v\t%v\n", r.ID, r.Points, r.Ability)
+	}
+
+	for tier := 3; tier >= 1; tier-- {
+		fmt.Printf("tier %v (%v in the deck):\n", tier, d.Decks[tier-1])
+		for _, c := range d.Cards[tier-1] {
+			printDuelCard(c)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("players:")
+	for _, p := range d.Players {
+		fmt.Printf("  %v : %v points, %v crowns, %v privileges", p.ID, p.Points, p.Crowns, p.Privileges)
+		if p.Resigned {
+			fmt.Print(" (resigned)")
+		}
+		fmt.Println()
+		fmt.Printf("    coins: %v\n", p.Coins)
+		fmt.Printf("    points by color: %v\n", p.ColorPoints)
+
+		m := map[string]int{}
+		for color, cards := range p.Cards {
+			m[color] = len(cards)
+		}
+		fmt.Println("    cards:", m)
+
+		for _, r := range p.Royals {
+			fmt.Printf("    royal: %v\n", r.ID)
+		}
+		fmt.Println("    reserved:")
+		for _, r := range p.Reserved {
+			fmt.Print("    ")
+			printDuelCard(r)
+		}
+	}
+}
+
+// PrintDuelCard prints a one-line summary of a Splendor Duel card.
+func printDuelCard(c *splenda.DuelCard) {
+	switch {
+	case c == nil:
+		fmt.Println("  (empty)")
+	case c.Hidden:
+		fmt.Printf("  tier %v\t(hidden)\n", c.Tier)
+	default:
+		fmt.Printf("  %v\t%v\t%v crowns\t%v\t%v\n", c.Color, c.Points, c.Crowns, c.Cost, c.Ability)
+	}
+}
+
+// ParseTier parses a tier number, which refers to the side row of Orient
+// cards if it starts with an o.
+func parseTier(str string) (int, bool, error) {
+	orient := strings.HasPrefix(str, "o")
+	tier, err := strconv.Atoi(strings.TrimPrefix(str, "o"))
+	return tier, orient, err
+}
+
+// PrintCard prints a one-line summary of a card.
+func printCard(c *splenda.Card) {
+	if c == nil {
+		fmt.Println("  (empty)")
+		return
+	}
+	if c.Hidden {
+		fmt.Printf("  tier %v\t(hidden)\n", c.Tier)
+		return
+	}
+	if c.Ability != "" {
+		fmt.Printf("  %v\t%v\t%v\t(%v)\n", c.Color, c.Points, c.Cost, c.Ability)
+		return
+	}
+	fmt.Printf("  %v\t%v\t%v\n", c.Color, c.Points, c.Cost)
 }
 
 func (a *args) call(cmd string) {
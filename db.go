@@ -2,6 +2,7 @@ package splenda
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -111,22 +112,27 @@ func (d *DB) GetUserHash(userID string) (string, error) {
 	return hash, nil
 }
 
-// ListGames lists the currently running games, and who is playing.
-func (d *DB) ListGames(userID string) (map[string][]string, error) {
+// ListGames lists the currently running games, what type of game each one
+// is, and who is playing. A user's own sandboxes are listed too, but not
+// sandboxes other users have made of their games.
+func (d *DB) ListGames(userID string) ([]*GameSummary, error) {
 	db, err := d.open()
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	q := "CREATE TEMP TABLE games AS (SELECT game_id AS id FROM players WHERE user_id=$1)"
+	q := "CREATE TEMP TABLE games AS (" +
+		"SELECT id, type, sandbox FROM games, players WHERE id=game_id AND user_id=$1 AND sandbox='' " +
+		"UNION SELECT id, type, sandbox FROM games WHERE sandbox=$1)"
 	if _, err := db.Exec(q, userID); err != nil {
 		return nil, err
 	}
 
-	ret := map[string][]string{}
+	ret := []*GameSummary{}
+	byID := map[string]*GameSummary{}
 
-	q = "SELECT id, user_id FROM games, players WHERE id=game_id ORDER BY index ASC"
+	q = "SELECT id, type, sandbox, user_id FROM games, players WHERE id=game_id ORDER BY index ASC"
 	rows, err := db.Query(q)
 	if err != nil {
 		return nil, err
@@ -134,12 +140,18 @@ func (d *DB) ListGames(userID string) (map[string][]string, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var id, uid string
-		if err := rows.Scan(&id, &uid); err != nil {
+		var id, typ, sandbox, uid string
+		if err := rows.Scan(&id, &typ, &sandbox, &uid); err != nil {
 			return nil, err
 		}
 
-		ret[id] = append(ret[id], uid)
+		game, ok := byID[id]
+		if !ok {
+			game = &GameSummary{ID: id, Type: typ, Sandbox: sandbox != ""}
+			byID[id] = game
+			ret = append(ret, game)
+		}
+		game.Players = append(game.Players, uid)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -153,6 +165,99 @@ func (d *DB) ListGames(userID string) (map[string][]string, error) {
 	return ret, nil
 }
 
+// ListTimedGames lists the unfinished games that have time controls.
+func (d *DB) ListTimedGames() ([]string, error) {
+	db, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id FROM games WHERE time_mode <> '' AND state <> 'gameover'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ListCardSets lists the card sets that unfinished games are being played
+// with, by the ID each game has pinned.
+func (d *DB) ListCardSets() ([]string, error) {
+	db, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT DISTINCT options FROM games WHERE type = 'splendor' AND state <> 'gameover'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	seen := map[string]bool{}
+
+	for rows.Next() {
+		var str string
+		if err := rows.Scan(&str); err != nil {
+			return nil, err
+		}
+		opts := Options{}
+		if err := json.Unmarshal([]byte(str), &opts); err != nil {
+			return nil, err
+		}
+		id := opts.withDefaults(2).CardSet
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, rows.Err()
+}
+
+// ListDuelSets lists the Splendor Duel card sets that unfinished games are
+// being played with, by the ID each game has pinned.
+func (d *DB) ListDuelSets() ([]string, error) {
+	db, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	q := "SELECT DISTINCT card_set FROM games, duel_games WHERE id = game_id AND state <> 'gameover'"
+	rows, err := db.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
 // NewTX begins a new transaction on the given game.
 func (d *DB) NewTX(gameID string) (*TX, error) {
 	db, err := d.open()
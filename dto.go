@@ -1,6 +1,10 @@
 package splenda
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // UserList is a list of users.
 type UserList struct {
@@ -18,10 +22,50 @@ type SID struct {
 	SID string `json:"sid"`
 }
 
-// GameSummary lists the ID and players of a given game.
+// GameSummary lists the ID and players of a given game. Type is "duel" for
+// a game of Splendor Duel, and "splendor" (or empty, when starting a game)
+// for the original game; Options and TimeControl only apply to the latter.
+// Sandbox is set for a private copy of a game made for analysis.
 type GameSummary struct {
-	ID      string   `json:"id"`
-	Players []string `json:"players"`
+	ID          string       `json:"id"`
+	Type        string       `json:"type,omitempty"`
+	Sandbox     bool         `json:"sandbox,omitempty"`
+	Players     []string     `json:"players"`
+	Options     *Options     `json:"options,omitempty"`
+	TimeControl *TimeControl `json:"timecontrol,omitempty"`
+}
+
+// Options are the house rules for a game. Anything left zero gets the
+// standard rule: 15 points to win, 4/5/7 coins of each color (and 8/9 for
+// five or six players, which is a house rule of its own) and 5 gold, one more
+// noble than there are players, 4 cards per tier and 3 reserve slots. Large
+// games may want a fifth card per tier. Players are seated in a random order
+// unless FixedSeats is set, in which case they play in the order they were
+// listed. CardSet picks which set of cards and nobles to play with; once the
+// game starts it's pinned to the version of the set it was dealt from. Mode
+// picks an expansion to play: "cities" replaces the nobles with cities,
+// "posts" adds trading posts and "orient" adds a side row of Orient cards
+// with special abilities.
+type Options struct {
+	Points       int    `json:"points,omitempty"`
+	Coins        int    `json:"coins,omitempty"`
+	Gold         int    `json:"gold,omitempty"`
+	Nobles       int    `json:"nobles,omitempty"`
+	CardsPerTier int    `json:"cardspertier,omitempty"`
+	ReserveSlots int    `json:"reserveslots,omitempty"`
+	FixedSeats   bool   `json:"fixedseats,omitempty"`
+	CardSet      string `json:"cardset,omitempty"`
+	Mode         string `json:"mode,omitempty"`
+}
+
+// TimeControl describes how long players get to move. In "move" mode each
+// turn has to be finished within Seconds; in "total" mode each player gets
+// Seconds for the whole game, like a chess clock. Timeout says what happens
+// to a player who runs out of time: "pass" (the default), "resign" or "bot".
+type TimeControl struct {
+	Mode    string `json:"mode"`
+	Seconds int    `json:"seconds"`
+	Timeout string `json:"timeout,omitempty"`
 }
 
 // GameList lists the current games.
@@ -36,8 +80,13 @@ type Noble struct {
 	Cost   map[string]int `json:"cost"`
 }
 
-// ToNobles hydrates a list of Noble DTOs from their IDs.
-func ToNobles(ids []string) ([]*Noble, error) {
+// ToNobles hydrates a list of Noble DTOs from their IDs in the given card set.
+func ToNobles(setID string, ids []string) ([]*Noble, error) {
+	set, err := getCardSet(setID)
+	if err != nil {
+		return nil, err
+	}
+
 	ret := []*Noble{}
 	for _, id := range ids {
 		if id == "" {
@@ -45,33 +94,94 @@ func ToNobles(ids []string) ([]*Noble, error) {
 			continue
 		}
 
-		noble, ok := nobleFromID(id)
+		noble, ok := set.noble(id)
 		if !ok {
 			return nil, fmt.Errorf("bogus noble id: %v", id)
 		}
 
 		ret = append(ret, &Noble{
 			ID:     id,
-			Points: 3, // All nobles are worth three points.
+			Points: noble.points,
 			Cost:   noble.cost,
 		})
 	}
 	return ret, nil
 }
 
-// Card describes a gem card.
-type Card struct {
+// City describes a city tile: a player wins by having at least Points, plus
+// at least Cost cards of each color.
+type City struct {
 	ID     string         `json:"id"`
-	Color  string         `json:"color"`
 	Points int            `json:"points"`
 	Cost   map[string]int `json:"cost"`
 }
 
-// ToCards hydrates a list of Card DTOs from their IDs.
-func ToCards(ids []string) ([]*Card, error) {
+// ToCities hydrates a list of City DTOs from their IDs in the given card set.
+func ToCities(setID string, ids []string) ([]*City, error) {
+	set, err := getCardSet(setID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*City{}
+	for _, id := range ids {
+		city, ok := set.city(id)
+		if !ok {
+			return nil, fmt.Errorf("bogus city id: %v", id)
+		}
+
+		ret = append(ret, &City{
+			ID:     id,
+			Points: city.points,
+			Cost:   city.cost,
+		})
+	}
+	return ret, nil
+}
+
+// Post describes a trading post a player has unlocked.
+type Post struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// ToPosts hydrates a list of Post DTOs from their IDs.
+func ToPosts(ids []string) ([]*Post, error) {
+	ret := []*Post{}
+	for _, id := range ids {
+		post, ok := getTradingPost(id)
+		if !ok {
+			return nil, fmt.Errorf("bogus trading post id: %v", id)
+		}
+
+		ret = append(ret, &Post{
+			ID:          id,
+			Description: post.description,
+		})
+	}
+	return ret, nil
+}
+
+// Card describes a gem card. Cards that are hidden from the viewer only
+// include their tier. Orient cards have an Ability: "double" cards count as
+// two bonuses of their color, "joker" cards copy the color of one of their
+// owner's bonuses (and have no color until they're bought), "reserve" cards
+// come with a free reserve and "noble" cards claim any noble on the table.
+type Card struct {
+	ID      string         `json:"id"`
+	Tier    int            `json:"tier"`
+	Color   string         `json:"color"`
+	Points  int            `json:"points"`
+	Cost    map[string]int `json:"cost"`
+	Ability string         `json:"ability,omitempty"`
+	Hidden  bool           `json:"hidden,omitempty"`
+}
+
+// ToCards hydrates a list of Card DTOs from their IDs in the given card set.
+func ToCards(setID string, ids []string) ([]*Card, error) {
 	ret := []*Card{}
 	for _, id := range ids {
-		card, err := ToCard(id)
+		card, err := ToCard(setID, id)
 		if err != nil {
 			return nil, err
 		}
@@ -80,31 +190,41 @@ func ToCards(ids []string) ([]*Card, error) {
 	return ret, nil
 }
 
-// ToCard hydrates a Card DTO from its ID.
-func ToCard(id string) (*Card, error) {
+// ToCard hydrates a Card DTO from its ID in the given card set.
+func ToCard(setID string, id string) (*Card, error) {
 	if id == "" {
 		return nil, nil
 	}
 
-	card, ok := cardFromID(id)
+	set, err := getCardSet(setID)
+	if err != nil {
+		return nil, err
+	}
+	card, ok := set.card(id)
 	if !ok {
 		return nil, fmt.Errorf("bogus card id: %v", id)
 	}
 
 	return &Card{
-		ID:     id,
-		Color:  card.color,
-		Points: card.points,
-		Cost:   card.cost,
+		ID:      id,
+		Tier:    card.tier,
+		Color:   card.color,
+		Points:  card.points,
+		Cost:    card.cost,
+		Ability: card.ability,
 	}, nil
 }
 
-// Table describes the state of the shared table.
+// Table describes the state of the shared table. Orient and OrientDecks are
+// the side row of Orient cards, in Orient mode.
 type Table struct {
-	Coins  map[string]int `json:"coins"`
-	Nobles []*Noble       `json:"nobles"`
-	Cards  [][]*Card      `json:"cards"`
-	Decks  []int          `json:"decks"`
+	Coins       map[string]int `json:"coins"`
+	Nobles      []*Noble       `json:"nobles"`
+	Cities      []*City        `json:"cities,omitempty"`
+	Cards       [][]*Card      `json:"cards"`
+	Decks       []int          `json:"decks"`
+	Orient      [][]*Card      `json:"orient,omitempty"`
+	OrientDecks []int          `json:"orientdecks,omitempty"`
 }
 
 // Player describes the state of a player's hand.
@@ -115,17 +235,61 @@ type Player struct {
 	Cards    map[string][]*Card `json:"cards"`
 	Reserved []*Card            `json:"reserved"`
 	Points   int                `json:"points"`
+	Resigned bool               `json:"resigned,omitempty"`
+	City     *City              `json:"city,omitempty"`
+	Posts    []*Post            `json:"posts,omitempty"`
+}
+
+// Standing describes a player's final position in a finished game. Players
+// who are still tied after the tie-break share a rank.
+type Standing struct {
+	ID       string `json:"id"`
+	Rank     int    `json:"rank"`
+	Points   int    `json:"points"`
+	Cards    int    `json:"cards"`
+	Resigned bool   `json:"resigned,omitempty"`
+	City     string `json:"city,omitempty"`
 }
 
-// Game describes the overall state of the game.
+// Game describes the overall state of the game. Type says which game it is;
+// a game of Splendor Duel has its table and players in Duel rather than Table
+// and Players. Winner and Standings are only set once the game is over;
+// Winner is empty if the victory is shared. DeleteVotes lists the players who
+// want an unfinished game deleted. TimeLeft is how many seconds each player
+// still has, if the game has time controls. Sandbox is set for a private
+// copy of a game made for analysis, where the owner moves for every seat.
+// Version changes whenever anything but the time left does, unlike TS, which
+// goes back when a move is taken back.
 type Game struct {
-	ID      string `json:"id"`
-	TS      string `json:"ts"`
-	State   string `json:"state"`
-	Current string `json:"current"`
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Sandbox bool     `json:"sandbox,omitempty"`
+	TS      string   `json:"ts"`
+	Version string   `json:"version,omitempty"`
+	State   string   `json:"state"`
+	Current string   `json:"current"`
+	Options *Options `json:"options,omitempty"`
 
 	Table   *Table    `json:"table"`
 	Players []*Player `json:"players"`
+	Duel    *Duel     `json:"duel,omitempty"`
+
+	Winner    string      `json:"winner,omitempty"`
+	Standings []*Standing `json:"standings,omitempty"`
+
+	Undo        *Undo    `json:"undo,omitempty"`
+	DeleteVotes []string `json:"deletevotes,omitempty"`
+
+	TimeControl *TimeControl   `json:"timecontrol,omitempty"`
+	TimeLeft    map[string]int `json:"timeleft,omitempty"`
+}
+
+// Undo describes the last move of a game, which its player may ask to take
+// back; Responder is the player who gets to accept or decline.
+type Undo struct {
+	Player    string `json:"player"`
+	Responder string `json:"responder"`
+	Requested bool   `json:"requested"`
 }
 
 // Take3 is a request to take three coins.
@@ -133,18 +297,212 @@ type Take3 struct {
 	Colors []string `json:"colors"`
 }
 
-// Take2 is a request to take two coins.
+// Take2 is a request to take two coins. Extra is the color of the extra coin
+// to take, for players with the trading post that allows it.
 type Take2 struct {
 	Color string `json:"color"`
+	Extra string `json:"extra,omitempty"`
 }
 
-// Buy is a request to buy a card.
+// Buy is a request to buy or reserve a card. A reserve request may set Deck
+// instead of Index to reserve the top card of the given tier's deck. A buy
+// request may set Payment to choose exactly which coins to pay with, and must
+// set Color to the color a joker card copies. Orient picks the side row of
+// Orient cards.
 type Buy struct {
-	Tier  int `json:"tier"`
-	Index int `json:"index"`
+	Tier    int            `json:"tier"`
+	Index   int            `json:"index"`
+	Deck    bool           `json:"deck,omitempty"`
+	Orient  bool           `json:"orient,omitempty"`
+	Payment map[string]int `json:"payment,omitempty"`
+	Color   string         `json:"color,omitempty"`
+}
+
+// PickNoble is a request to pick a noble.
+type PickNoble struct {
+	Noble string `json:"noble"`
+}
+
+// ReturnCoins is a request to return coins to the bank.
+type ReturnCoins struct {
+	Coins map[string]int `json:"coins"`
 }
 
-// TS is a response containing an updated timestamp.
+// HistoryEntry is one move from a game's history. TS is the game's timestamp
+// after the move; a move that was taken back is followed by an entry of type
+// "undo" with the timestamp the game went back to. Params are the move as it
+// was made. Coins are what the player took from the bank (positive) or gave
+// back to it (negative), Card is the card dealt to replace one taken from the
+// table, and Noble is the noble or royal the player claimed.
+type HistoryEntry struct {
+	TS     int             `json:"ts"`
+	Time   time.Time       `json:"time"`
+	Player string          `json:"player"`
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Coins  map[string]int  `json:"coins,omitempty"`
+	Card   string          `json:"card,omitempty"`
+	Noble  string          `json:"noble,omitempty"`
+}
+
+// History lists the moves made in a game, oldest first.
+type History struct {
+	Moves []*HistoryEntry `json:"moves"`
+}
+
+// MoveList lists the moves a player could legally make.
+type MoveList struct {
+	Moves []Move `json:"moves"`
+}
+
+// DuelCard describes a Splendor Duel card. Cards that are hidden from the
+// viewer only include their tier. Abilities are "again" for another turn,
+// "token" to take a token of the card's color from the board, "privilege" to
+// take a privilege, "steal" to take a token from the other player, and
+// "joker" for cards that copy the color of one of their owner's bonuses.
+type DuelCard struct {
+	ID      string         `json:"id"`
+	Tier    int            `json:"tier"`
+	Color   string         `json:"color"`
+	Points  int            `json:"points"`
+	Crowns  int            `json:"crowns,omitempty"`
+	Cost    map[string]int `json:"cost"`
+	Ability string         `json:"ability,omitempty"`
+	Hidden  bool           `json:"hidden,omitempty"`
+}
+
+// ToDuelCards hydrates a list of DuelCard DTOs from their IDs in the given
+// duel set.
+func ToDuelCards(setID string, ids []string) ([]*DuelCard, error) {
+	set, err := getDuelSet(setID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*DuelCard{}
+	for _, id := range ids {
+		if id == "" {
+			ret = append(ret, nil)
+			continue
+		}
+
+		card, ok := set.card(id)
+		if !ok {
+			return nil, fmt.Errorf("bogus card id: %v", id)
+		}
+
+		ret = append(ret, &DuelCard{
+			ID:      id,
+			Tier:    card.tier,
+			Color:   card.color,
+			Points:  card.points,
+			Crowns:  card.crowns,
+			Cost:    card.cost,
+			Ability: card.ability,
+		})
+	}
+	return ret, nil
+}
+
+// Royal describes a royal card in Splendor Duel.
+type Royal struct {
+	ID      string `json:"id"`
+	Points  int    `json:"points"`
+	Ability string `json:"ability,omitempty"`
+}
+
+// ToRoyals hydrates a list of Royal DTOs from their IDs in the given duel set.
+func ToRoyals(setID string, ids []string) ([]*Royal, error) {
+	set, err := getDuelSet(setID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Royal{}
+	for _, id := range ids {
+		r, ok := set.royal(id)
+		if !ok {
+			return nil, fmt.Errorf("bogus royal id: %v", id)
+		}
+		ret = append(ret, &Royal{ID: id, Points: r.points, Ability: r.ability})
+	}
+	return ret, nil
+}
+
+// Duel describes the table and players of a Splendor Duel game. The board
+// lists the token in each cell, row by row from the top left, with "" for an
+// empty cell; Bag is how many tokens are left to refill it with. Again is set
+// when the current player has earned another turn, and once the game is over
+// Victory says how it was won: "points", "crowns", "color" or "resigned".
+type Duel struct {
+	Board      []string      `json:"board"`
+	Bag        int           `json:"bag"`
+	Privileges int           `json:"privileges"`
+	Cards      [][]*DuelCard `json:"cards"`
+	Decks      []int         `json:"decks"`
+	Royals     []*Royal      `json:"royals"`
+	Again      bool          `json:"again,omitempty"`
+	Players    []*DuelPlayer `json:"players"`
+	Victory    string        `json:"victory,omitempty"`
+}
+
+// DuelPlayer describes the state of a player's hand in a Splendor Duel game.
+// ColorPoints is how many points they have from cards of each color.
+type DuelPlayer struct {
+	ID          string                 `json:"id"`
+	Coins       map[string]int         `json:"coins"`
+	Cards       map[string][]*DuelCard `json:"cards"`
+	Reserved    []*DuelCard            `json:"reserved"`
+	Royals      []*Royal               `json:"royals"`
+	Privileges  int                    `json:"privileges"`
+	Points      int                    `json:"points"`
+	Crowns      int                    `json:"crowns"`
+	ColorPoints map[string]int         `json:"colorpoints"`
+	Resigned    bool                   `json:"resigned,omitempty"`
+}
+
+// DuelMoveList lists the moves a player could legally make in a Splendor
+// Duel game.
+type DuelMoveList struct {
+	Moves []DuelMove `json:"moves"`
+}
+
+// TS is a response containing an updated timestamp, or a request naming an
+// earlier one to fork a game at or rewind a sandbox to.
 type TS struct {
 	TS string `json:"ts"`
 }
+
+// Change tells someone watching a game that it has changed, giving its new
+// timestamp and version.
+type Change struct {
+	TS      string `json:"ts"`
+	Version string `json:"version"`
+}
+
+// Command is a frame sent over a game's WebSocket to make a move. Type names
+// the move the same way as the end of its POST endpoint's path (eg "take3",
+// "undo/accept" or "duel/take"), and Params holds the same body that endpoint
+// takes. The ID is up to the client, and is echoed back in the reply.
+type Command struct {
+	ID     string          `json:"id,omitempty"`
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// SocketMessage is a frame sent back over a game's WebSocket. Its Type says
+// what it is: "game" carries the latest state of the game, sent on connect and
+// whenever it changes; "ok" carries the Result a command's POST endpoint would
+// have returned, usually the new timestamp; and "error" says why a command,
+// or the connection itself, failed, with the HTTP status its POST endpoint
+// would have sent.
+type SocketMessage struct {
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Command string      `json:"command,omitempty"`
+	TS      string      `json:"ts,omitempty"`
+	Game    *Game       `json:"game,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	Status  int         `json:"status,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
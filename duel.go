@@ -0,0 +1,1109 @@
+package splenda
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Splendor Duel move types, on top of the shared reserve, buy, returncoins
+// and resign.
+const (
+	moveTake      = "take"
+	movePrivilege = "privilege"
+	moveRefill    = "refill"
+	moveTakeToken = "taketoken"
+	moveSteal     = "steal"
+	movePickRoyal = "pickroyal"
+)
+
+// Splendor Duel event types, on top of the shared ones.
+const (
+	eventPrivilege = "privilege"
+	eventRefill    = "refill"
+	eventRoyal     = "royal"
+)
+
+// Splendor Duel rules.
+const (
+	numDuelPlayers    = 2
+	boardSize         = 5
+	boardCells        = boardSize * boardSize
+	tokensPerColor    = 4
+	pearlsInGame      = 2
+	goldInGame        = 3
+	numPrivileges     = 3
+	maxDuelReserved   = 3
+	duelMaxTakeTokens = 3
+	duelPointsToWin   = 20
+	duelCrownsToWin   = 10
+	duelColorToWin    = 10
+)
+
+// Ways of winning a Splendor Duel game.
+const (
+	duelNoVictory   = ""
+	duelWinPoints   = "points"
+	duelWinCrowns   = "crowns"
+	duelWinColor    = "color"
+	duelWinResigned = "resigned"
+)
+
+// The number of crowns that earn each royal.
+var royalCrowns = []int{3, 6}
+
+// The order the board is filled in: a spiral out from the center.
+var boardSpiral = spiral()
+
+func spiral() []int {
+	ret := []int{boardCells / 2}
+	row, col := boardSize/2, boardSize/2
+	dirs := [][2]int{{0, 1}, {1, 0}, {0, -1}, {-1, 0}}
+	for leg := 0; len(ret) < boardCells; leg++ {
+		d := dirs[leg%len(dirs)]
+		for i := 0; i < leg/2+1 && len(ret) < boardCells; i++ {
+			row, col = row+d[0], col+d[1]
+			ret = append(ret, row*boardSize+col)
+		}
+	}
+	return ret
+}
+
+// DuelState is the complete state of a Splendor Duel game. The board is a
+// five by five grid of tokens stored row by row, with "" for an empty cell,
+// and the bag holds the tokens that will be drawn to refill it, in order.
+// Again is set when the current player has earned another turn, and CardSet
+// is the pinned ID of the set the game was dealt from.
+type DuelState struct {
+	TS         int                `json:"ts"`
+	CardSet    string             `json:"cardset,omitempty"`
+	State      string             `json:"state"`
+	Current    string             `json:"current"`
+	Board      []string           `json:"board"`
+	Bag        []string           `json:"bag"`
+	Privileges int                `json:"privileges"`
+	Cards      [][]string         `json:"cards"`
+	Decks      [][]string         `json:"decks"`
+	Royals     []string           `json:"royals"`
+	Again      bool               `json:"again,omitempty"`
+	Players    []*DuelPlayerState `json:"players"`
+}
+
+// DuelPlayerState is the state of a single player's hand in a Splendor Duel
+// game. Coins include pearls, and Jokers records which color each joker card
+// they've bought is copying.
+type DuelPlayerState struct {
+	ID         string            `json:"id"`
+	Coins      map[string]int    `json:"coins"`
+	Cards      []string          `json:"cards"`
+	Reserved   []string          `json:"reserved"`
+	Hidden     []string          `json:"hidden"`
+	Royals     []string          `json:"royals"`
+	Privileges int               `json:"privileges"`
+	Jokers     map[string]string `json:"jokers,omitempty"`
+	Resigned   bool              `json:"resigned,omitempty"`
+}
+
+// A DuelMove is a single action taken by a player in a Splendor Duel game.
+// Cells are board positions, counting row by row from the top left: the
+// tokens to take, or the gold to take when reserving. Color is the color a
+// joker copies, or the color of token to steal.
+type DuelMove struct {
+	Type   string         `json:"type"`
+	Player string         `json:"player"`
+	Cells  []int          `json:"cells,omitempty"`
+	Tier   int            `json:"tier,omitempty"`
+	Index  int            `json:"index,omitempty"`
+	Deck   bool           `json:"deck,omitempty"`
+	Color  string         `json:"color,omitempty"`
+	Coins  map[string]int `json:"coins,omitempty"`
+	Royal  string         `json:"royal,omitempty"`
+}
+
+// NewDuelState deals out the initial state of a Splendor Duel game between
+// the given players, seated in a random order. The second player starts
+// with a privilege to make up for going second.
+func newDuelState(players []string, rng rng) (*DuelState, error) {
+	set, err := getDuelSet(defaultCardSet)
+	if err != nil {
+		return nil, err
+	}
+	if len(players) != numDuelPlayers {
+		return nil, fmt.Errorf("need exactly %v players", numDuelPlayers)
+	}
+
+	players = shuffle(players, rng)
+
+	tokens := []string{}
+	for _, color := range []string{white, black, green, blue, red} {
+		for i := 0; i < tokensPerColor; i++ {
+			tokens = append(tokens, color)
+		}
+	}
+	for i := 0; i < pearlsInGame; i++ {
+		tokens = append(tokens, pearl)
+	}
+	for i := 0; i < goldInGame; i++ {
+		tokens = append(tokens, wild)
+	}
+
+	s := &DuelState{
+		CardSet:    set.pinnedID(),
+		State:      play,
+		Current:    players[0],
+		Board:      make([]string, boardCells),
+		Bag:        shuffle(tokens, rng),
+		Privileges: numPrivileges - 1,
+		Royals:     set.royalIDs(),
+	}
+	fillBoard(s)
+
+	for tier, n := range duelCardsPerTier {
+		deck := set.shuffleCards(tier+1, rng)
+		s.Cards = append(s.Cards, deck[:n])
+		s.Decks = append(s.Decks, deck[n:])
+	}
+
+	for _, id := range players {
+		s.Players = append(s.Players, newDuelPlayerState(id))
+	}
+	s.Players[1].Privileges = 1
+
+	return s, nil
+}
+
+func newDuelPlayerState(userID string) *DuelPlayerState {
+	coins := map[string]int{}
+	for _, color := range []string{red, blue, green, black, white, pearl, wild} {
+		coins[color] = 0
+	}
+
+	return &DuelPlayerState{
+		ID:       userID,
+		Coins:    coins,
+		Cards:    []string{},
+		Reserved: []string{},
+		Hidden:   []string{},
+		Royals:   []string{},
+	}
+}
+
+// FillBoard draws tokens from the bag into the empty cells of the board,
+// spiralling out from the center, until either runs out.
+func fillBoard(s *DuelState) {
+	for _, cell := range boardSpiral {
+		if len(s.Bag) == 0 {
+			return
+		}
+		if s.Board[cell] == "" {
+			s.Board[cell] = s.Bag[0]
+			s.Bag = s.Bag[1:]
+		}
+	}
+}
+
+// Player returns the state of the given player, or nil if they're not
+// playing in this game.
+func (s *DuelState) Player(userID string) *DuelPlayerState {
+	for _, p := range s.Players {
+		if p.ID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+// Opponent returns the state of the other player.
+func (s *DuelState) Opponent(userID string) *DuelPlayerState {
+	for _, p := range s.Players {
+		if p.ID != userID {
+			return p
+		}
+	}
+	return nil
+}
+
+// Winner returns the ID of the player who won, and how, once the game is
+// over.
+func (s *DuelState) Winner(set *duelSet) (string, string) {
+	for _, p := range s.Players {
+		if p.Resigned {
+			return s.Opponent(p.ID).ID, duelWinResigned
+		}
+	}
+	for _, p := range s.Players {
+		if how := p.Victory(set); how != duelNoVictory {
+			return p.ID, how
+		}
+	}
+	return "", duelNoVictory
+}
+
+// Clone returns a deep copy of the state.
+func (s *DuelState) Clone() *DuelState {
+	c := *s
+	c.Board = copyStrings(s.Board)
+	c.Bag = copyStrings(s.Bag)
+	c.Cards = copyRows(s.Cards)
+	c.Decks = copyRows(s.Decks)
+	c.Royals = copyStrings(s.Royals)
+
+	c.Players = []*DuelPlayerState{}
+	for _, p := range s.Players {
+		c.Players = append(c.Players, &DuelPlayerState{
+			ID:         p.ID,
+			Coins:      copyCoins(p.Coins),
+			Cards:      copyStrings(p.Cards),
+			Reserved:   copyStrings(p.Reserved),
+			Hidden:     copyStrings(p.Hidden),
+			Royals:     copyStrings(p.Royals),
+			Privileges: p.Privileges,
+			Jokers:     copyJokers(p.Jokers),
+			Resigned:   p.Resigned,
+		})
+	}
+
+	return &c
+}
+
+// Bonuses returns the bonus of each color the player has from the cards
+// they've bought, counting jokers as whichever color they're copying.
+func (p *DuelPlayerState) Bonuses(set *duelSet) map[string]int {
+	ret := map[string]int{}
+	for _, id := range p.Cards {
+		if color := p.cardColor(set, id); color != "" {
+			ret[color]++
+		}
+	}
+	return ret
+}
+
+func (p *DuelPlayerState) cardColor(set *duelSet, id string) string {
+	card, ok := set.card(id)
+	if !ok {
+		return ""
+	}
+	if card.ability == abilityJoker {
+		return p.Jokers[id]
+	}
+	return card.color
+}
+
+// Points calculates the current score for a player.
+func (p *DuelPlayerState) Points(set *duelSet) int {
+	points := 0
+	for _, id := range p.Cards {
+		if card, ok := set.card(id); ok {
+			points += card.points
+		}
+	}
+	for _, id := range p.Royals {
+		if r, ok := set.royal(id); ok {
+			points += r.points
+		}
+	}
+	return points
+}
+
+// ColorPoints returns the points the player has from cards of each color.
+func (p *DuelPlayerState) ColorPoints(set *duelSet) map[string]int {
+	ret := map[string]int{}
+	for _, id := range p.Cards {
+		if card, ok := set.card(id); ok && card.points > 0 {
+			ret[p.cardColor(set, id)] += card.points
+		}
+	}
+	return ret
+}
+
+// Crowns returns the number of crowns on the player's cards.
+func (p *DuelPlayerState) Crowns(set *duelSet) int {
+	crowns := 0
+	for _, id := range p.Cards {
+		if card, ok := set.card(id); ok {
+			crowns += card.crowns
+		}
+	}
+	return crowns
+}
+
+// Victory returns how the player has won, if they have: with enough points,
+// enough crowns, or enough points from cards of a single color.
+func (p *DuelPlayerState) Victory(set *duelSet) string {
+	if p.Points(set) >= duelPointsToWin {
+		return duelWinPoints
+	}
+	if p.Crowns(set) >= duelCrownsToWin {
+		return duelWinCrowns
+	}
+	for _, points := range p.ColorPoints(set) {
+		if points >= duelColorToWin {
+			return duelWinColor
+		}
+	}
+	return duelNoVictory
+}
+
+// CountCoins returns the total number of tokens the player is holding.
+func (p *DuelPlayerState) CountCoins() int {
+	total := 0
+	for _, count := range p.Coins {
+		total += count
+	}
+	return total
+}
+
+// ApplyDuel applies a move to the given Splendor Duel state, returning the
+// resulting state and the events that happened along the way. The given
+// state is not modified.
+func ApplyDuel(state *DuelState, move DuelMove) (*DuelState, []Event, error) {
+	if state.State == gameover {
+		return nil, nil, errors.New("game is over")
+	}
+
+	index := -1
+	for i, p := range state.Players {
+		if p.ID == move.Player {
+			index = i
+		}
+	}
+	if index == -1 {
+		return nil, nil, errors.New("no such player")
+	}
+	// Players can resign whenever they like; everything else waits for their turn.
+	if move.Player != state.Current && move.Type != moveResign {
+		return nil, nil, errors.New("not your turn")
+	}
+
+	set, err := getDuelSet(state.CardSet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &duelTurn{state: state.Clone(), set: set}
+	t.player = t.state.Players[index]
+	t.opponent = t.state.Players[1-index]
+
+	switch move.Type {
+	case moveTake:
+		err = t.Take(move.Cells)
+	case movePrivilege:
+		err = t.UsePrivileges(move.Cells)
+	case moveRefill:
+		err = t.Refill()
+	case moveReserve:
+		if len(move.Cells) != 1 {
+			return nil, nil, errors.New("must take one gold token")
+		}
+		err = t.Reserve(move.Cells[0], move.Tier, move.Index, move.Deck)
+	case moveBuy:
+		err = t.Buy(move.Tier, move.Index, move.Color)
+	case moveTakeToken:
+		if len(move.Cells) != 1 {
+			return nil, nil, errors.New("must take one token")
+		}
+		err = t.TakeToken(move.Cells[0])
+	case moveSteal:
+		err = t.Steal(move.Color)
+	case movePickRoyal:
+		err = t.PickRoyal(move.Royal)
+	case moveReturnCoins:
+		err = t.ReturnCoins(move.Coins)
+	case moveResign:
+		err = t.Resign()
+	default:
+		err = fmt.Errorf("unknown move: %v", move.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.state.TS++
+	return t.state, t.events, nil
+}
+
+// A duelTurn holds the working state while applying a single move to a
+// Splendor Duel game.
+type duelTurn struct {
+	state    *DuelState
+	set      *duelSet
+	player   *DuelPlayerState
+	opponent *DuelPlayerState
+	events   []Event
+}
+
+func (t *duelTurn) expect(states ...string) error {
+	if find(t.state.State, states) == -1 {
+		return errors.New("can't do that right now")
+	}
+	return nil
+}
+
+// Take takes up to three tokens from the board, which must be next to each
+// other in a line. Gold can only be taken by reserving a card. Taking three
+// tokens of the same color, or both pearls, gives the other player a
+// privilege.
+func (t *duelTurn) Take(cells []int) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+	if len(cells) == 0 || len(cells) > duelMaxTakeTokens {
+		return fmt.Errorf("must take one to %v tokens", duelMaxTakeTokens)
+	}
+	if !inLine(cells) {
+		return errors.New("tokens must be next to each other in a line")
+	}
+
+	taken := map[string]int{}
+	for _, cell := range cells {
+		switch color := t.state.Board[cell]; color {
+		case "":
+			return errors.New("that cell is empty")
+		case wild:
+			return errors.New("gold can only be taken by reserving a card")
+		default:
+			taken[color]++
+		}
+	}
+
+	t.TakeCells(cells)
+
+	for color, count := range taken {
+		if count == duelMaxTakeTokens || (color == pearl && count == pearlsInGame) {
+			t.GainPrivilege(t.opponent)
+		}
+	}
+
+	t.EndTurn()
+	return nil
+}
+
+// UsePrivileges spends one of the player's privileges for each of the given
+// tokens, taking them from anywhere on the board. It doesn't use up their
+// turn.
+func (t *duelTurn) UsePrivileges(cells []int) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+	if len(cells) == 0 {
+		return errors.New("must pick a token")
+	}
+	if len(cells) > t.player.Privileges {
+		return errors.New("not enough privileges")
+	}
+
+	seen := map[int]bool{}
+	for _, cell := range cells {
+		if cell < 0 || cell >= boardCells || seen[cell] {
+			return errors.New("bad cell")
+		}
+		seen[cell] = true
+
+		switch t.state.Board[cell] {
+		case "":
+			return errors.New("that cell is empty")
+		case wild:
+			return errors.New("can't take gold with a privilege")
+		}
+	}
+
+	t.player.Privileges -= len(cells)
+	t.state.Privileges += len(cells)
+	t.TakeCells(cells)
+	return nil
+}
+
+// Refill refills the board from the bag, which gives the other player a
+// privilege. It doesn't use up the player's turn.
+func (t *duelTurn) Refill() error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+	if len(t.state.Bag) == 0 {
+		return errors.New("the bag is empty")
+	}
+
+	fillBoard(t.state)
+	t.events = append(t.events, Event{Type: eventRefill, Player: t.player.ID})
+
+	t.GainPrivilege(t.opponent)
+	return nil
+}
+
+// Reserve takes a gold token from the board and reserves a face-up card, or
+// the top card of a deck without revealing it.
+func (t *duelTurn) Reserve(cell int, tier int, index int, deck bool) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+	if len(t.player.Reserved) >= maxDuelReserved {
+		return errors.New("can't reserve any more cards")
+	}
+	if cell < 0 || cell >= boardCells || t.state.Board[cell] != wild {
+		return errors.New("must take a gold token to reserve")
+	}
+	if tier < 1 || tier > len(t.state.Cards) {
+		return errors.New("no such tier")
+	}
+
+	var cardID string
+	if deck {
+		d := t.state.Decks[tier-1]
+		if len(d) == 0 {
+			return errors.New("that deck is empty")
+		}
+		cardID = d[0]
+		t.state.Decks[tier-1] = d[1:]
+		t.player.Hidden = append(t.player.Hidden, cardID)
+	} else {
+		id, err := t.GetCardID(tier, index)
+		if err != nil {
+			return err
+		}
+		cardID = id
+		t.DealCard(tier, index)
+	}
+
+	t.player.Reserved = append(t.player.Reserved, cardID)
+	t.events = append(t.events, Event{
+		Type:   eventReserve,
+		Player: t.player.ID,
+		Card:   cardID,
+		Tier:   tier,
+		Index:  index,
+	})
+	t.TakeCells([]int{cell})
+
+	t.EndTurn()
+	return nil
+}
+
+// Buy buys a card, either from the table or from the player's reserved cards.
+// Joker cards need the color of one of the player's bonuses to copy.
+func (t *duelTurn) Buy(tier int, index int, joker string) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+
+	cardID, err := t.GetCardID(tier, index)
+	if err != nil {
+		return err
+	}
+	card, ok := t.set.card(cardID)
+	if !ok {
+		return errors.New("bogus card ID")
+	}
+
+	bonuses := t.player.Bonuses(t.set)
+	if card.ability == abilityJoker {
+		if !isNormalColor(joker) || bonuses[joker] == 0 {
+			return errors.New("joker must copy the color of one of your cards")
+		}
+	} else if joker != "" {
+		return errors.New("only jokers copy a color")
+	}
+
+	if err := t.PayCost(bonuses, card.cost); err != nil {
+		return err
+	}
+
+	if tier > 0 {
+		t.DealCard(tier, index)
+	} else {
+		r := t.player.Reserved
+		t.player.Reserved = append(r[:index], r[index+1:]...)
+		if i := find(cardID, t.player.Hidden); i != -1 {
+			h := t.player.Hidden
+			t.player.Hidden = append(h[:i], h[i+1:]...)
+		}
+	}
+
+	t.player.Cards = append(t.player.Cards, cardID)
+	if card.ability == abilityJoker {
+		if t.player.Jokers == nil {
+			t.player.Jokers = map[string]string{}
+		}
+		t.player.Jokers[cardID] = joker
+	}
+	t.events = append(t.events, Event{
+		Type:   eventBuy,
+		Player: t.player.ID,
+		Card:   cardID,
+		Tier:   tier,
+		Index:  index,
+	})
+
+	switch card.ability {
+	case abilityAgain:
+		t.state.Again = true
+	case abilityPrivilege:
+		t.GainPrivilege(t.player)
+	case abilityToken:
+		if t.boardHas(t.player.cardColor(t.set, cardID)) {
+			t.state.State = taketoken
+			return nil
+		}
+	case abilitySteal:
+		if t.canSteal() {
+			t.state.State = stealtoken
+			return nil
+		}
+	}
+
+	t.AfterAbility()
+	return nil
+}
+
+// TakeToken takes a token of the same color as the card the player just
+// bought from the board.
+func (t *duelTurn) TakeToken(cell int) error {
+	if err := t.expect(taketoken); err != nil {
+		return err
+	}
+	if cell < 0 || cell >= boardCells {
+		return errors.New("bad cell")
+	}
+
+	last := t.player.Cards[len(t.player.Cards)-1]
+	if t.state.Board[cell] != t.player.cardColor(t.set, last) {
+		return errors.New("must take a token of the card's color")
+	}
+
+	t.TakeCells([]int{cell})
+	t.AfterAbility()
+	return nil
+}
+
+// Steal takes a token of the given color from the other player. Gold can't
+// be stolen.
+func (t *duelTurn) Steal(color string) error {
+	if err := t.expect(stealtoken); err != nil {
+		return err
+	}
+	if !isDuelColor(color) {
+		return errors.New("invalid token color")
+	}
+	if t.opponent.Coins[color] == 0 {
+		return ErrInsufficientCoins
+	}
+
+	t.opponent.Coins[color]--
+	t.player.Coins[color]++
+	t.events = append(t.events,
+		Event{Type: eventCoins, Player: t.opponent.ID, Coins: map[string]int{color: -1}},
+		Event{Type: eventCoins, Player: t.player.ID, Coins: map[string]int{color: 1}})
+
+	t.AfterAbility()
+	return nil
+}
+
+// PickRoyal claims one of the royals, once the player has earned one with
+// their crowns.
+func (t *duelTurn) PickRoyal(royalID string) error {
+	if err := t.expect(pickroyal); err != nil {
+		return err
+	}
+	i := find(royalID, t.state.Royals)
+	if i == -1 {
+		return errors.New("can't pick that royal")
+	}
+	r, ok := t.set.royal(royalID)
+	if !ok {
+		return errors.New("bogus royal ID")
+	}
+
+	t.state.Royals = append(t.state.Royals[:i], t.state.Royals[i+1:]...)
+	t.player.Royals = append(t.player.Royals, royalID)
+	t.events = append(t.events, Event{Type: eventRoyal, Player: t.player.ID, Noble: royalID})
+
+	switch r.ability {
+	case abilityAgain:
+		t.state.Again = true
+	case abilityPrivilege:
+		t.GainPrivilege(t.player)
+	case abilitySteal:
+		if t.canSteal() {
+			t.state.State = stealtoken
+			return nil
+		}
+	}
+
+	t.AfterAbility()
+	return nil
+}
+
+// ReturnCoins puts tokens back in the bag when the player is holding too
+// many.
+func (t *duelTurn) ReturnCoins(coins map[string]int) error {
+	if err := t.expect(losecoin); err != nil {
+		return err
+	}
+
+	// Make sure they're giving back exactly enough to get down to the limit.
+	total := t.player.CountCoins()
+	for color, count := range coins {
+		if !isDuelColor(color) && color != wild {
+			return errors.New("invalid token color")
+		}
+		if count <= 0 {
+			return errors.New("must return a positive number of tokens")
+		}
+		if t.player.Coins[color] < count {
+			return ErrInsufficientCoins
+		}
+		total -= count
+	}
+	if total != maxCoins {
+		return fmt.Errorf("must return tokens until you have exactly %v", maxCoins)
+	}
+
+	t.ReturnToBag(coins)
+	t.FinishTurn()
+	return nil
+}
+
+// Resign drops the player out of the game, which hands the win to the other
+// player.
+func (t *duelTurn) Resign() error {
+	t.player.Resigned = true
+	t.state.State = gameover
+	t.events = append(t.events,
+		Event{Type: eventResign, Player: t.player.ID},
+		Event{Type: eventGameOver})
+	return nil
+}
+
+//
+// Shared rules.
+//
+
+// GetCardID gets the ID of the card at a given position. Tier zero refers to
+// the player's reserved cards.
+func (t *duelTurn) GetCardID(tier int, index int) (string, error) {
+	row := t.player.Reserved
+	if tier != 0 {
+		if tier < 0 || tier > len(t.state.Cards) {
+			return "", errors.New("no such tier")
+		}
+		row = t.state.Cards[tier-1]
+	}
+	if index < 0 || index >= len(row) || row[index] == "" {
+		return "", errors.New("no such card")
+	}
+	return row[index], nil
+}
+
+// DealCard deals a card from the deck onto the table, leaving the spot empty
+// if the deck has run out.
+func (t *duelTurn) DealCard(tier int, index int) {
+	deck := t.state.Decks[tier-1]
+
+	newcard := ""
+	if len(deck) > 0 {
+		newcard = deck[0]
+		t.state.Decks[tier-1] = deck[1:]
+	}
+	t.state.Cards[tier-1][index] = newcard
+
+	t.events = append(t.events, Event{
+		Type:  eventDeal,
+		Card:  newcard,
+		Tier:  tier,
+		Index: index,
+	})
+}
+
+// TakeCells moves the tokens in the given cells from the board to the
+// player.
+func (t *duelTurn) TakeCells(cells []int) {
+	delta := map[string]int{}
+	for _, cell := range cells {
+		color := t.state.Board[cell]
+		t.state.Board[cell] = ""
+		t.player.Coins[color]++
+		delta[color]++
+	}
+	t.events = append(t.events, Event{Type: eventCoins, Player: t.player.ID, Coins: delta})
+}
+
+// ReturnToBag moves the given tokens from the player to the bag, in a
+// consistent order.
+func (t *duelTurn) ReturnToBag(coins map[string]int) {
+	delta := map[string]int{}
+	for _, color := range []string{white, black, green, blue, red, pearl, wild} {
+		for i := 0; i < coins[color]; i++ {
+			t.state.Bag = append(t.state.Bag, color)
+		}
+		if coins[color] > 0 {
+			t.player.Coins[color] -= coins[color]
+			delta[color] = -coins[color]
+		}
+	}
+	if len(delta) > 0 {
+		t.events = append(t.events, Event{Type: eventCoins, Player: t.player.ID, Coins: delta})
+	}
+}
+
+// PayCost pays for a card, using gold for whatever the player's bonuses and
+// tokens don't cover. The tokens go back in the bag.
+func (t *duelTurn) PayCost(bonuses, cost map[string]int) error {
+	paid := map[string]int{}
+	gold := 0
+	for color, count := range cost {
+		coins, wilds := calculateActualCost(bonuses[color], t.player.Coins[color], count)
+		if coins > 0 {
+			paid[color] = coins
+		}
+		gold += wilds
+	}
+
+	if gold > t.player.Coins[wild] {
+		return ErrInsufficientCoins
+	}
+	if gold > 0 {
+		paid[wild] = gold
+	}
+
+	t.ReturnToBag(paid)
+	return nil
+}
+
+// GainPrivilege gives a privilege to the given player, from the table if
+// there are any left and otherwise from the other player.
+func (t *duelTurn) GainPrivilege(p *DuelPlayerState) {
+	other := t.opponent
+	if p == t.opponent {
+		other = t.player
+	}
+
+	switch {
+	case t.state.Privileges > 0:
+		t.state.Privileges--
+	case other.Privileges > 0:
+		other.Privileges--
+	default:
+		return
+	}
+	p.Privileges++
+	t.events = append(t.events, Event{Type: eventPrivilege, Player: p.ID})
+}
+
+func (t *duelTurn) boardHas(color string) bool {
+	return find(color, t.state.Board) != -1
+}
+
+func (t *duelTurn) canSteal() bool {
+	for color, count := range t.opponent.Coins {
+		if color != wild && count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RoyalsOwed returns how many royals the player has earned with their
+// crowns but not yet claimed.
+func (t *duelTurn) RoyalsOwed() int {
+	crowns := t.player.Crowns(t.set)
+	earned := 0
+	for _, n := range royalCrowns {
+		if crowns >= n {
+			earned++
+		}
+	}
+	return earned - len(t.player.Royals)
+}
+
+// AfterAbility moves on once a card's ability has been dealt with, letting
+// the player claim a royal if they've earned one.
+func (t *duelTurn) AfterAbility() {
+	if t.RoyalsOwed() > 0 && len(t.state.Royals) > 0 {
+		t.state.State = pickroyal
+		return
+	}
+
+	t.EndTurn()
+}
+
+// EndTurn moves on at the end of a player's turn, making them give back
+// tokens first if they're holding too many.
+func (t *duelTurn) EndTurn() {
+	if t.player.CountCoins() > maxCoins {
+		t.state.State = losecoin
+		return
+	}
+
+	t.FinishTurn()
+}
+
+// FinishTurn ends the game if the player has won, and otherwise goes on to
+// the next turn, which is theirs again if they've earned another.
+func (t *duelTurn) FinishTurn() {
+	if t.player.Victory(t.set) != duelNoVictory {
+		t.state.State = gameover
+		t.events = append(t.events, Event{Type: eventGameOver})
+		return
+	}
+
+	t.state.State = play
+	if t.state.Again {
+		t.state.Again = false
+		return
+	}
+	t.state.Current = t.opponent.ID
+}
+
+// InLine returns true if the given cells are all on the board and next to
+// each other in a straight line: along a row, a column or a diagonal.
+func inLine(cells []int) bool {
+	sorted := append([]int{}, cells...)
+	sort.Ints(sorted)
+
+	for i, cell := range sorted {
+		if cell < 0 || cell >= boardCells {
+			return false
+		}
+		if i > 0 && cell == sorted[i-1] {
+			return false
+		}
+	}
+	if len(sorted) < 2 {
+		return true
+	}
+
+	row := func(cell int) int { return cell / boardSize }
+	col := func(cell int) int { return cell % boardSize }
+
+	dr, dc := row(sorted[1])-row(sorted[0]), col(sorted[1])-col(sorted[0])
+	if dr > 1 || dc < -1 || dc > 1 || (dr == 0 && dc != 1) {
+		return false
+	}
+	for i := 2; i < len(sorted); i++ {
+		if row(sorted[i])-row(sorted[i-1]) != dr || col(sorted[i])-col(sorted[i-1]) != dc {
+			return false
+		}
+	}
+	return true
+}
+
+// LegalDuelMoves lists every move the given player could legally make right
+// now in a Splendor Duel game. Like LegalMoves, each candidate is checked by
+// applying it. Privileges are listed one token at a time.
+func LegalDuelMoves(state *DuelState, userID string) []DuelMove {
+	p := state.Player(userID)
+	if p == nil || state.Current != userID || state.State == gameover {
+		return []DuelMove{}
+	}
+
+	candidates := []DuelMove{}
+	switch state.State {
+	case play:
+		for _, cells := range lines() {
+			candidates = append(candidates, DuelMove{Type: moveTake, Cells: cells})
+		}
+		for cell := range state.Board {
+			candidates = append(candidates, DuelMove{Type: movePrivilege, Cells: []int{cell}})
+		}
+		candidates = append(candidates, DuelMove{Type: moveRefill})
+
+		for cell, color := range state.Board {
+			if color != wild {
+				continue
+			}
+			for i, row := range state.Cards {
+				for j := range row {
+					candidates = append(candidates, DuelMove{Type: moveReserve, Cells: []int{cell}, Tier: i + 1, Index: j})
+				}
+				candidates = append(candidates, DuelMove{Type: moveReserve, Cells: []int{cell}, Tier: i + 1, Deck: true})
+			}
+		}
+
+		for i, row := range state.Cards {
+			for j := range row {
+				candidates = append(candidates, duelBuyMoves(DuelMove{Type: moveBuy, Tier: i + 1, Index: j})...)
+			}
+		}
+		for j := range p.Reserved {
+			candidates = append(candidates, duelBuyMoves(DuelMove{Type: moveBuy, Tier: 0, Index: j})...)
+		}
+
+	case taketoken:
+		for cell := range state.Board {
+			candidates = append(candidates, DuelMove{Type: moveTakeToken, Cells: []int{cell}})
+		}
+
+	case stealtoken:
+		for _, color := range []string{white, black, green, blue, red, pearl} {
+			candidates = append(candidates, DuelMove{Type: moveSteal, Color: color})
+		}
+
+	case pickroyal:
+		for _, id := range state.Royals {
+			candidates = append(candidates, DuelMove{Type: movePickRoyal, Royal: id})
+		}
+
+	case losecoin:
+		held := []string{}
+		for _, color := range []string{white, black, green, blue, red, pearl, wild} {
+			for i := 0; i < p.Coins[color]; i++ {
+				held = append(held, color)
+			}
+		}
+		seen := map[string]bool{}
+		for _, combo := range combinations(held, p.CountCoins()-maxCoins) {
+			key := strings.Join(combo, ",")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			coins := map[string]int{}
+			for _, color := range combo {
+				coins[color]++
+			}
+			candidates = append(candidates, DuelMove{Type: moveReturnCoins, Coins: coins})
+		}
+	}
+
+	ret := []DuelMove{}
+	for _, move := range candidates {
+		move.Player = userID
+		if _, _, err := ApplyDuel(state, move); err == nil {
+			ret = append(ret, move)
+		}
+	}
+	return ret
+}
+
+// DuelBuyMoves lists the ways of buying the card at the given position,
+// including every color a joker might copy.
+func duelBuyMoves(move DuelMove) []DuelMove {
+	ret := []DuelMove{move}
+	for _, color := range []string{white, black, green, blue, red} {
+		m := move
+		m.Color = color
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+// Lines returns every set of one to three cells that can be taken together.
+func lines() [][]int {
+	ret := [][]int{}
+	for cell := 0; cell < boardCells; cell++ {
+		ret = append(ret, []int{cell})
+		for _, step := range []int{1, boardSize - 1, boardSize, boardSize + 1} {
+			for n := 2; n <= duelMaxTakeTokens; n++ {
+				cells := []int{}
+				for i := 0; i < n; i++ {
+					cells = append(cells, cell+i*step)
+				}
+				if inLine(cells) {
+					ret = append(ret, cells)
+				}
+			}
+		}
+	}
+	return ret
+}
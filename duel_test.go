@@ -0,0 +1,287 @@
+package splenda
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNewDuelState(t *testing.T) {
+	state, err := newDuelState([]string{"user1", "user2"}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for _, color := range state.Board {
+		counts[color]++
+	}
+	if counts[""] != 0 || counts[wild] != goldInGame || counts[pearl] != pearlsInGame || counts[red] != tokensPerColor {
+		t.Errorf("bad board: %v", state.Board)
+	}
+	if len(state.Bag) != 0 {
+		t.Errorf("expected an empty bag, got %v", state.Bag)
+	}
+
+	if state.Privileges != 2 || state.Players[0].Privileges != 0 || state.Players[1].Privileges != 1 {
+		t.Errorf("bad privileges: %v/%v/%v", state.Privileges, state.Players[0].Privileges, state.Players[1].Privileges)
+	}
+	if state.CardSet != duelSets[defaultCardSet].pinnedID() {
+		t.Errorf("expected the game to be pinned to the standard set, got %v", state.CardSet)
+	}
+	if state.Current != state.Players[0].ID {
+		t.Errorf("expected %v to go first, got %v", state.Players[0].ID, state.Current)
+	}
+	for i, n := range duelCardsPerTier {
+		if len(state.Cards[i]) != n {
+			t.Errorf("expected %v cards in tier %v, got %v", n, i+1, state.Cards[i])
+		}
+	}
+}
+
+func TestDuelCardSet(t *testing.T) {
+	state := testDuelState()
+	move := DuelMove{Type: moveTake, Player: "user1", Cells: []int{0, 1, 2}}
+
+	// Games play with the set they're pinned to, and fail rather than
+	// quietly switching to another one if it isn't loaded.
+	state.CardSet = duelSets[defaultCardSet].pinnedID()
+	if _, _, err := ApplyDuel(state, move); err != nil {
+		t.Error(err)
+	}
+	state.CardSet = defaultCardSet + "@bogus"
+	if _, _, err := ApplyDuel(state, move); err == nil {
+		t.Error("expected an error playing with a set that isn't loaded")
+	}
+}
+
+func TestInLine(t *testing.T) {
+	tests := []struct {
+		cells []int
+		ok    bool
+	}{
+		{[]int{7}, true},
+		{[]int{0, 1, 2}, true},
+		{[]int{2, 0, 1}, true},
+		{[]int{0, 5, 10}, true},
+		{[]int{0, 6, 12}, true},
+		{[]int{4, 8, 12}, true},
+		{[]int{0, 2}, false},
+		{[]int{4, 5}, false},
+		{[]int{0, 1, 6}, false},
+		{[]int{3, 3}, false},
+		{[]int{24, 25}, false},
+	}
+	for _, test := range tests {
+		if inLine(test.cells) != test.ok {
+			t.Errorf("inLine(%v): expected %v", test.cells, test.ok)
+		}
+	}
+}
+
+func testDuelState() *DuelState {
+	return &DuelState{
+		State:   play,
+		Current: "user1",
+		Board: []string{
+			white, white, white, pearl, pearl,
+			wild, blue, green, red, black,
+			blue, blue, green, red, black,
+			green, red, black, wild, white,
+			"", "", "", "", "",
+		},
+		Bag:        []string{red, black},
+		Privileges: 2,
+		Cards: [][]string{
+			{"d1_white_0", "d1_white_1", "d1_blue_3", "d1_joker_0", "d1_white_2"},
+			{"d2_white_0", "d2_white_1", "d2_blue_0", "d2_blue_1"},
+			{"d3_white_0", "d3_white_1", "d3_blue_0"},
+		},
+		Decks:   [][]string{{"d1_red_0"}, {"d2_red_0"}, {}},
+		Royals:  duelSets[defaultCardSet].royalIDs(),
+		Players: []*DuelPlayerState{newDuelPlayerState("user1"), newDuelPlayerState("user2")},
+	}
+}
+
+func mustApplyDuel(t *testing.T, state *DuelState, move DuelMove) *DuelState {
+	t.Helper()
+	next, _, err := ApplyDuel(state, move)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return next
+}
+
+func TestDuelTake(t *testing.T) {
+	state := testDuelState()
+	state.Players[1].Privileges = 1
+
+	if _, _, err := ApplyDuel(state, DuelMove{Type: moveTake, Player: "user1", Cells: []int{0, 2}}); err == nil {
+		t.Error("took tokens with a gap between them")
+	}
+	if _, _, err := ApplyDuel(state, DuelMove{Type: moveTake, Player: "user1", Cells: []int{5}}); err == nil {
+		t.Error("took gold without reserving")
+	}
+
+	// Three of a color hands the other player a privilege.
+	next := mustApplyDuel(t, state, DuelMove{Type: moveTake, Player: "user1", Cells: []int{0, 1, 2}})
+	if next.Players[0].Coins[white] != 3 || next.Board[0] != "" {
+		t.Errorf("bad take: %v %v", next.Players[0].Coins, next.Board)
+	}
+	if next.Privileges != 1 || next.Players[1].Privileges != 2 {
+		t.Errorf("expected user2 to get a privilege, got %v/%v", next.Privileges, next.Players[1].Privileges)
+	}
+	if next.Current != "user2" || next.State != play {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+
+	// So do both pearls, and with none left on the table it comes from the
+	// other player.
+	next.Privileges = 0
+	next.Players[0].Privileges = 1
+	next = mustApplyDuel(t, next, DuelMove{Type: moveTake, Player: "user2", Cells: []int{3, 4}})
+	if next.Players[0].Privileges != 2 || next.Players[1].Privileges != 1 {
+		t.Errorf("expected user1 to take user2's privilege, got %v/%v", next.Players[0].Privileges, next.Players[1].Privileges)
+	}
+}
+
+func TestDuelPrivilegeAndRefill(t *testing.T) {
+	state := testDuelState()
+
+	if _, _, err := ApplyDuel(state, DuelMove{Type: movePrivilege, Player: "user1", Cells: []int{9}}); err == nil {
+		t.Error("used a privilege without having one")
+	}
+
+	state.Privileges = 1
+	state.Players[0].Privileges = 1
+	next := mustApplyDuel(t, state, DuelMove{Type: movePrivilege, Player: "user1", Cells: []int{9}})
+	if next.Players[0].Coins[black] != 1 || next.Players[0].Privileges != 0 || next.Privileges != 2 {
+		t.Errorf("bad privilege: %v %v/%v", next.Players[0].Coins, next.Players[0].Privileges, next.Privileges)
+	}
+	if next.Current != "user1" || next.State != play {
+		t.Errorf("using a privilege ended the turn: %v/%v", next.State, next.Current)
+	}
+
+	next = mustApplyDuel(t, next, DuelMove{Type: moveRefill, Player: "user1"})
+	if len(next.Bag) != 0 || next.Board[9] != red {
+		t.Errorf("bad refill: %v %v", next.Bag, next.Board)
+	}
+	if next.Players[1].Privileges != 1 || next.Current != "user1" {
+		t.Errorf("expected user2 to get a privilege, got %v", next.Players[1].Privileges)
+	}
+
+	if _, _, err := ApplyDuel(next, DuelMove{Type: moveRefill, Player: "user1"}); err == nil {
+		t.Error("refilled from an empty bag")
+	}
+}
+
+func TestDuelReserve(t *testing.T) {
+	state := testDuelState()
+
+	if _, _, err := ApplyDuel(state, DuelMove{Type: moveReserve, Player: "user1", Cells: []int{6}, Tier: 3}); err == nil {
+		t.Error("reserved without taking gold")
+	}
+
+	next := mustApplyDuel(t, state, DuelMove{Type: moveReserve, Player: "user1", Cells: []int{5}, Tier: 1, Deck: true})
+	p := next.Players[0]
+	if p.Coins[wild] != 1 || next.Board[5] != "" {
+		t.Errorf("bad gold: %v %v", p.Coins, next.Board)
+	}
+	assertStrings(t, "reserved", p.Reserved, []string{"d1_red_0"})
+	assertStrings(t, "hidden", p.Hidden, []string{"d1_red_0"})
+}
+
+func TestDuelBuyAbilities(t *testing.T) {
+	state := testDuelState()
+	state.Players[0].Coins[green] = 3
+
+	// Another turn.
+	next := mustApplyDuel(t, state, DuelMove{Type: moveBuy, Player: "user1", Tier: 1, Index: 1})
+	if next.Current != "user1" || next.State != play || next.Again {
+		t.Errorf("expected another turn, got %v/%v", next.State, next.Current)
+	}
+	assertStrings(t, "bag", next.Bag, []string{red, black, green, green, green})
+	assertStrings(t, "tier 1", next.Cards[0], []string{"d1_white_0", "d1_red_0", "d1_blue_3", "d1_joker_0", "d1_white_2"})
+
+	// A token of the card's color from the board.
+	next.Players[0].Coins[green] = 2
+	next.Players[0].Coins[pearl] = 1
+	next = mustApplyDuel(t, next, DuelMove{Type: moveBuy, Player: "user1", Tier: 1, Index: 2})
+	if next.State != taketoken {
+		t.Fatalf("expected taketoken, got %v", next.State)
+	}
+	if _, _, err := ApplyDuel(next, DuelMove{Type: moveTakeToken, Player: "user1", Cells: []int{0}}); err == nil {
+		t.Error("took a token of the wrong color")
+	}
+	next = mustApplyDuel(t, next, DuelMove{Type: moveTakeToken, Player: "user1", Cells: []int{6}})
+	if next.Players[0].Coins[blue] != 1 || next.Current != "user2" {
+		t.Errorf("bad token: %v, %v's turn", next.Players[0].Coins, next.Current)
+	}
+
+	// Jokers need a color the player already has.
+	next.Current = "user1"
+	next.Players[0].Coins = map[string]int{white: 2, black: 2, pearl: 1}
+	if _, _, err := ApplyDuel(next, DuelMove{Type: moveBuy, Player: "user1", Tier: 1, Index: 3, Color: red}); err == nil {
+		t.Error("joker copied a color the player doesn't have")
+	}
+	next = mustApplyDuel(t, next, DuelMove{Type: moveBuy, Player: "user1", Tier: 1, Index: 3, Color: blue})
+	if bonuses := next.Players[0].Bonuses(duelSets[defaultCardSet]); bonuses[blue] != 2 {
+		t.Errorf("expected the joker to count as blue, got %v", bonuses)
+	}
+}
+
+func TestDuelRoyalsAndVictory(t *testing.T) {
+	state := testDuelState()
+	p := state.Players[0]
+	p.Cards = []string{"d3_white_0", "d3_white_1", "d2_white_2"}
+	p.Coins[red] = 2
+	p.Coins[black] = 2
+
+	// The third crown earns a royal.
+	next := mustApplyDuel(t, state, DuelMove{Type: moveBuy, Player: "user1", Tier: 1, Index: 4})
+	if next.State != pickroyal {
+		t.Fatalf("expected pickroyal, got %v", next.State)
+	}
+	if _, _, err := ApplyDuel(next, DuelMove{Type: movePickRoyal, Player: "user1", Royal: "bogus"}); err == nil {
+		t.Error("picked a bogus royal")
+	}
+
+	// And ten points of white wins the game.
+	next = mustApplyDuel(t, next, DuelMove{Type: movePickRoyal, Player: "user1", Royal: "royal_points"})
+	if next.State != gameover {
+		t.Fatalf("expected gameover, got %v", next.State)
+	}
+	assertStrings(t, "royals", next.Royals, []string{"royal_again", "royal_privilege", "royal_steal"})
+	if winner, how := next.Winner(duelSets[defaultCardSet]); winner != "user1" || how != duelWinColor {
+		t.Errorf("expected user1 to win on color, got %v/%v", winner, how)
+	}
+}
+
+func TestDuelResign(t *testing.T) {
+	next := mustApplyDuel(t, testDuelState(), DuelMove{Type: moveResign, Player: "user2"})
+	if next.State != gameover {
+		t.Fatalf("expected gameover, got %v", next.State)
+	}
+	if winner, how := next.Winner(duelSets[defaultCardSet]); winner != "user1" || how != duelWinResigned {
+		t.Errorf("expected user1 to win by resignation, got %v/%v", winner, how)
+	}
+}
+
+func TestLegalDuelMoves(t *testing.T) {
+	state := testDuelState()
+
+	if moves := LegalDuelMoves(state, "user2"); len(moves) != 0 {
+		t.Errorf("expected no moves out of turn, got %v", moves)
+	}
+
+	counts := map[string]int{}
+	for _, move := range LegalDuelMoves(state, "user1") {
+		counts[move.Type]++
+	}
+	if counts[movePrivilege] != 0 || counts[moveBuy] != 0 {
+		t.Errorf("expected no privileges or buys, got %v", counts)
+	}
+	// One gold per reserve, on any of the 12 cards or 3 decks (one is empty).
+	if counts[moveReserve] != 2*14 || counts[moveRefill] != 1 || counts[moveTake] == 0 {
+		t.Errorf("bad moves: %v", counts)
+	}
+}
@@ -0,0 +1,302 @@
+package splenda
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Splendor Duel adds pearls to the usual colors. Gold tokens are wilds, as
+// in the original game.
+const pearl = "pearl"
+
+func isDuelColor(color string) bool {
+	return isNormalColor(color) || color == pearl
+}
+
+// Card abilities, from Splendor Duel. Jokers work the same way as in the
+// Orient expansion.
+const (
+	abilityAgain     = "again"     // Take another turn.
+	abilityToken     = "token"     // Take a token of the card's color from the board.
+	abilityPrivilege = "privilege" // Take a privilege.
+	abilitySteal     = "steal"     // Take a token from the other player.
+)
+
+// The number of cards face up in each tier, from tier 1 up.
+var duelCardsPerTier = []int{5, 4, 3}
+
+type duelCard struct {
+	id      string
+	tier    int
+	color   string
+	points  int
+	crowns  int
+	cost    cost
+	ability string
+}
+
+// A royal is claimed by reaching enough crowns, and may have an ability of
+// its own.
+type royal struct {
+	id      string
+	points  int
+	ability string
+}
+
+// A duelSet is the complete set of cards and royals to play Splendor Duel
+// with.
+type duelSet struct {
+	id      string
+	version string
+	tiers   []map[string]duelCard
+	royals  map[string]royal
+}
+
+// The duel sets that have been loaded, by ID for the current version of each
+// and by pinned ID for every version, old ones included.
+var duelSets = map[string]*duelSet{}
+
+// GetDuelSet looks up a duel set by ID or pinned ID. Games from before duel
+// sets were pinned don't record one, and get the standard set.
+func getDuelSet(id string) (*duelSet, error) {
+	if id == "" {
+		id = defaultCardSet
+	}
+	set, ok := duelSets[id]
+	if !ok {
+		return nil, fmt.Errorf("no such Splendor Duel card set: %v", id)
+	}
+	return set, nil
+}
+
+// PinnedID is the set's ID with its version attached, which games store so
+// they keep playing with the same cards even after the set is edited.
+func (s *duelSet) pinnedID() string {
+	return s.id + "@" + s.version
+}
+
+func (s *duelSet) card(id string) (duelCard, bool) {
+	for _, tier := range s.tiers {
+		if c, ok := tier[id]; ok {
+			return c, true
+		}
+	}
+	return duelCard{}, false
+}
+
+func (s *duelSet) royal(id string) (royal, bool) {
+	r, ok := s.royals[id]
+	return r, ok
+}
+
+func (s *duelSet) shuffleCards(tier int, rng rng) []string {
+	deck := []string{}
+	for id := range s.tiers[tier-1] {
+		deck = append(deck, id)
+	}
+	sort.Strings(deck) // To make things deterministic for tests.
+
+	return pick(deck, len(deck), rng)
+}
+
+func (s *duelSet) royalIDs() []string {
+	ids := []string{}
+	for id := range s.royals {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// LoadDuelSets loads every Splendor Duel card set in the given directory,
+// along with the older versions in its archive directory, the same way
+// LoadCardSets does. It fails if any of them aren't valid, or if there's no
+// standard set.
+func LoadDuelSets(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	archived, err := filepath.Glob(filepath.Join(dir, "archive", "*.json"))
+	if err != nil {
+		return err
+	}
+
+	sets := map[string]*duelSet{}
+	for _, file := range files {
+		set, err := loadDuelSet(file)
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		if sets[set.id] != nil {
+			return fmt.Errorf("%v: duplicate card set id: %v", file, set.id)
+		}
+		sets[set.id] = set
+		sets[set.pinnedID()] = set
+	}
+
+	for _, file := range archived {
+		set, err := loadDuelSet(file)
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		if sets[set.pinnedID()] != nil {
+			return fmt.Errorf("%v: duplicate card set version: %v", file, set.pinnedID())
+		}
+		sets[set.pinnedID()] = set
+	}
+
+	if sets[defaultCardSet] == nil {
+		return fmt.Errorf("no %v card set in %v", defaultCardSet, dir)
+	}
+
+	duelSets = sets
+	return nil
+}
+
+func loadDuelSet(file string) (*duelSet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	dsf := duelSetFile{}
+	if err := dec.Decode(&dsf); err != nil {
+		return nil, err
+	}
+
+	return newDuelSet(&dsf)
+}
+
+// DuelSetFile is the format the Splendor Duel cards are stored in.
+type duelSetFile struct {
+	ID      string         `json:"id"`
+	Version string         `json:"version"`
+	Cards   []duelSetCard  `json:"cards"`
+	Royals  []duelSetRoyal `json:"royals"`
+}
+
+type duelSetCard struct {
+	ID      string `json:"id"`
+	Tier    int    `json:"tier"`
+	Color   string `json:"color"`
+	Points  int    `json:"points"`
+	Crowns  int    `json:"crowns"`
+	Cost    cost   `json:"cost"`
+	Ability string `json:"ability"`
+}
+
+type duelSetRoyal struct {
+	ID      string `json:"id"`
+	Points  int    `json:"points"`
+	Ability string `json:"ability"`
+}
+
+// NewDuelSet builds a duel set from its file format, checking that it's
+// something that can actually be played with.
+func newDuelSet(f *duelSetFile) (*duelSet, error) {
+	if f.ID == "" {
+		return nil, errors.New("card set has no id")
+	}
+	if f.Version == "" {
+		return nil, errors.New("card set has no version")
+	}
+
+	set := &duelSet{id: f.ID, version: f.Version, royals: map[string]royal{}}
+	for range duelCardsPerTier {
+		set.tiers = append(set.tiers, map[string]duelCard{})
+	}
+
+	for _, c := range f.Cards {
+		if c.ID == "" {
+			return nil, errors.New("card has no id")
+		}
+		if _, ok := set.card(c.ID); ok {
+			return nil, fmt.Errorf("duplicate card id: %v", c.ID)
+		}
+		if c.Tier < 1 || c.Tier > len(set.tiers) {
+			return nil, fmt.Errorf("card %v: bad tier %v", c.ID, c.Tier)
+		}
+		switch c.Ability {
+		case "", abilityAgain, abilityToken, abilityPrivilege, abilitySteal:
+			if !isNormalColor(c.Color) {
+				return nil, fmt.Errorf("card %v: bad color %v", c.ID, c.Color)
+			}
+		case abilityJoker:
+			if c.Color != "" {
+				return nil, fmt.Errorf("card %v: jokers don't have a color", c.ID)
+			}
+		default:
+			return nil, fmt.Errorf("card %v: bad ability %v", c.ID, c.Ability)
+		}
+		if c.Points < 0 || c.Crowns < 0 {
+			return nil, fmt.Errorf("card %v: negative points or crowns", c.ID)
+		}
+		if err := validateDuelCost(c.Cost); err != nil {
+			return nil, fmt.Errorf("card %v: %v", c.ID, err)
+		}
+
+		set.tiers[c.Tier-1][c.ID] = duelCard{
+			id:      c.ID,
+			tier:    c.Tier,
+			color:   c.Color,
+			points:  c.Points,
+			crowns:  c.Crowns,
+			cost:    c.Cost,
+			ability: c.Ability,
+		}
+	}
+
+	for _, r := range f.Royals {
+		if r.ID == "" {
+			return nil, errors.New("royal has no id")
+		}
+		if _, ok := set.royals[r.ID]; ok {
+			return nil, fmt.Errorf("duplicate royal id: %v", r.ID)
+		}
+		if r.Points < 0 {
+			return nil, fmt.Errorf("royal %v: negative points", r.ID)
+		}
+		switch r.Ability {
+		case "", abilityAgain, abilityPrivilege, abilitySteal:
+		default:
+			return nil, fmt.Errorf("royal %v: bad ability %v", r.ID, r.Ability)
+		}
+		set.royals[r.ID] = royal{id: r.ID, points: r.Points, ability: r.Ability}
+	}
+
+	// Make sure there's enough of everything to deal out a full table.
+	for i, tier := range set.tiers {
+		if len(tier) < duelCardsPerTier[i] {
+			return nil, fmt.Errorf("tier %v needs at least %v cards", i+1, duelCardsPerTier[i])
+		}
+	}
+	if len(set.royals) < len(royalCrowns)*numDuelPlayers {
+		return nil, fmt.Errorf("need at least %v royals", len(royalCrowns)*numDuelPlayers)
+	}
+
+	return set, nil
+}
+
+func validateDuelCost(c cost) error {
+	if len(c) == 0 {
+		return errors.New("no cost")
+	}
+	for color, count := range c {
+		if !isDuelColor(color) {
+			return fmt.Errorf("bad cost color %v", color)
+		}
+		if count <= 0 {
+			return fmt.Errorf("bad cost for %v", color)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1427 @@
+package splenda
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Move types.
+const (
+	moveTake3       = "take3"
+	moveTake2       = "take2"
+	moveReserve     = "reserve"
+	moveBuy         = "buy"
+	movePickNoble   = "picknoble"
+	moveReturnCoins = "returncoins"
+	movePass        = "pass"
+	moveResign      = "resign"
+	moveTimeout     = "timeout"
+)
+
+// Event types.
+const (
+	eventCoins    = "coins"
+	eventReserve  = "reserve"
+	eventBuy      = "buy"
+	eventDeal     = "deal"
+	eventNoble    = "noble"
+	eventResign   = "resign"
+	eventCity     = "city"
+	eventPost     = "post"
+	eventGameOver = "gameover"
+)
+
+// GameState is the complete state of a game, independent of how (or whether)
+// it is stored.
+type GameState struct {
+	TS      int            `json:"ts"`
+	State   string         `json:"state"`
+	Current string         `json:"current"`
+	Coins   map[string]int `json:"coins"`
+	Nobles  []string       `json:"nobles"`
+	Cities  []string       `json:"cities,omitempty"`
+	Cards   [][]string     `json:"cards"`
+	Decks   [][]string     `json:"decks"`
+	Players []*PlayerState `json:"players"`
+	Options Options        `json:"options"`
+
+	// The side row of Orient cards for each tier, in Orient mode.
+	Orient      [][]string `json:"orient,omitempty"`
+	OrientDecks [][]string `json:"orientdecks,omitempty"`
+}
+
+// PlayerState is the state of a single player's hand. Hidden lists the
+// reserved cards that were reserved blind off the top of a deck. Players who
+// have resigned stay in the game for the final standings, but their seat is
+// skipped. In cities mode, City is the city the player has qualified for, and
+// in trading posts mode, Posts lists the trading posts they've unlocked.
+// Jokers records which color each joker card they've bought is copying.
+type PlayerState struct {
+	ID       string            `json:"id"`
+	Coins    map[string]int    `json:"coins"`
+	Nobles   []string          `json:"nobles"`
+	Cards    []string          `json:"cards"`
+	Reserved []string          `json:"reserved"`
+	Hidden   []string          `json:"hidden"`
+	Resigned bool              `json:"resigned,omitempty"`
+	City     string            `json:"city,omitempty"`
+	Posts    []string          `json:"posts,omitempty"`
+	Jokers   map[string]string `json:"jokers,omitempty"`
+}
+
+// A Move is a single action taken by a player. Which of the fields are used
+// depends on the type of move; Coins holds the coins being given back for
+// returncoins, or an explicit payment for buy. A take2 may list a second
+// color to take an extra coin of, for players with the trading post for it,
+// and a buy of a joker card lists the color it copies. Orient picks the side
+// row of Orient cards instead of the usual one.
+type Move struct {
+	Type   string         `json:"type"`
+	Player string         `json:"player"`
+	Colors []string       `json:"colors,omitempty"`
+	Coins  map[string]int `json:"coins,omitempty"`
+	Tier   int            `json:"tier,omitempty"`
+	Index  int            `json:"index,omitempty"`
+	Deck   bool           `json:"deck,omitempty"`
+	Orient bool           `json:"orient,omitempty"`
+	Noble  string         `json:"noble,omitempty"`
+}
+
+// An Event is something that happened as a result of a move. Coins are from
+// the player's point of view: positive counts were taken from the bank, and
+// negative counts were given back to it.
+type Event struct {
+	Type   string         `json:"type"`
+	Player string         `json:"player,omitempty"`
+	Coins  map[string]int `json:"coins,omitempty"`
+	Card   string         `json:"card,omitempty"`
+	Tier   int            `json:"tier,omitempty"`
+	Index  int            `json:"index,omitempty"`
+	Orient bool           `json:"orient,omitempty"`
+	Noble  string         `json:"noble,omitempty"`
+	City   string         `json:"city,omitempty"`
+	Post   string         `json:"post,omitempty"`
+}
+
+// NumCoins returns how many coins of each color go in the bank. Five and six
+// player games aren't in the rules, so they use a popular house rule.
+func numCoins(players int) int {
+	switch players {
+	case 2:
+		return 4
+	case 3:
+		return 5
+	case 4:
+		return 7
+	case 5:
+		return 8
+	case 6:
+		return 9
+	default:
+		panic("weird number of players")
+	}
+}
+
+// NewGameState deals out the initial state of a game between the given
+// players, seated in a random order unless the options say otherwise.
+func newGameState(players []string, opts Options, rng rng) (*GameState, error) {
+	opts = opts.withDefaults(len(players))
+	set, err := getCardSet(opts.CardSet)
+	if err != nil {
+		return nil, err
+	}
+	opts.CardSet = set.pinnedID()
+
+	if !opts.FixedSeats {
+		players = shuffle(players, rng)
+	}
+
+	nc := opts.Coins
+	s := &GameState{
+		State:   play,
+		Current: players[0],
+		Coins: map[string]int{
+			red:   nc,
+			blue:  nc,
+			green: nc,
+			black: nc,
+			white: nc,
+			wild:  opts.Gold,
+		},
+		Options: opts,
+	}
+
+	// Cities take the place of the nobles.
+	if opts.Mode == modeCities {
+		s.Nobles = []string{}
+		s.Cities = set.pickCities(numCities, rng)
+	} else {
+		s.Nobles = set.pickNobles(opts.Nobles, rng)
+	}
+
+	for tier := 1; tier <= numTiers; tier++ {
+		deck := set.shuffleCards(tier, rng)
+		s.Cards = append(s.Cards, deck[:opts.CardsPerTier])
+		s.Decks = append(s.Decks, deck[opts.CardsPerTier:])
+	}
+
+	if opts.Mode == modeOrient {
+		for tier := 1; tier <= numTiers; tier++ {
+			deck := set.shuffleOrient(tier, rng)
+			s.Orient = append(s.Orient, deck[:orientCardsPerTier])
+			s.OrientDecks = append(s.OrientDecks, deck[orientCardsPerTier:])
+		}
+	}
+
+	for _, id := range players {
+		s.Players = append(s.Players, newPlayerState(id))
+	}
+
+	return s, nil
+}
+
+// NewPlayerState returns the state of a player's empty hand.
+func newPlayerState(userID string) *PlayerState {
+	coins := map[string]int{}
+	for _, color := range []string{red, blue, green, black, white, wild} {
+		coins[color] = 0
+	}
+
+	return &PlayerState{
+		ID:       userID,
+		Coins:    coins,
+		Nobles:   []string{},
+		Cards:    []string{},
+		Reserved: []string{},
+		Hidden:   []string{},
+	}
+}
+
+// Player returns the state of the given player, or nil if they're not
+// playing in this game.
+func (s *GameState) Player(userID string) *PlayerState {
+	for _, p := range s.Players {
+		if p.ID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+// NextSeat returns the ID of the player seated after the given one, skipping
+// anyone who has resigned.
+func (s *GameState) NextSeat(userID string) string {
+	for i, p := range s.Players {
+		if p.ID == userID {
+			return s.Players[s.nextIndex(i)].ID
+		}
+	}
+	return ""
+}
+
+// NextIndex returns the index of the first player after the given index who
+// is still playing.
+func (s *GameState) nextIndex(index int) int {
+	for i := 1; i < len(s.Players); i++ {
+		next := (index + i) % len(s.Players)
+		if !s.Players[next].Resigned {
+			return next
+		}
+	}
+	return index
+}
+
+// Active returns the players who haven't resigned.
+func (s *GameState) Active() []*PlayerState {
+	ret := []*PlayerState{}
+	for _, p := range s.Players {
+		if !p.Resigned {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// Clone returns a deep copy of the state.
+func (s *GameState) Clone() *GameState {
+	c := *s
+	c.Coins = copyCoins(s.Coins)
+	c.Nobles = copyStrings(s.Nobles)
+	c.Cities = copyStrings(s.Cities)
+	c.Cards = copyRows(s.Cards)
+	c.Decks = copyRows(s.Decks)
+	if s.Orient != nil {
+		c.Orient = copyRows(s.Orient)
+		c.OrientDecks = copyRows(s.OrientDecks)
+	}
+
+	c.Players = []*PlayerState{}
+	for _, p := range s.Players {
+		c.Players = append(c.Players, &PlayerState{
+			ID:       p.ID,
+			Coins:    copyCoins(p.Coins),
+			Nobles:   copyStrings(p.Nobles),
+			Cards:    copyStrings(p.Cards),
+			Reserved: copyStrings(p.Reserved),
+			Hidden:   copyStrings(p.Hidden),
+			Resigned: p.Resigned,
+			City:     p.City,
+			Posts:    copyStrings(p.Posts),
+			Jokers:   copyJokers(p.Jokers),
+		})
+	}
+
+	return &c
+}
+
+func copyCoins(coins map[string]int) map[string]int {
+	ret := map[string]int{}
+	for color, count := range coins {
+		ret[color] = count
+	}
+	return ret
+}
+
+func copyJokers(jokers map[string]string) map[string]string {
+	if jokers == nil {
+		return nil
+	}
+	ret := map[string]string{}
+	for id, color := range jokers {
+		ret[id] = color
+	}
+	return ret
+}
+
+func copyStrings(strs []string) []string {
+	return append([]string{}, strs...)
+}
+
+func copyRows(rows [][]string) [][]string {
+	ret := [][]string{}
+	for _, row := range rows {
+		ret = append(ret, copyStrings(row))
+	}
+	return ret
+}
+
+// Points calculates the current score for a player.
+func (p *PlayerState) Points(set *cardSet) int {
+	points := postPoints(p.Posts)
+	for _, id := range p.Nobles {
+		if noble, ok := set.noble(id); ok {
+			points += noble.points
+		}
+	}
+	for _, id := range p.Cards {
+		if card, ok := set.card(id); ok {
+			points += card.points
+		}
+	}
+	return points
+}
+
+// CardCounts returns the bonus of each color the player has from the cards
+// they've bought. That's usually one per card, but double-bonus cards count
+// twice and jokers count as whichever color they're copying.
+func (p *PlayerState) CardCounts(set *cardSet) map[string]int {
+	ret := map[string]int{}
+	for _, id := range p.Cards {
+		card, ok := set.card(id)
+		if !ok {
+			continue
+		}
+		switch card.ability {
+		case abilityDouble:
+			ret[card.color] += 2
+		case abilityJoker:
+			ret[p.Jokers[id]]++
+		default:
+			ret[card.color]++
+		}
+	}
+	return ret
+}
+
+// CountCoins returns the total number of coins the player is holding.
+func (p *PlayerState) CountCoins() int {
+	total := 0
+	for _, count := range p.Coins {
+		total += count
+	}
+	return total
+}
+
+// Apply applies a move to the given state, returning the resulting state and
+// the events that happened along the way. The given state is not modified.
+func Apply(state *GameState, move Move) (*GameState, []Event, error) {
+	if state.State == gameover {
+		return nil, nil, errors.New("game is over")
+	}
+
+	index := -1
+	for i, p := range state.Players {
+		if p.ID == move.Player {
+			index = i
+		}
+	}
+	if index == -1 {
+		return nil, nil, errors.New("no such player")
+	}
+	if state.Players[index].Resigned {
+		return nil, nil, errors.New("you have resigned")
+	}
+	// Players can resign whenever they like; everything else waits for their turn.
+	if move.Player != state.Current && move.Type != moveResign {
+		return nil, nil, errors.New("not your turn")
+	}
+
+	set, err := getCardSet(state.Options.CardSet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &turn{state: state.Clone(), set: set, index: index}
+	t.player = t.state.Players[index]
+
+	switch move.Type {
+	case moveTake3:
+		err = t.Take3(move.Colors)
+	case moveTake2:
+		if len(move.Colors) != 1 && len(move.Colors) != 2 {
+			return nil, nil, errors.New("must specify one color")
+		}
+		extra := ""
+		if len(move.Colors) == 2 {
+			extra = move.Colors[1]
+		}
+		err = t.Take2(move.Colors[0], extra)
+	case moveReserve:
+		if move.Deck {
+			err = t.ReserveTop(move.Tier, move.Orient)
+		} else {
+			err = t.Reserve(move.Tier, move.Index, move.Orient)
+		}
+	case moveBuy:
+		joker := ""
+		if len(move.Colors) > 0 {
+			joker = move.Colors[0]
+		}
+		err = t.Buy(move.Tier, move.Index, move.Orient, move.Coins, joker)
+	case movePickNoble:
+		err = t.PickNoble(move.Noble)
+	case moveReturnCoins:
+		err = t.ReturnCoins(move.Coins)
+	case movePass:
+		err = t.Pass()
+	case moveResign:
+		err = t.Resign()
+	case moveTimeout:
+		err = t.Timeout()
+	default:
+		err = fmt.Errorf("unknown move: %v", move.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.state.TS++
+	return t.state, t.events, nil
+}
+
+// A turn holds the working state while applying a single move.
+type turn struct {
+	state  *GameState
+	set    *cardSet
+	player *PlayerState
+	index  int
+	events []Event
+}
+
+func (t *turn) expect(states ...string) error {
+	if find(t.state.State, states) == -1 {
+		return errors.New("can't do that right now")
+	}
+	return nil
+}
+
+// Take3 takes three coins of different colors.
+func (t *turn) Take3(colors []string) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+	if len(colors) == 0 || len(colors) > 3 {
+		return errors.New("must specify three colors")
+	}
+	for _, c := range colors {
+		if !isNormalColor(c) {
+			return errors.New("invalid coin color")
+		}
+	}
+	if !unique(colors) {
+		return errors.New("colors must be unique")
+	}
+
+	delta := map[string]int{}
+	for _, c := range colors {
+		delta[c] = 1
+	}
+
+	if err := t.EarnCoins(delta, delta); err != nil {
+		return err
+	}
+
+	t.AfterEarn()
+	return nil
+}
+
+// Take2 takes two coins of the same color, plus one coin of the extra color
+// if one is given and the player has the trading post that allows it.
+func (t *turn) Take2(color string, extra string) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+	if !isNormalColor(color) {
+		return errors.New("invalid coin color")
+	}
+
+	limit := map[string]int{color: 4}
+	delta := map[string]int{color: 2}
+
+	if extra != "" {
+		if !t.player.HasPost(postExtraCoin) {
+			return errors.New("can't take an extra coin")
+		}
+		if !isNormalColor(extra) || extra == color {
+			return errors.New("extra coin must be a different color")
+		}
+		limit[extra] = 1
+		delta[extra] = 1
+	}
+
+	if err := t.EarnCoins(limit, delta); err != nil {
+		return err
+	}
+
+	t.AfterEarn()
+	return nil
+}
+
+// Reserve reserves a face-up card. It's also how a player takes the free
+// reserve they get for buying a card with the reserve ability.
+func (t *turn) Reserve(tier int, index int, orient bool) error {
+	if err := t.expect(play, reservecard); err != nil {
+		return err
+	}
+	if tier == 0 {
+		return errors.New("card is already reserved")
+	}
+
+	// Grab the ID of the card that's currently in that position.
+	card, err := t.GetCardID(tier, index, orient)
+	if err != nil {
+		return err
+	}
+
+	if err := t.reserve(card, tier, index, orient, false); err != nil {
+		return err
+	}
+
+	// Replace it on the board.
+	t.DealCard(tier, index, orient)
+
+	return t.AfterReserve()
+}
+
+// ReserveTop reserves the top card of one of the decks, without revealing it
+// to the other players.
+func (t *turn) ReserveTop(tier int, orient bool) error {
+	if err := t.expect(play, reservecard); err != nil {
+		return err
+	}
+
+	decks := t.state.Decks
+	if orient {
+		decks = t.state.OrientDecks
+	}
+	if tier < 1 || tier > len(decks) {
+		return errors.New("no such deck")
+	}
+
+	deck := decks[tier-1]
+	if len(deck) == 0 {
+		return errors.New("no cards left in that deck")
+	}
+
+	// Take it off the deck.
+	card := deck[0]
+	decks[tier-1] = deck[1:]
+
+	if err := t.reserve(card, tier, -1, orient, true); err != nil {
+		return err
+	}
+
+	return t.AfterReserve()
+}
+
+// Reserve moves a card into the player's hand as a reserved card, giving them
+// a wildcard coin if there are any left. Free reserves don't come with a coin.
+func (t *turn) reserve(card string, tier int, index int, orient bool, hidden bool) error {
+	// Make sure the player does not already have too many reserved cards.
+	if len(t.player.Reserved) >= t.state.Options.ReserveSlots {
+		return errors.New("too many cards already reserved")
+	}
+
+	t.player.Reserved = append(t.player.Reserved, card)
+	if hidden {
+		t.player.Hidden = append(t.player.Hidden, card)
+	}
+	t.events = append(t.events, Event{
+		Type:   eventReserve,
+		Player: t.player.ID,
+		Card:   card,
+		Tier:   tier,
+		Index:  index,
+		Orient: orient,
+	})
+
+	if t.state.State == reservecard {
+		return nil
+	}
+
+	// Give the player a wildcard coin if we can.
+	delta := map[string]int{wild: 1}
+	err := t.EarnCoins(delta, delta)
+	if err != nil && err != ErrInsufficientCoins {
+		return err
+	}
+
+	return nil
+}
+
+// Buy buys a card, either from the table or from the player's reserved cards.
+// If payment is nil the cheapest payment is worked out automatically. Joker
+// cards need the color of one of the player's bonuses to copy.
+func (t *turn) Buy(tier int, index int, orient bool, payment map[string]int, joker string) error {
+	if err := t.expect(play); err != nil {
+		return err
+	}
+
+	// Grab the card that's currently in that position.
+	cardID, err := t.GetCardID(tier, index, orient)
+	if err != nil {
+		return err
+	}
+	card, ok := t.set.card(cardID)
+	if !ok {
+		return errors.New("bogus card ID")
+	}
+
+	// Work out what color the card counts as.
+	cards := t.player.CardCounts(t.set)
+	color := card.color
+	if card.ability == abilityJoker {
+		if !isNormalColor(joker) || cards[joker] == 0 {
+			return errors.New("joker must copy the color of one of your cards")
+		}
+		color = joker
+	} else if joker != "" {
+		return errors.New("only jokers copy a color")
+	}
+
+	// Pay the cost of the card.
+	if payment != nil {
+		err = t.PayExactly(cards, card.cost, payment)
+	} else {
+		err = t.PayCost(cards, card.cost)
+	}
+	if err != nil {
+		return err
+	}
+
+	if tier > 0 {
+		// Replace it on the board.
+		t.DealCard(tier, index, orient)
+	} else {
+		// Take it out of the player's reserved cards.
+		r := t.player.Reserved
+		t.player.Reserved = append(r[:index], r[index+1:]...)
+		if i := find(cardID, t.player.Hidden); i != -1 {
+			h := t.player.Hidden
+			t.player.Hidden = append(h[:i], h[i+1:]...)
+		}
+	}
+
+	t.player.Cards = append(t.player.Cards, cardID)
+	if card.ability == abilityJoker {
+		if t.player.Jokers == nil {
+			t.player.Jokers = map[string]string{}
+		}
+		t.player.Jokers[cardID] = joker
+	}
+	t.events = append(t.events, Event{
+		Type:   eventBuy,
+		Player: t.player.ID,
+		Card:   cardID,
+		Tier:   tier,
+		Index:  index,
+		Orient: orient,
+	})
+
+	// Players with the trading post for it get a coin to match the card, if
+	// there's one left and they have room for it.
+	if t.player.HasPost(postBuyCoin) && t.player.CountCoins() < maxCoins {
+		delta := map[string]int{color: 1}
+		err := t.EarnCoins(delta, delta)
+		if err != nil && err != ErrInsufficientCoins {
+			return err
+		}
+	}
+
+	return t.AfterAbility(card)
+}
+
+// PickNoble claims one of the nobles the player can afford, or any noble at
+// all if they've just bought a card that claims one.
+func (t *turn) PickNoble(nobleID string) error {
+	if err := t.expect(picknoble, claimnoble); err != nil {
+		return err
+	}
+
+	if t.state.State == claimnoble {
+		if find(nobleID, t.state.Nobles) == -1 {
+			return errors.New("can't pick that noble")
+		}
+		t.TransferNoble(nobleID)
+
+		// They might still qualify for a visit from another noble.
+		return t.AfterBuy(t.player.CardCounts(t.set))
+	}
+
+	// Make sure it's one of the nobles they're allowed to pick.
+	nobles, err := t.AffordableNobles(t.player.CardCounts(t.set))
+	if err != nil {
+		return err
+	}
+	if find(nobleID, nobles) == -1 {
+		return errors.New("can't pick that noble")
+	}
+
+	t.TransferNoble(nobleID)
+
+	t.EndTurn()
+	return nil
+}
+
+// ReturnCoins returns coins to the bank when the player is holding too many.
+func (t *turn) ReturnCoins(coins map[string]int) error {
+	if err := t.expect(losecoin); err != nil {
+		return err
+	}
+
+	// Make sure they're giving back exactly enough to get down to the limit.
+	total := t.player.CountCoins()
+	for color, count := range coins {
+		if !isNormalColor(color) && color != wild {
+			return errors.New("invalid coin color")
+		}
+		if count <= 0 {
+			return errors.New("must return a positive number of coins")
+		}
+		total -= count
+	}
+	if total != maxCoins {
+		return fmt.Errorf("must return coins until you have exactly %v", maxCoins)
+	}
+
+	for color, count := range coins {
+		if t.player.Coins[color] < count {
+			return ErrInsufficientCoins
+		}
+	}
+
+	delta := map[string]int{}
+	for color, count := range coins {
+		t.state.Coins[color] += count
+		t.player.Coins[color] -= count
+		delta[color] = -count
+	}
+	t.coinsEvent(delta)
+
+	t.EndTurn()
+	return nil
+}
+
+// Pass passes the turn to the next player, which is only allowed when the
+// player can't do anything else. A player who has earned a free reserve may
+// always pass it up.
+func (t *turn) Pass() error {
+	if err := t.expect(play, reservecard); err != nil {
+		return err
+	}
+	if t.state.State == reservecard {
+		return t.AfterBuy(t.player.CardCounts(t.set))
+	}
+
+	moves := LegalMoves(t.state, t.player.ID)
+	if len(moves) != 1 || moves[0].Type != movePass {
+		return errors.New("can't pass when you have a legal move")
+	}
+
+	t.EndTurn()
+	return nil
+}
+
+// Timeout ends the turn of a player who has run out of time. Anything they
+// were in the middle of is finished off as simply as possible: they get the
+// first noble they qualify for, or give back coins until they're at the limit,
+// and pass up any free reserve.
+func (t *turn) Timeout() error {
+	switch t.state.State {
+	case picknoble:
+		nobles, err := t.AffordableNobles(t.player.CardCounts(t.set))
+		if err != nil {
+			return err
+		}
+		return t.PickNoble(nobles[0])
+
+	case claimnoble:
+		return t.PickNoble(t.state.Nobles[0])
+
+	case reservecard:
+		return t.Pass()
+
+	case losecoin:
+		excess := t.player.CountCoins() - maxCoins
+		coins := map[string]int{}
+		for _, color := range []string{white, black, green, blue, red, wild} {
+			n := t.player.Coins[color]
+			if n > excess {
+				n = excess
+			}
+			if n > 0 {
+				coins[color] = n
+				excess -= n
+			}
+		}
+		return t.ReturnCoins(coins)
+	}
+
+	t.EndTurn()
+	return nil
+}
+
+// Resign drops the player out of the game. Their coins go back to the bank
+// and their seat is skipped from now on; if only one player is left, the game
+// is over.
+func (t *turn) Resign() error {
+	returned := map[string]int{}
+	for color, count := range t.player.Coins {
+		if count > 0 {
+			t.state.Coins[color] += count
+			returned[color] = -count
+		}
+		t.player.Coins[color] = 0
+	}
+	t.coinsEvent(returned)
+
+	t.player.Resigned = true
+	t.events = append(t.events, Event{Type: eventResign, Player: t.player.ID})
+
+	if len(t.state.Active()) <= 1 {
+		t.state.State = gameover
+		t.events = append(t.events, Event{Type: eventGameOver})
+		return nil
+	}
+
+	// Someone who's resigned doesn't get anything more at the end of their
+	// turn, so skip straight past it.
+	if t.state.Current == t.player.ID {
+		t.NextTurn()
+	}
+	return nil
+}
+
+//
+// Shared rules.
+//
+
+// GetCardID gets the ID of the card at a given position. Tier zero refers to
+// the player's reserved cards, and orient to the side row of Orient cards.
+func (t *turn) GetCardID(tier int, index int, orient bool) (string, error) {
+	row := t.player.Reserved
+	if tier != 0 {
+		rows := t.state.Cards
+		if orient {
+			rows = t.state.Orient
+		}
+		if tier < 0 || tier > len(rows) {
+			return "", errors.New("no such tier")
+		}
+		row = rows[tier-1]
+	} else if orient {
+		return "", errors.New("no such tier")
+	}
+
+	if index < 0 || index >= len(row) || row[index] == "" {
+		return "", errors.New("no card there")
+	}
+	return row[index], nil
+}
+
+// EarnCoins transfers coins from the bank to the player if possible.
+func (t *turn) EarnCoins(limits, coins map[string]int) error {
+	for color, limit := range limits {
+		if t.state.Coins[color] < limit {
+			return ErrInsufficientCoins
+		}
+	}
+
+	for color, count := range coins {
+		t.state.Coins[color] -= count
+		t.player.Coins[color] += count
+	}
+	t.coinsEvent(coins)
+
+	return nil
+}
+
+// PayCost attempts to pay the cost for a given card.
+func (t *turn) PayCost(cards, cost map[string]int) error {
+	purse := t.player.Coins
+
+	delta := map[string]int{}
+	wildsneeded := 0
+
+	for color, coins := range cost {
+		coincost, wildcost := calculateActualCost(cards[color], purse[color], coins)
+		if coincost > 0 {
+			delta[color] = -coincost
+		}
+		wildsneeded += wildcost
+	}
+
+	if wildsneeded > 0 {
+		wildsneeded = t.wildsFor(wildsneeded)
+		if wildsneeded > purse[wild] {
+			return ErrInsufficientCoins
+		}
+		delta[wild] = -wildsneeded
+	}
+
+	for color, count := range delta {
+		t.state.Coins[color] -= count
+		t.player.Coins[color] += count
+	}
+	t.coinsEvent(delta)
+
+	return nil
+}
+
+// PayExactly attempts to pay the cost for a given card with exactly the coins
+// the player chose, which must cover the cost after bonuses with nothing left
+// over. Wilds may be spent in place of any color.
+func (t *turn) PayExactly(cards, cost, payment map[string]int) error {
+	for color, count := range payment {
+		if !isNormalColor(color) && color != wild {
+			return errors.New("invalid coin color")
+		}
+		if count < 0 {
+			return errors.New("can't pay a negative number of coins")
+		}
+		if t.player.Coins[color] < count {
+			return ErrInsufficientCoins
+		}
+	}
+
+	shortfall := 0
+	for color, coins := range cost {
+		need := coins - cards[color]
+		if need < 0 {
+			need = 0
+		}
+		if payment[color] > need {
+			return ErrOverpayment
+		}
+		shortfall += need - payment[color]
+	}
+	for color, count := range payment {
+		if _, ok := cost[color]; !ok && color != wild && count > 0 {
+			return ErrOverpayment
+		}
+	}
+
+	switch wilds := t.wildsFor(shortfall); {
+	case payment[wild] < wilds:
+		return ErrUnderpayment
+	case payment[wild] > wilds:
+		return ErrOverpayment
+	}
+
+	delta := map[string]int{}
+	for color, count := range payment {
+		if count > 0 {
+			delta[color] = -count
+		}
+	}
+
+	for color, count := range delta {
+		t.state.Coins[color] -= count
+		t.player.Coins[color] += count
+	}
+	t.coinsEvent(delta)
+
+	return nil
+}
+
+// WildsFor returns how many wilds the player needs to spend to cover the
+// given number of missing coins; with the right trading post each wild
+// counts for two.
+func (t *turn) wildsFor(coins int) int {
+	if t.player.HasPost(postDoubleGold) {
+		return (coins + 1) / 2
+	}
+	return coins
+}
+
+func calculateActualCost(cards, purse, cost int) (int, int) {
+	cost -= cards
+	if cost <= 0 {
+		// We have enough cards to totally cancel the cost.
+		return 0, 0
+	}
+
+	// We can directly afford it, pay the cost in regular coins.
+	if cost <= purse {
+		return cost, 0
+	}
+
+	// If we can't we need to spend some wilds.
+	return purse, cost - purse
+}
+
+func (t *turn) coinsEvent(coins map[string]int) {
+	if len(coins) == 0 {
+		return
+	}
+	t.events = append(t.events, Event{
+		Type:   eventCoins,
+		Player: t.player.ID,
+		Coins:  copyCoins(coins),
+	})
+}
+
+// DealCard deals a card from the deck onto the board, leaving the spot empty
+// if the deck has run out.
+func (t *turn) DealCard(tier int, index int, orient bool) {
+	rows, decks := t.state.Cards, t.state.Decks
+	if orient {
+		rows, decks = t.state.Orient, t.state.OrientDecks
+	}
+	deck := decks[tier-1]
+
+	newcard := ""
+	if len(deck) > 0 {
+		newcard = deck[0]
+		decks[tier-1] = deck[1:]
+	}
+	rows[tier-1][index] = newcard
+
+	t.events = append(t.events, Event{
+		Type:   eventDeal,
+		Card:   newcard,
+		Tier:   tier,
+		Index:  index,
+		Orient: orient,
+	})
+}
+
+// AffordableNobles returns the IDs of the nobles on the table that the
+// player can now afford.
+func (t *turn) AffordableNobles(cards map[string]int) ([]string, error) {
+	ret := []string{}
+
+	for _, id := range t.state.Nobles {
+		noble, ok := t.set.noble(id)
+		if !ok {
+			return nil, errors.New("invalid noble ID")
+		}
+
+		if canAfford(cards, noble.cost) {
+			ret = append(ret, id)
+		}
+	}
+
+	return ret, nil
+}
+
+func canAfford(cards, cost map[string]int) bool {
+	for color, num := range cost {
+		if cards[color] < num {
+			return false
+		}
+	}
+	return true
+}
+
+// TransferNoble transfers a noble from the table to the player.
+func (t *turn) TransferNoble(nobleID string) {
+	i := find(nobleID, t.state.Nobles)
+	n := t.state.Nobles
+	t.state.Nobles = append(n[:i], n[i+1:]...)
+	t.player.Nobles = append(t.player.Nobles, nobleID)
+
+	t.events = append(t.events, Event{
+		Type:   eventNoble,
+		Player: t.player.ID,
+		Noble:  nobleID,
+	})
+}
+
+//
+// Turn transitions.
+//
+
+// AfterAbility resolves the ability of the card a player just bought, if it
+// needs them to make a choice, before moving on.
+func (t *turn) AfterAbility(card card) error {
+	switch card.ability {
+	case abilityReserve:
+		if len(t.player.Reserved) < t.state.Options.ReserveSlots {
+			t.state.State = reservecard
+			return nil
+		}
+
+	case abilityNoble:
+		switch len(t.state.Nobles) {
+		case 0:
+		case 1:
+			t.TransferNoble(t.state.Nobles[0])
+		default:
+			t.state.State = claimnoble
+			return nil
+		}
+	}
+
+	return t.AfterBuy(t.player.CardCounts(t.set))
+}
+
+// AfterReserve moves on after a player reserves a card.
+func (t *turn) AfterReserve() error {
+	if t.state.State == reservecard {
+		return t.AfterBuy(t.player.CardCounts(t.set))
+	}
+
+	t.AfterEarn()
+	return nil
+}
+
+// AfterBuy moves on after a player buys a card.
+func (t *turn) AfterBuy(cards map[string]int) error {
+	// Does this player now have enough cards to get a noble? If there's only
+	// one they could get, give it to them. If there's more than one, give them
+	// time to pick one.
+	nobles, err := t.AffordableNobles(cards)
+	if err != nil {
+		return err
+	}
+	switch len(nobles) {
+	case 0:
+		// Nothing to do.
+
+	case 1:
+		t.TransferNoble(nobles[0])
+
+	default:
+		t.state.State = picknoble
+		return nil
+	}
+
+	t.EndTurn()
+	return nil
+}
+
+// AfterEarn moves on after a player earns coins, making them give some back
+// if they now have too many.
+func (t *turn) AfterEarn() {
+	if t.player.CountCoins() > maxCoins {
+		t.state.State = losecoin
+		return
+	}
+
+	t.EndTurn()
+}
+
+// EndTurn moves on at the end of a player's turn.
+func (t *turn) EndTurn() {
+	t.UnlockPosts()
+	t.ClaimCity()
+	t.NextTurn()
+}
+
+// NextTurn ends the game if the round is over and someone has won, and
+// otherwise moves on to the next player.
+func (t *turn) NextTurn() {
+	// Is this the last player of the round, and if so has someone won the
+	// game? If so stop playing so everyone has had the same number of turns.
+	if t.IsRoundOver() && t.IsGameOver() {
+		t.state.State = gameover
+		t.events = append(t.events, Event{Type: eventGameOver})
+		return
+	}
+
+	// Otherwise just go to the next player's turn.
+	t.NextPlayer()
+}
+
+// ClaimCity checks whether the player now qualifies for one of the cities
+// on the table, and if so claims the first one they do.
+func (t *turn) ClaimCity() {
+	if t.player.City != "" {
+		return
+	}
+
+	points := t.player.Points(t.set)
+	cards := t.player.CardCounts(t.set)
+	for _, id := range t.state.Cities {
+		city, ok := t.set.city(id)
+		if !ok || points < city.points || !canAfford(cards, city.cost) {
+			continue
+		}
+
+		t.player.City = id
+		t.events = append(t.events, Event{Type: eventCity, Player: t.player.ID, City: id})
+		return
+	}
+}
+
+// UnlockPosts unlocks any trading posts the player now qualifies for, in
+// trading posts mode.
+func (t *turn) UnlockPosts() {
+	if t.state.Options.Mode != modePosts {
+		return
+	}
+
+	cards := t.player.CardCounts(t.set)
+	for _, post := range tradingPosts {
+		if t.player.HasPost(post.id) || len(t.player.Nobles) < post.nobles || !canAfford(cards, post.cost) {
+			continue
+		}
+
+		t.player.Posts = append(t.player.Posts, post.id)
+		t.events = append(t.events, Event{Type: eventPost, Player: t.player.ID, Post: post.id})
+	}
+}
+
+// IsRoundOver returns true if this is the last turn for the round, i.e. if
+// everyone seated after this player has resigned.
+func (t *turn) IsRoundOver() bool {
+	for _, p := range t.state.Players[t.index+1:] {
+		if !p.Resigned {
+			return false
+		}
+	}
+	return true
+}
+
+// IsGameOver returns true if someone still playing has enough points to win,
+// or in cities mode if someone still playing has qualified for a city.
+func (t *turn) IsGameOver() bool {
+	if t.state.Options.Mode == modeCities {
+		for _, p := range t.state.Active() {
+			if p.City != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, p := range t.state.Active() {
+		if p.Points(t.set) >= t.state.Options.Points {
+			return true
+		}
+	}
+	return false
+}
+
+// NextPlayer moves on to the next player's turn.
+func (t *turn) NextPlayer() {
+	next := t.state.nextIndex(t.index)
+	t.state.State = play
+	t.state.Current = t.state.Players[next].ID
+}
+
+// LegalMoves lists every move the given player could legally make right now.
+// Each candidate is checked by actually applying it, so this always agrees
+// with Apply. Passing is only legal when nothing else is. Resigning is always
+// possible, so it isn't listed.
+func LegalMoves(state *GameState, userID string) []Move {
+	p := state.Player(userID)
+	if p == nil || p.Resigned || state.Current != userID || state.State == gameover {
+		return []Move{}
+	}
+
+	candidates := []Move{}
+	switch state.State {
+	case play:
+		colors := []string{white, black, green, blue, red}
+		for _, combo := range combinations(colors, 3) {
+			candidates = append(candidates, Move{Type: moveTake3, Colors: combo})
+		}
+		for _, color := range colors {
+			candidates = append(candidates, Move{Type: moveTake2, Colors: []string{color}})
+		}
+
+		candidates = append(candidates, reserveMoves(state)...)
+		for i, row := range state.Cards {
+			for j := range row {
+				candidates = append(candidates, buyMoves(state, Move{Type: moveBuy, Tier: i + 1, Index: j})...)
+			}
+		}
+		for i, row := range state.Orient {
+			for j := range row {
+				candidates = append(candidates, buyMoves(state, Move{Type: moveBuy, Tier: i + 1, Index: j, Orient: true})...)
+			}
+		}
+		for j := range p.Reserved {
+			candidates = append(candidates, buyMoves(state, Move{Type: moveBuy, Tier: 0, Index: j})...)
+		}
+
+	case reservecard:
+		candidates = append(candidates, reserveMoves(state)...)
+		candidates = append(candidates, Move{Type: movePass})
+
+	case picknoble, claimnoble:
+		for _, noble := range state.Nobles {
+			candidates = append(candidates, Move{Type: movePickNoble, Noble: noble})
+		}
+
+	case losecoin:
+		held := []string{}
+		for _, color := range []string{white, black, green, blue, red, wild} {
+			for i := 0; i < p.Coins[color]; i++ {
+				held = append(held, color)
+			}
+		}
+		seen := map[string]bool{}
+		for _, combo := range combinations(held, p.CountCoins()-maxCoins) {
+			key := strings.Join(combo, ",")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			coins := map[string]int{}
+			for _, color := range combo {
+				coins[color]++
+			}
+			candidates = append(candidates, Move{Type: moveReturnCoins, Coins: coins})
+		}
+	}
+
+	ret := []Move{}
+	for _, move := range candidates {
+		move.Player = userID
+		if _, _, err := Apply(state, move); err == nil {
+			ret = append(ret, move)
+		}
+	}
+
+	// If there's nothing else they can do, they can pass.
+	if len(ret) == 0 && state.State == play {
+		ret = append(ret, Move{Type: movePass, Player: userID})
+	}
+
+	return ret
+}
+
+// ReserveMoves lists every card that might be reserved.
+func reserveMoves(state *GameState) []Move {
+	ret := []Move{}
+	for i, row := range state.Cards {
+		for j := range row {
+			ret = append(ret, Move{Type: moveReserve, Tier: i + 1, Index: j})
+		}
+		ret = append(ret, Move{Type: moveReserve, Tier: i + 1, Deck: true})
+	}
+	for i, row := range state.Orient {
+		for j := range row {
+			ret = append(ret, Move{Type: moveReserve, Tier: i + 1, Index: j, Orient: true})
+		}
+		ret = append(ret, Move{Type: moveReserve, Tier: i + 1, Deck: true, Orient: true})
+	}
+	return ret
+}
+
+// BuyMoves lists the ways of buying the card at the given position; in
+// Orient mode that includes every color a joker might copy.
+func buyMoves(state *GameState, move Move) []Move {
+	ret := []Move{move}
+	if state.Options.Mode == modeOrient {
+		for _, color := range []string{white, black, green, blue, red} {
+			m := move
+			m.Colors = []string{color}
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// Combinations returns every non-empty subset of up to n of the given strings.
+func combinations(strs []string, n int) [][]string {
+	ret := [][]string{{}}
+	for _, str := range strs {
+		for _, combo := range ret {
+			if len(combo) < n {
+				ret = append(ret, append(copyStrings(combo), str))
+			}
+		}
+	}
+	return ret[1:]
+}
+
+// BotMove picks a move for the given player, for when a bot has to stand in
+// for them. It's not clever: it buys the card worth the most points it can,
+// and otherwise takes as many coins as it can.
+func BotMove(state *GameState, userID string) (Move, error) {
+	moves := LegalMoves(state, userID)
+	if len(moves) == 0 {
+		return Move{}, errors.New("no legal moves")
+	}
+	set, err := getCardSet(state.Options.CardSet)
+	if err != nil {
+		return Move{}, err
+	}
+
+	best, bestScore := moves[0], -1
+	for _, move := range moves {
+		score := 0
+		switch move.Type {
+		case moveBuy:
+			score = 10
+			if id, err := cardAt(state, userID, move); err == nil {
+				if card, ok := set.card(id); ok {
+					score += card.points
+				}
+			}
+		case moveTake3:
+			score = len(move.Colors) * 2
+		case moveTake2:
+			score = 3
+		case moveReserve:
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = move, score
+		}
+	}
+
+	return best, nil
+}
+
+// CardAt returns the ID of the card a buy or reserve move is for.
+func cardAt(state *GameState, userID string, move Move) (string, error) {
+	t := &turn{state: state, player: state.Player(userID)}
+	return t.GetCardID(move.Tier, move.Index, move.Orient)
+}
@@ -0,0 +1,633 @@
+package splenda
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNewGameState(t *testing.T) {
+	state, err := newGameState([]string{"user1", "user2"}, Options{}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.State != play || state.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", state.State, state.Current)
+	}
+	assertStrings(t, "nobles", state.Nobles, []string{"macchiavelli", "charles_v", "catherine_of_medici"})
+	assertStrings(t, "tier 3", state.Cards[2], []string{"3_7_3_0", "3_6_23_1", "3_7_3_1", "3_5_33_4"})
+	assertStrings(t, "tier 2", state.Cards[1], []string{"2_6_2", "2_3_22_1", "2_23_2_4", "2_5_3_2"})
+	assertStrings(t, "tier 1", state.Cards[0], []string{"1_4_3", "1_22_1", "1_22_0", "1_2_31_3"})
+
+	if len(state.Decks[0]) != 36 || len(state.Decks[1]) != 26 || len(state.Decks[2]) != 16 {
+		t.Errorf("bad deck sizes: %v %v %v", len(state.Decks[0]), len(state.Decks[1]), len(state.Decks[2]))
+	}
+}
+
+func TestNewGameStateSixPlayers(t *testing.T) {
+	players := []string{"user1", "user2", "user3", "user4", "user5", "user6"}
+	opts := Options{CardsPerTier: 5}
+	state, err := newGameState(players, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Coins[red] != 9 || state.Coins[wild] != defaultGold {
+		t.Errorf("bad bank: %v", state.Coins)
+	}
+	if len(state.Nobles) != 7 {
+		t.Errorf("expected 7 nobles, got %v", len(state.Nobles))
+	}
+	for i, row := range state.Cards {
+		if len(row) != 5 {
+			t.Errorf("expected 5 cards in tier %v, got %v", i+1, row)
+		}
+	}
+}
+
+func TestNewGameStateWithOptions(t *testing.T) {
+	opts := Options{Points: 10, Coins: 3, Gold: 2, Nobles: 1, CardsPerTier: 3, ReserveSlots: 1, FixedSeats: true}
+	state, err := newGameState([]string{"user1", "user2", "user3"}, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Current != "user1" || state.Players[1].ID != "user2" || state.Players[2].ID != "user3" {
+		t.Errorf("players were reseated: %v first", state.Current)
+	}
+	if state.Coins[red] != 3 || state.Coins[wild] != 2 {
+		t.Errorf("bad bank: %v", state.Coins)
+	}
+	if len(state.Nobles) != 1 || len(state.Cards[0]) != 3 || len(state.Decks[0]) != 37 {
+		t.Errorf("bad table: %v nobles, %v cards", len(state.Nobles), len(state.Cards[0]))
+	}
+
+	// Only one card can be reserved.
+	state = mustApply(t, state, Move{Type: moveReserve, Player: "user1", Tier: 1, Index: 0})
+	state.Current = "user1"
+	if _, _, err := Apply(state, Move{Type: moveReserve, Player: "user1", Tier: 1, Index: 0}); err == nil {
+		t.Error("expected an error reserving a second card")
+	}
+
+	if err := validateOptions(&Options{Points: -1}); err == nil {
+		t.Error("expected an error for negative points")
+	}
+	if err := validateOptions(&Options{CardsPerTier: maxCardsPerTier + 1}); err == nil {
+		t.Error("expected an error for too many cards per tier")
+	}
+}
+
+func TestApplyDoesNotModifyState(t *testing.T) {
+	state := testState()
+
+	next, _, err := Apply(state, Move{Type: moveTake3, Player: "user1", Colors: []string{red, blue, green}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.TS != 0 || state.Current != "user1" || state.Coins[red] != 4 || state.Players[0].Coins[red] != 0 {
+		t.Errorf("original state was modified")
+	}
+	if next.TS != 1 || next.Current != "user2" || next.Coins[red] != 3 || next.Players[0].Coins[red] != 1 {
+		t.Errorf("bad next state")
+	}
+}
+
+func TestNotYourTurn(t *testing.T) {
+	_, _, err := Apply(testState(), Move{Type: moveTake3, Player: "user2", Colors: []string{red}})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestTake2(t *testing.T) {
+	state := testState()
+	state.Coins[red] = 3
+
+	_, _, err := Apply(state, Move{Type: moveTake2, Player: "user1", Colors: []string{red}})
+	if err != ErrInsufficientCoins {
+		t.Errorf("expected insufficient coins, got %v", err)
+	}
+
+	next := mustApply(t, state, Move{Type: moveTake2, Player: "user1", Colors: []string{blue}})
+	if next.Coins[blue] != 2 || next.Players[0].Coins[blue] != 2 {
+		t.Errorf("bad coins: %v, %v", next.Coins, next.Players[0].Coins)
+	}
+}
+
+func TestReserveTop(t *testing.T) {
+	next := mustApply(t, testState(), Move{Type: moveReserve, Player: "user1", Tier: 1, Deck: true})
+
+	p := next.Players[0]
+	assertStrings(t, "reserved", p.Reserved, []string{"1_3_0"})
+	assertStrings(t, "hidden", p.Hidden, []string{"1_3_0"})
+	assertStrings(t, "deck", next.Decks[0], []string{"1_3_2"})
+	if p.Coins[wild] != 1 || next.Coins[wild] != 4 {
+		t.Errorf("bad wild coins: %v, %v", p.Coins[wild], next.Coins[wild])
+	}
+}
+
+func TestBuyWithWilds(t *testing.T) {
+	state := testState()
+	state.Players[0].Coins[red] = 1
+	state.Players[0].Coins[wild] = 2
+
+	next := mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1})
+
+	p := next.Players[0]
+	assertStrings(t, "cards", p.Cards, []string{"1_3_1"})
+	assertStrings(t, "tier 1", next.Cards[0], []string{"1_4_0", "1_3_0", "1_41_0", "1_41_2"})
+	if p.Coins[red] != 0 || p.Coins[wild] != 0 || next.Coins[red] != 5 || next.Coins[wild] != 7 {
+		t.Errorf("bad coins: %v, %v", p.Coins, next.Coins)
+	}
+}
+
+func TestNobles(t *testing.T) {
+	state := testState()
+	state.Players[0].Cards = []string{
+		"1_4_4", "1_3_4", "1_2_1_4", "1_22_4",
+		"1_4_1", "1_2_1_1", "1_22_1",
+	}
+
+	// Only one noble is affordable, so it's awarded automatically.
+	next := mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1})
+	assertStrings(t, "player nobles", next.Players[0].Nobles, []string{"mary_stuart"})
+	assertStrings(t, "table nobles", next.Nobles, []string{"charles_v", "henry_viii"})
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+
+	// With two affordable nobles, the player has to pick one.
+	state.Players[0].Cards = append(state.Players[0].Cards, "1_4_2", "1_3_2", "1_2_1_2", "1_22_2")
+	next = mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1})
+	if next.State != picknoble || next.Current != "user1" {
+		t.Errorf("bad state: expected picknoble/user1, got %v/%v", next.State, next.Current)
+	}
+
+	if _, _, err := Apply(next, Move{Type: movePickNoble, Player: "user1", Noble: "charles_v"}); err == nil {
+		t.Error("expected an error picking an unaffordable noble")
+	}
+
+	next = mustApply(t, next, Move{Type: movePickNoble, Player: "user1", Noble: "henry_viii"})
+	assertStrings(t, "player nobles", next.Players[0].Nobles, []string{"henry_viii"})
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+}
+
+func TestReturnCoins(t *testing.T) {
+	state := testState()
+	state.Players[0].Coins = map[string]int{red: 2, blue: 2, green: 2, black: 2, white: 1, wild: 0}
+
+	next := mustApply(t, state, Move{Type: moveTake3, Player: "user1", Colors: []string{red, blue, green}})
+	if next.State != losecoin || next.Current != "user1" {
+		t.Errorf("bad state: expected losecoin/user1, got %v/%v", next.State, next.Current)
+	}
+
+	if _, _, err := Apply(next, Move{Type: moveReturnCoins, Player: "user1", Coins: map[string]int{red: 1}}); err == nil {
+		t.Error("expected an error returning too few coins")
+	}
+
+	next = mustApply(t, next, Move{Type: moveReturnCoins, Player: "user1", Coins: map[string]int{red: 1, blue: 1}})
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+	if next.Players[0].CountCoins() != 10 || next.Coins[red] != 4 {
+		t.Errorf("bad coins: %v, %v", next.Players[0].Coins, next.Coins)
+	}
+}
+
+func TestGameOverAtEndOfRound(t *testing.T) {
+	state := testState()
+	state.Players[0].Cards = []string{"3_7_0", "3_7_1", "3_7_2"}
+	state.Players[0].Coins[white] = 6
+
+	// The first player reaches 15 points, but the round isn't over yet.
+	next := mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 2, Index: 0})
+	if points := next.Players[0].Points(cardSets[defaultCardSet]); points != 15 {
+		t.Errorf("bad points: expected 15, got %v", points)
+	}
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+
+	// The last player gets their turn, and then the game is over.
+	next = mustApply(t, next, Move{Type: moveTake3, Player: "user2", Colors: []string{red, blue, green}})
+	if next.State != gameover {
+		t.Errorf("bad state: expected gameover, got %v", next.State)
+	}
+
+	if _, _, err := Apply(next, Move{Type: moveTake3, Player: "user2", Colors: []string{red}}); err == nil {
+		t.Error("expected an error moving after the game is over")
+	}
+}
+
+func TestCities(t *testing.T) {
+	opts := Options{Mode: modeCities}
+	state, err := newGameState([]string{"user1", "user2"}, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Nobles) != 0 || len(state.Cities) != numCities {
+		t.Errorf("expected cities instead of nobles, got %v and %v", state.Nobles, state.Cities)
+	}
+
+	state = testState()
+	state.Options.Mode = modeCities
+	state.Nobles = []string{}
+	state.Cities = []string{"venice", "cairo"}
+	state.Players[0].Cards = []string{"3_7_3_0", "3_7_3_4", "3_7_0", "3_7_4"}
+
+	// Qualifying for a city at the end of your turn claims it, but the round
+	// still gets finished.
+	next := mustApply(t, state, Move{Type: moveTake3, Player: "user1", Colors: []string{red, blue, green}})
+	if next.Players[0].City != "cairo" {
+		t.Errorf("expected user1 to claim cairo, got %q", next.Players[0].City)
+	}
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+
+	next = mustApply(t, next, Move{Type: moveTake3, Player: "user2", Colors: []string{red, blue, green}})
+	if next.State != gameover {
+		t.Errorf("bad state: expected gameover, got %v", next.State)
+	}
+}
+
+func TestTradingPosts(t *testing.T) {
+	state := testState()
+	state.Options.Mode = modePosts
+	state.Players[0].Cards = []string{"1_4_4", "1_3_4", "1_2_1_4", "1_22_0"}
+
+	// Three red cards and a white one unlock the extra coin at the end of the turn.
+	next := mustApply(t, state, Move{Type: moveTake3, Player: "user1", Colors: []string{red, blue, green}})
+	if posts := next.Players[0].Posts; len(posts) != 1 || posts[0] != postExtraCoin {
+		t.Errorf("expected user1 to unlock %v, got %v", postExtraCoin, next.Players[0].Posts)
+	}
+
+	if _, _, err := Apply(next, Move{Type: moveTake2, Player: "user2", Colors: []string{red, blue}}); err == nil {
+		t.Error("expected an error taking an extra coin without the trading post")
+	}
+	next = mustApply(t, next, Move{Type: moveTake3, Player: "user2", Colors: []string{red, blue, green}})
+
+	if _, _, err := Apply(next, Move{Type: moveTake2, Player: "user1", Colors: []string{black, black}}); err == nil {
+		t.Error("expected an error taking an extra coin of the same color")
+	}
+	next = mustApply(t, next, Move{Type: moveTake2, Player: "user1", Colors: []string{black, white}})
+	if next.Players[0].Coins[black] != 2 || next.Players[0].Coins[white] != 1 {
+		t.Errorf("expected two black coins and a white one, got %v", next.Players[0].Coins)
+	}
+
+	// Gold counts double with the right trading post.
+	state = testState()
+	state.Players[0].Posts = []string{postDoubleGold}
+	state.Players[0].Coins[wild] = 2
+	next = mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1})
+	if next.Players[0].Coins[wild] != 0 {
+		t.Errorf("expected to pay two gold for three red, got %v", next.Players[0].Coins)
+	}
+
+	// Buying a card earns a matching coin with the right trading post.
+	state = testState()
+	state.Players[0].Posts = []string{postBuyCoin}
+	state.Players[0].Coins[red] = 3
+	next = mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1})
+	if next.Players[0].Coins[green] != 1 {
+		t.Errorf("expected a green coin for buying a green card, got %v", next.Players[0].Coins)
+	}
+
+	set, err := getCardSet(defaultCardSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPlayerState("user1")
+	p.Posts = []string{postFivePoints, postPointEach}
+	if points := p.Points(set); points != 7 {
+		t.Errorf("expected 7 points from trading posts, got %v", points)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	opts := Options{Mode: modeOrient}
+	state, err := newGameState([]string{"user1", "user2"}, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Orient) != numTiers || len(state.Orient[0]) != orientCardsPerTier {
+		t.Errorf("expected a row of Orient cards for each tier, got %v", state.Orient)
+	}
+
+	orientState := func() *GameState {
+		state := testState()
+		state.Options.Mode = modeOrient
+		state.Orient = [][]string{
+			{"o1_joker_0", "o1_double_red"},
+			{"o2_noble_blue", "o2_joker_0"},
+			{"o3_reserve_red", "o3_joker_1"},
+		}
+		state.OrientDecks = [][]string{{"o1_reserve_white"}, {}, {}}
+		return state
+	}
+
+	// Jokers copy the color of one of the player's cards.
+	state = orientState()
+	state.Players[0].Cards = []string{"1_4_4"}
+	state.Players[0].Coins[black] = 3
+	buy := Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 0, Orient: true}
+	if _, _, err := Apply(state, buy); err == nil {
+		t.Error("expected an error buying a joker without a color")
+	}
+	buy.Colors = []string{green}
+	if _, _, err := Apply(state, buy); err == nil {
+		t.Error("expected an error copying a color the player doesn't have")
+	}
+	buy.Colors = []string{red}
+	next := mustApply(t, state, buy)
+	set, err := getCardSet(defaultCardSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := next.Players[0].CardCounts(set); counts[red] != 2 {
+		t.Errorf("expected the joker to count as red, got %v", counts)
+	}
+	if next.Orient[0][0] != "o1_reserve_white" {
+		t.Errorf("expected a new Orient card to be dealt, got %v", next.Orient[0])
+	}
+
+	// Double-bonus cards count twice.
+	state = orientState()
+	state.Players[0].Coins[blue] = 3
+	state.Players[0].Coins[black] = 1
+	next = mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1, Orient: true})
+	if counts := next.Players[0].CardCounts(set); counts[red] != 2 {
+		t.Errorf("expected a double red bonus, got %v", counts)
+	}
+
+	// Reserve cards come with a free reserve, without a gold coin.
+	state = orientState()
+	state.Players[0].Coins[black] = 7
+	next = mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 3, Index: 0, Orient: true})
+	if next.State != reservecard || next.Current != "user1" {
+		t.Fatalf("bad state: expected reservecard/user1, got %v/%v", next.State, next.Current)
+	}
+	next = mustApply(t, next, Move{Type: moveReserve, Player: "user1", Tier: 1, Index: 0})
+	if len(next.Players[0].Reserved) != 1 || next.Players[0].Coins[wild] != 0 {
+		t.Errorf("expected a free reserve, got %v and %v", next.Players[0].Reserved, next.Players[0].Coins)
+	}
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+
+	// Noble cards claim any noble on the table.
+	state = orientState()
+	state.Players[0].Coins[white] = 4
+	state.Players[0].Coins[black] = 2
+	next = mustApply(t, state, Move{Type: moveBuy, Player: "user1", Tier: 2, Index: 0, Orient: true})
+	if next.State != claimnoble {
+		t.Fatalf("bad state: expected claimnoble, got %v", next.State)
+	}
+	next = mustApply(t, next, Move{Type: movePickNoble, Player: "user1", Noble: "henry_viii"})
+	if len(next.Players[0].Nobles) != 1 || next.Current != "user2" {
+		t.Errorf("expected user1 to claim henry_viii, got %v", next.Players[0].Nobles)
+	}
+}
+
+func testState() *GameState {
+	return &GameState{
+		State:   play,
+		Current: "user1",
+		Coins:   map[string]int{red: 4, blue: 4, green: 4, black: 4, white: 4, wild: 5},
+		Nobles:  []string{"mary_stuart", "charles_v", "henry_viii"},
+		Cards: [][]string{
+			{"1_4_0", "1_3_1", "1_41_0", "1_41_2"},
+			{"2_6_0", "2_6_1", "2_5_0", "2_5_1"},
+			{"3_7_3_0", "3_7_3_1", "3_7_3_2", "3_7_3_3"},
+		},
+		Decks: [][]string{
+			{"1_3_0", "1_3_2"},
+			{"2_5_2"},
+			{},
+		},
+		Players: []*PlayerState{
+			newPlayerState("user1"),
+			newPlayerState("user2"),
+		},
+		Options: Options{}.withDefaults(2),
+	}
+}
+
+func mustApply(t *testing.T, state *GameState, move Move) *GameState {
+	t.Helper()
+	next, _, err := Apply(state, move)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return next
+}
+
+func assertStrings(t *testing.T, what string, actual []string, expected []string) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Errorf("bad %v: expected %v, got %v", what, expected, actual)
+		return
+	}
+	for i, a := range actual {
+		if a != expected[i] {
+			t.Errorf("bad %v: expected %v, got %v", what, expected, actual)
+			return
+		}
+	}
+}
+
+func TestLegalMoves(t *testing.T) {
+	state := testState()
+	state.Coins[red] = 0
+	state.Players[0].Coins[green] = 4
+	state.Players[0].Coins[white] = 3
+	state.Players[0].Reserved = []string{"1_3_4"}
+
+	counts := map[string]int{}
+	for _, move := range LegalMoves(state, "user1") {
+		counts[move.Type]++
+		if move.Type == moveBuy && !(move.Tier == 1 && move.Index == 0) && !(move.Tier == 0 && move.Index == 0) {
+			t.Errorf("unexpected purchase: %+v", move)
+		}
+	}
+
+	// Four colors left in the bank: 4 singles, 6 pairs and 4 triples.
+	if counts[moveTake3] != 14 {
+		t.Errorf("bad take3 count: expected 14, got %v", counts[moveTake3])
+	}
+	if counts[moveTake2] != 4 {
+		t.Errorf("bad take2 count: expected 4, got %v", counts[moveTake2])
+	}
+	// Twelve face-up cards plus two non-empty decks.
+	if counts[moveReserve] != 14 {
+		t.Errorf("bad reserve count: expected 14, got %v", counts[moveReserve])
+	}
+	if counts[moveBuy] != 2 {
+		t.Errorf("bad buy count: expected 2, got %v", counts[moveBuy])
+	}
+
+	if moves := LegalMoves(state, "user2"); len(moves) != 0 {
+		t.Errorf("expected no moves out of turn, got %v", moves)
+	}
+}
+
+func TestPass(t *testing.T) {
+	state := testState()
+
+	if _, _, err := Apply(state, Move{Type: movePass, Player: "user1"}); err == nil {
+		t.Error("expected an error passing with legal moves available")
+	}
+
+	// Empty the bank and fill up the player's reserved cards, so they can't
+	// take coins, reserve, or buy anything.
+	for color := range state.Coins {
+		state.Coins[color] = 0
+	}
+	state.Players[0].Reserved = []string{"3_7_0", "3_7_1", "3_7_2"}
+
+	moves := LegalMoves(state, "user1")
+	if len(moves) != 1 || moves[0].Type != movePass {
+		t.Fatalf("expected only pass, got %v", moves)
+	}
+
+	next := mustApply(t, state, moves[0])
+	if next.TS != 1 || next.State != play || next.Current != "user2" {
+		t.Errorf("bad state after pass: %v/%v/%v", next.TS, next.State, next.Current)
+	}
+}
+
+func TestResign(t *testing.T) {
+	state := testState()
+	state.Players = append(state.Players, newPlayerState("user3"))
+	state.Players[1].Coins[red] = 2
+
+	// Resigning doesn't have to wait for your turn.
+	next := mustApply(t, state, Move{Type: moveResign, Player: "user2"})
+	if next.State != play || next.Current != "user1" || !next.Players[1].Resigned {
+		t.Errorf("bad state after resign: %v/%v", next.State, next.Current)
+	}
+	if next.Coins[red] != 6 || next.Players[1].Coins[red] != 0 {
+		t.Errorf("resigned player's coins not returned: %v", next.Coins)
+	}
+
+	// Their seat is skipped, and they can't move any more.
+	next = mustApply(t, next, Move{Type: moveTake2, Player: "user1", Colors: []string{red}})
+	if next.Current != "user3" {
+		t.Errorf("expected user3 to be next, got %v", next.Current)
+	}
+	if _, _, err := Apply(next, Move{Type: moveResign, Player: "user2"}); err == nil {
+		t.Error("expected an error moving after resigning")
+	}
+
+	// Once only one player is left, they've won.
+	next = mustApply(t, next, Move{Type: moveResign, Player: "user3"})
+	if next.State != gameover {
+		t.Errorf("expected game over, got %v", next.State)
+	}
+}
+
+func TestResignDoesNotEndTurn(t *testing.T) {
+	state := testState()
+	state.Options.Mode = modeCities
+	state.Nobles = []string{}
+	state.Cities = []string{"venice", "cairo"}
+	state.Players = append(state.Players, newPlayerState("user3"))
+	state.Players[0].Cards = []string{"3_7_3_0", "3_7_3_4", "3_7_0", "3_7_4"}
+
+	// Resigning on your turn while you qualify for a city doesn't claim it,
+	// so the game goes on.
+	next := mustApply(t, state, Move{Type: moveResign, Player: "user1"})
+	if next.Players[0].City != "" {
+		t.Errorf("expected no city for user1, got %q", next.Players[0].City)
+	}
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+
+	// And a resigned player's city doesn't end the game either.
+	next.Players[0].City = "cairo"
+	next = mustApply(t, next, Move{Type: moveTake3, Player: "user2", Colors: []string{red, blue, green}})
+	next = mustApply(t, next, Move{Type: moveTake3, Player: "user3", Colors: []string{red, blue, green}})
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state: expected play/user2, got %v/%v", next.State, next.Current)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	state := testState()
+
+	next := mustApply(t, state, Move{Type: moveTimeout, Player: "user1"})
+	if next.State != play || next.Current != "user2" {
+		t.Errorf("bad state after timeout: %v/%v", next.State, next.Current)
+	}
+
+	// Running out of time while over the coin limit gives back the excess.
+	state.State = losecoin
+	state.Players[0].Coins = map[string]int{white: 3, black: 3, red: 4, wild: 1}
+	next = mustApply(t, state, Move{Type: moveTimeout, Player: "user1"})
+	if next.Current != "user2" || next.Players[0].CountCoins() != maxCoins {
+		t.Errorf("bad state after timeout: %v, %v", next.Current, next.Players[0].Coins)
+	}
+	if next.Players[0].Coins[white] != 2 {
+		t.Errorf("expected a white coin to be returned, got %v", next.Players[0].Coins)
+	}
+}
+
+func TestBotMove(t *testing.T) {
+	state := testState()
+
+	move, err := BotMove(state, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if move.Type != moveTake3 || len(move.Colors) != 3 {
+		t.Errorf("expected the bot to take three coins, got %v", move)
+	}
+
+	// Given the chance, it buys the card worth the most points.
+	state.Players[0].Coins = map[string]int{green: 4, red: 5}
+	if move, err = BotMove(state, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if move.Type != moveBuy {
+		t.Fatalf("expected the bot to buy, got %v", move)
+	}
+	if id, _ := cardAt(state, "user1", move); id != "2_5_0" {
+		t.Errorf("expected the bot to buy 2_5_0, got %v", id)
+	}
+}
+
+func TestBuyWithPayment(t *testing.T) {
+	state := testState()
+	state.Players[0].Coins[red] = 3
+	state.Players[0].Coins[blue] = 1
+	state.Players[0].Coins[wild] = 2
+
+	buy := func(payment map[string]int) (*GameState, error) {
+		next, _, err := Apply(state, Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1, Coins: payment})
+		return next, err
+	}
+
+	if _, err := buy(map[string]int{red: 3, wild: 1}); err != ErrOverpayment {
+		t.Errorf("expected overpayment, got %v", err)
+	}
+	if _, err := buy(map[string]int{red: 2, blue: 1}); err != ErrOverpayment {
+		t.Errorf("expected overpayment, got %v", err)
+	}
+	if _, err := buy(map[string]int{red: 1, wild: 1}); err != ErrUnderpayment {
+		t.Errorf("expected underpayment, got %v", err)
+	}
+
+	// Keep two reds by spending both wilds instead.
+	next, err := buy(map[string]int{red: 1, wild: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := next.Players[0]
+	if p.Coins[red] != 2 || p.Coins[wild] != 0 || next.Coins[red] != 5 || next.Coins[wild] != 7 {
+		t.Errorf("bad coins: %v, %v", p.Coins, next.Coins)
+	}
+}
@@ -14,6 +14,14 @@ func (e *Error) Error() string {
 }
 
 var (
+	// ErrNotModified is the error returned when the caller asks for a game
+	// they already have the latest version of.
+	ErrNotModified error = &Error{
+		HTTP:    304,
+		Code:    "NotModified",
+		Message: "the game hasn't changed",
+	}
+
 	// ErrInsufficientCoins is the error returned when the user tries to make a
 	// move but there are not enough coins either in the bank or in their hand.
 	ErrInsufficientCoins error = &Error{
@@ -21,4 +29,20 @@ var (
 		Code:    "InsufficientCoins",
 		Message: "not enough coins available to do that",
 	}
+
+	// ErrOverpayment is the error returned when the user tries to pay for a
+	// card with more coins than it costs.
+	ErrOverpayment error = &Error{
+		HTTP:    400,
+		Code:    "Overpayment",
+		Message: "that's more coins than the card costs",
+	}
+
+	// ErrUnderpayment is the error returned when the user tries to pay for a
+	// card with fewer coins than it costs.
+	ErrUnderpayment error = &Error{
+		HTTP:    400,
+		Code:    "Underpayment",
+		Message: "that's not enough coins to pay for the card",
+	}
 )
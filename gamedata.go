@@ -1,8 +1,12 @@
 package splenda
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
-	"strings"
 )
 
 const (
@@ -24,22 +28,48 @@ func isNormalColor(color string) bool {
 }
 
 const (
-	play      = "play"
-	picknoble = "picknoble"
-	losecoin  = "losecoin"
-	gameover  = "gameover"
+	play        = "play"
+	picknoble   = "picknoble"
+	claimnoble  = "claimnoble"
+	reservecard = "reservecard"
+	losecoin    = "losecoin"
+	gameover    = "gameover"
+
+	// Splendor Duel only.
+	taketoken  = "taketoken"
+	stealtoken = "stealtoken"
+	pickroyal  = "pickroyal"
 )
 
+// Game types.
+const (
+	gameSplendor = "splendor"
+	gameDuel     = "duel"
+)
+
+// The maximum number of coins a player may hold at the end of their turn.
+const maxCoins = 10
+
+// The most players a game can have.
+const maxPlayers = 6
+
+// Nobles are worth three points unless their card set says otherwise.
+const noblePoints = 3
+
 type cost map[string]int
 
 type noble struct {
-	id   string
-	cost cost
+	id     string
+	points int
+	cost   cost
 }
 
-func nobleFromID(id string) (noble, bool) {
-	n, ok := nobles[id]
-	return n, ok
+// A city is won by having at least the given points, plus at least the
+// given number of cards of each color in its cost.
+type city struct {
+	id     string
+	points int
+	cost   cost
 }
 
 type rng interface {
@@ -60,9 +90,85 @@ func pick(set []string, n int, rng rng) []string {
 	return ret
 }
 
-func pickNobles(n int, rng rng) []string {
+// Card abilities, from the Orient expansion.
+const (
+	abilityDouble  = "double"  // Counts as two bonuses of its color.
+	abilityJoker   = "joker"   // Copies the color of one of the player's bonuses.
+	abilityReserve = "reserve" // Comes with a free reserve.
+	abilityNoble   = "noble"   // Claims any noble on the table.
+)
+
+type card struct {
+	id      string
+	tier    int
+	color   string
+	points  int
+	cost    cost
+	ability string
+}
+
+// The number of tiers of cards on the table.
+const numTiers = 3
+
+// The card set games use unless they ask for a different one.
+const defaultCardSet = "standard"
+
+// A cardSet is a complete set of cards and nobles to play a game with. The
+// Orient cards are kept apart, since they're dealt into a row of their own.
+type cardSet struct {
+	id      string
+	version string
+	tiers   []map[string]card
+	orient  []map[string]card
+	nobles  map[string]noble
+	cities  map[string]city
+}
+
+// The card sets that have been loaded, by ID for the current version of each
+// and by pinned ID for every version, old ones included.
+var cardSets = map[string]*cardSet{}
+
+func getCardSet(id string) (*cardSet, error) {
+	set, ok := cardSets[id]
+	if !ok {
+		return nil, fmt.Errorf("no such card set: %v", id)
+	}
+	return set, nil
+}
+
+// PinnedID is the set's ID with its version attached, which games store so
+// they keep playing with the same cards even after the set is edited.
+func (s *cardSet) pinnedID() string {
+	return s.id + "@" + s.version
+}
+
+func (s *cardSet) card(id string) (card, bool) {
+	for _, tier := range s.tiers {
+		if c, ok := tier[id]; ok {
+			return c, true
+		}
+	}
+	for _, tier := range s.orient {
+		if c, ok := tier[id]; ok {
+			return c, true
+		}
+	}
+	return card{}, false
+}
+
+func (s *cardSet) noble(id string) (noble, bool) {
+	n, ok := s.nobles[id]
+	return n, ok
+}
+
+func (s *cardSet) city(id string) (city, bool) {
+	c, ok := s.cities[id]
+	return c, ok
+}
+
+func (s *cardSet) pickNobles(n int, rng rng) []string {
 	deck := []string{}
-	for id := range nobles {
+	for id := range s.nobles {
 		deck = append(deck, id)
 	}
 	sort.Strings(deck) // To make things deterministic for tests.
@@ -70,32 +176,27 @@ func pickNobles(n int, rng rng) []string {
 	return pick(deck, n, rng)
 }
 
-type card struct {
-	id     string
-	color  string
-	points int
-	cost   cost
+func (s *cardSet) pickCities(n int, rng rng) []string {
+	deck := []string{}
+	for id := range s.cities {
+		deck = append(deck, id)
+	}
+	sort.Strings(deck) // To make things deterministic for tests.
+
+	return pick(deck, n, rng)
 }
 
-func cardFromID(id string) (card, bool) {
-	if strings.HasPrefix(id, "1_") {
-		c, ok := tier1[id]
-		return c, ok
-	}
-	if strings.HasPrefix(id, "2_") {
-		c, ok := tier2[id]
-		return c, ok
-	}
-	if strings.HasPrefix(id, "3_") {
-		c, ok := tier3[id]
-		return c, ok
-	}
-	return card{}, false
+func (s *cardSet) shuffleCards(tier int, rng rng) []string {
+	return shuffleTier(s.tiers[tier-1], rng)
+}
+
+func (s *cardSet) shuffleOrient(tier int, rng rng) []string {
+	return shuffleTier(s.orient[tier-1], rng)
 }
 
-func shuffleCards(cs map[string]card, rng rng) []string {
+func shuffleTier(tier map[string]card, rng rng) []string {
 	deck := []string{}
-	for id := range cs {
+	for id := range tier {
 		deck = append(deck, id)
 	}
 	sort.Strings(deck) // To make things deterministic for tests.
@@ -103,145 +204,234 @@ func shuffleCards(cs map[string]card, rng rng) []string {
 	return pick(deck, len(deck), rng)
 }
 
-func noblemap(ns []noble) map[string]noble {
-	ret := map[string]noble{}
-	for i := range ns {
-		ret[ns[i].id] = ns[i]
+// HasOrient returns true if the set has enough Orient cards to play in
+// Orient mode.
+func (s *cardSet) hasOrient() bool {
+	for _, tier := range s.orient {
+		if len(tier) < orientCardsPerTier {
+			return false
+		}
 	}
-	return ret
+	return true
 }
 
-var nobles = noblemap([]noble{
-	{id: "mary_stuart", cost: cost{red: 4, green: 4}},
-	{id: "charles_v", cost: cost{black: 3, red: 3, white: 3}},
-	{id: "macchiavelli", cost: cost{blue: 4, white: 4}},
-	{id: "isabelle_of_castille", cost: cost{black: 4, white: 4}},
-	{id: "suleiman_i", cost: cost{blue: 4, green: 4}},
-	{id: "catherine_of_medici", cost: cost{green: 3, blue: 3, red: 3}},
-	{id: "anne_of_brittany", cost: cost{green: 3, blue: 3, white: 3}},
-	{id: "henry_viii", cost: cost{black: 4, red: 4}},
-	{id: "elisabeth_of_austria", cost: cost{black: 3, blue: 3, white: 3}},
-	{id: "francis_i", cost: cost{black: 3, red: 3, green: 3}},
-})
-
-func cardmap(cs []card) map[string]card {
-	ret := map[string]card{}
-	for i := range cs {
-		ret[cs[i].id] = cs[i]
+// LoadCardSets loads every card set in the given directory, making them
+// available to games. It fails if any of them aren't valid, or if there's no
+// standard set. Games are pinned to the version of the set they started with,
+// so changing a set's cards means bumping its version and moving the old file
+// into an archive directory inside this one, where it's still loaded.
+func LoadCardSets(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
 	}
-	return ret
+	archived, err := filepath.Glob(filepath.Join(dir, "archive", "*.json"))
+	if err != nil {
+		return err
+	}
+
+	sets := map[string]*cardSet{}
+	for _, file := range files {
+		set, err := loadCardSet(file)
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		if sets[set.id] != nil {
+			return fmt.Errorf("%v: duplicate card set id: %v", file, set.id)
+		}
+		sets[set.id] = set
+		sets[set.pinnedID()] = set
+	}
+
+	for _, file := range archived {
+		set, err := loadCardSet(file)
+		if err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		if sets[set.pinnedID()] != nil {
+			return fmt.Errorf("%v: duplicate card set version: %v", file, set.pinnedID())
+		}
+		sets[set.pinnedID()] = set
+	}
+
+	if sets[defaultCardSet] == nil {
+		return fmt.Errorf("no %v card set in %v", defaultCardSet, dir)
+	}
+
+	cardSets = sets
+	return nil
+}
+
+// CardSetFile is the format card sets are stored in.
+type cardSetFile struct {
+	ID      string         `json:"id"`
+	Version string         `json:"version"`
+	Cards   []cardSetCard  `json:"cards"`
+	Nobles  []cardSetNoble `json:"nobles"`
+	Cities  []cardSetCity  `json:"cities"`
+}
+
+type cardSetCard struct {
+	ID      string `json:"id"`
+	Tier    int    `json:"tier"`
+	Color   string `json:"color"`
+	Points  int    `json:"points"`
+	Cost    cost   `json:"cost"`
+	Orient  bool   `json:"orient"`
+	Ability string `json:"ability"`
+}
+
+type cardSetNoble struct {
+	ID     string `json:"id"`
+	Points int    `json:"points"`
+	Cost   cost   `json:"cost"`
+}
+
+type cardSetCity struct {
+	ID     string `json:"id"`
+	Points int    `json:"points"`
+	Cost   cost   `json:"cost"`
+}
+
+func loadCardSet(file string) (*cardSet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	csf := cardSetFile{}
+	if err := dec.Decode(&csf); err != nil {
+		return nil, err
+	}
+
+	return newCardSet(&csf)
 }
 
-var tier1 = cardmap([]card{
-	{id: "1_4_0", color: white, points: 1, cost: cost{green: 4}},
-	{id: "1_4_1", color: green, points: 1, cost: cost{black: 4}},
-	{id: "1_4_2", color: black, points: 1, cost: cost{blue: 4}},
-	{id: "1_4_3", color: blue, points: 1, cost: cost{red: 4}},
-	{id: "1_4_4", color: red, points: 1, cost: cost{white: 4}},
-
-	{id: "1_3_0", color: white, cost: cost{blue: 3}},
-	{id: "1_3_1", color: green, cost: cost{red: 3}},
-	{id: "1_3_2", color: black, cost: cost{green: 3}},
-	{id: "1_3_3", color: blue, cost: cost{black: 3}},
-	{id: "1_3_4", color: red, cost: cost{white: 3}},
-
-	{id: "1_2_1_0", color: white, cost: cost{red: 2, black: 1}},
-	{id: "1_2_1_1", color: green, cost: cost{white: 2, blue: 1}},
-	{id: "1_2_1_2", color: black, cost: cost{green: 2, red: 1}},
-	{id: "1_2_1_3", color: blue, cost: cost{black: 2, white: 1}},
-	{id: "1_2_1_4", color: red, cost: cost{blue: 2, green: 1}},
-
-	{id: "1_22_0", color: white, cost: cost{blue: 2, black: 2}},
-	{id: "1_22_1", color: green, cost: cost{blue: 2, red: 2}},
-	{id: "1_22_2", color: black, cost: cost{white: 2, green: 2}},
-	{id: "1_22_3", color: blue, cost: cost{green: 2, black: 2}},
-	{id: "1_22_4", color: red, cost: cost{white: 2, red: 2}},
-
-	{id: "1_41_0", color: white, cost: cost{blue: 1, green: 1, red: 1, black: 1}},
-	{id: "1_41_1", color: green, cost: cost{blue: 1, white: 1, red: 1, black: 1}},
-	{id: "1_41_2", color: black, cost: cost{blue: 1, green: 1, red: 1, white: 1}},
-	{id: "1_41_3", color: blue, cost: cost{white: 1, green: 1, red: 1, black: 1}},
-	{id: "1_41_4", color: red, cost: cost{blue: 1, green: 1, white: 1, black: 1}},
-
-	{id: "1_3_21_0", color: white, cost: cost{white: 3, blue: 1, black: 1}},
-	{id: "1_3_21_1", color: green, cost: cost{blue: 3, white: 1, green: 1}},
-	{id: "1_3_21_2", color: black, cost: cost{red: 3, green: 1, black: 1}},
-	{id: "1_3_21_3", color: blue, cost: cost{green: 3, red: 1, blue: 1}},
-	{id: "1_3_21_4", color: red, cost: cost{black: 3, red: 1, white: 1}},
-
-	{id: "1_22_1_0", color: white, cost: cost{blue: 2, green: 2, black: 1}},
-	{id: "1_22_1_1", color: green, cost: cost{black: 2, red: 2, blue: 1}},
-	{id: "1_22_1_2", color: black, cost: cost{white: 2, blue: 2, red: 1}},
-	{id: "1_22_1_3", color: blue, cost: cost{red: 2, green: 2, white: 1}},
-	{id: "1_22_1_4", color: red, cost: cost{white: 2, black: 2, green: 1}},
-
-	{id: "1_2_31_0", color: white, cost: cost{green: 2, blue: 1, red: 1, black: 1}},
-	{id: "1_2_31_1", color: green, cost: cost{black: 2, blue: 1, red: 1, white: 1}},
-	{id: "1_2_31_2", color: black, cost: cost{blue: 2, white: 1, red: 1, green: 1}},
-	{id: "1_2_31_3", color: blue, cost: cost{red: 2, white: 1, green: 1, black: 1}},
-	{id: "1_2_31_4", color: red, cost: cost{white: 2, blue: 1, green: 1, black: 1}},
-})
-
-var tier2 = cardmap([]card{
-	{id: "2_6_0", color: white, points: 3, cost: cost{white: 6}},
-	{id: "2_6_1", color: green, points: 3, cost: cost{green: 6}},
-	{id: "2_6_2", color: black, points: 3, cost: cost{black: 6}},
-	{id: "2_6_3", color: blue, points: 3, cost: cost{blue: 6}},
-	{id: "2_6_4", color: red, points: 3, cost: cost{red: 6}},
-
-	{id: "2_5_0", color: white, points: 2, cost: cost{red: 5}},
-	{id: "2_5_1", color: green, points: 2, cost: cost{green: 5}},
-	{id: "2_5_2", color: black, points: 2, cost: cost{white: 5}},
-	{id: "2_5_3", color: blue, points: 2, cost: cost{blue: 5}},
-	{id: "2_5_4", color: red, points: 2, cost: cost{black: 6}},
-
-	{id: "2_5_3_0", color: white, points: 2, cost: cost{red: 5, black: 3}},
-	{id: "2_5_3_1", color: green, points: 2, cost: cost{blue: 5, green: 3}},
-	{id: "2_5_3_2", color: black, points: 2, cost: cost{green: 5, red: 3}},
-	{id: "2_5_3_3", color: blue, points: 2, cost: cost{white: 5, blue: 3}},
-	{id: "2_5_3_4", color: red, points: 2, cost: cost{black: 5, white: 3}},
-
-	{id: "2_4_2_1_0", color: white, points: 2, cost: cost{red: 4, black: 2, green: 1}},
-	{id: "2_4_2_1_1", color: green, points: 2, cost: cost{white: 4, blue: 2, black: 1}},
-	{id: "2_4_2_1_2", color: black, points: 2, cost: cost{green: 4, red: 2, blue: 1}},
-	{id: "2_4_2_1_3", color: blue, points: 2, cost: cost{black: 4, white: 2, red: 1}},
-	{id: "2_4_2_1_4", color: red, points: 2, cost: cost{blue: 4, green: 2, white: 1}},
-
-	{id: "2_3_22_0", color: white, points: 1, cost: cost{green: 3, red: 2, black: 2}},
-	{id: "2_3_22_1", color: green, points: 1, cost: cost{blue: 3, white: 2, black: 2}},
-	{id: "2_3_22_2", color: black, points: 1, cost: cost{white: 3, blue: 2, green: 2}},
-	{id: "2_3_22_3", color: blue, points: 1, cost: cost{red: 3, blue: 2, green: 2}},
-	{id: "2_3_22_4", color: red, points: 1, cost: cost{black: 3, red: 2, white: 2}},
-
-	{id: "2_23_2_0", color: white, points: 1, cost: cost{blue: 3, red: 3, white: 2}},
-	{id: "2_23_2_1", color: green, points: 1, cost: cost{red: 3, white: 3, green: 2}},
-	{id: "2_23_2_2", color: black, points: 1, cost: cost{white: 3, green: 3, black: 2}},
-	{id: "2_23_2_3", color: blue, points: 1, cost: cost{green: 3, black: 3, blue: 2}},
-	{id: "2_23_2_4", color: red, points: 1, cost: cost{blue: 3, black: 3, red: 2}},
-})
-
-var tier3 = cardmap([]card{
-	{id: "3_7_3_0", color: white, points: 5, cost: cost{black: 7, white: 3}},
-	{id: "3_7_3_1", color: green, points: 5, cost: cost{blue: 7, green: 3}},
-	{id: "3_7_3_2", color: black, points: 5, cost: cost{red: 7, black: 3}},
-	{id: "3_7_3_3", color: blue, points: 5, cost: cost{white: 7, blue: 3}},
-	{id: "3_7_3_4", color: red, points: 5, cost: cost{green: 7, red: 3}},
-
-	{id: "3_7_0", color: white, points: 4, cost: cost{black: 7}},
-	{id: "3_7_1", color: green, points: 4, cost: cost{blue: 7}},
-	{id: "3_7_2", color: black, points: 4, cost: cost{red: 7}},
-	{id: "3_7_3", color: blue, points: 4, cost: cost{white: 7}},
-	{id: "3_7_4", color: red, points: 4, cost: cost{green: 7}},
-
-	{id: "3_6_23_0", color: white, points: 4, cost: cost{black: 6, white: 3, red: 3}},
-	{id: "3_6_23_1", color: green, points: 4, cost: cost{blue: 6, green: 3, white: 3}},
-	{id: "3_6_23_2", color: black, points: 4, cost: cost{red: 6, black: 3, green: 3}},
-	{id: "3_6_23_3", color: blue, points: 4, cost: cost{white: 6, blue: 3, black: 3}},
-	{id: "3_6_23_4", color: red, points: 4, cost: cost{green: 6, blue: 3, red: 3}},
-
-	{id: "3_5_33_0", color: white, points: 3, cost: cost{red: 5, blue: 3, green: 3, black: 3}},
-	{id: "3_5_33_1", color: green, points: 3, cost: cost{white: 5, blue: 3, red: 3, black: 3}},
-	{id: "3_5_33_2", color: black, points: 3, cost: cost{green: 5, white: 3, blue: 3, red: 3}},
-	{id: "3_5_33_3", color: blue, points: 3, cost: cost{black: 5, white: 3, green: 3, red: 3}},
-	{id: "3_5_33_4", color: red, points: 3, cost: cost{blue: 5, white: 3, green: 3, black: 3}},
-})
+// NewCardSet builds a card set from its file format, checking that it's
+// something that can actually be played with.
+func newCardSet(f *cardSetFile) (*cardSet, error) {
+	if f.ID == "" {
+		return nil, errors.New("card set has no id")
+	}
+	if f.Version == "" {
+		return nil, errors.New("card set has no version")
+	}
+
+	set := &cardSet{id: f.ID, version: f.Version, nobles: map[string]noble{}, cities: map[string]city{}}
+	for i := 0; i < numTiers; i++ {
+		set.tiers = append(set.tiers, map[string]card{})
+		set.orient = append(set.orient, map[string]card{})
+	}
+
+	for _, c := range f.Cards {
+		if c.ID == "" {
+			return nil, errors.New("card has no id")
+		}
+		if _, ok := set.card(c.ID); ok {
+			return nil, fmt.Errorf("duplicate card id: %v", c.ID)
+		}
+		if c.Tier < 1 || c.Tier > numTiers {
+			return nil, fmt.Errorf("card %v: bad tier %v", c.ID, c.Tier)
+		}
+		switch c.Ability {
+		case "", abilityDouble, abilityReserve, abilityNoble:
+			if !isNormalColor(c.Color) {
+				return nil, fmt.Errorf("card %v: bad color %v", c.ID, c.Color)
+			}
+		case abilityJoker:
+			if c.Color != "" {
+				return nil, fmt.Errorf("card %v: jokers don't have a color", c.ID)
+			}
+		default:
+			return nil, fmt.Errorf("card %v: bad ability %v", c.ID, c.Ability)
+		}
+		if c.Points < 0 {
+			return nil, fmt.Errorf("card %v: negative points", c.ID)
+		}
+		if err := validateCost(c.Cost); err != nil {
+			return nil, fmt.Errorf("card %v: %v", c.ID, err)
+		}
+
+		tiers := set.tiers
+		if c.Orient {
+			tiers = set.orient
+		}
+		tiers[c.Tier-1][c.ID] = card{
+			id:      c.ID,
+			tier:    c.Tier,
+			color:   c.Color,
+			points:  c.Points,
+			cost:    c.Cost,
+			ability: c.Ability,
+		}
+	}
+
+	for _, n := range f.Nobles {
+		if n.ID == "" {
+			return nil, errors.New("noble has no id")
+		}
+		if _, ok := set.nobles[n.ID]; ok {
+			return nil, fmt.Errorf("duplicate noble id: %v", n.ID)
+		}
+		if n.Points < 0 {
+			return nil, fmt.Errorf("noble %v: negative points", n.ID)
+		}
+		if err := validateCost(n.Cost); err != nil {
+			return nil, fmt.Errorf("noble %v: %v", n.ID, err)
+		}
+
+		points := n.Points
+		if points == 0 {
+			points = noblePoints
+		}
+		set.nobles[n.ID] = noble{id: n.ID, points: points, cost: n.Cost}
+	}
+
+	// Cities are optional; only sets that have some can be played in cities mode.
+	for _, c := range f.Cities {
+		if c.ID == "" {
+			return nil, errors.New("city has no id")
+		}
+		if _, ok := set.cities[c.ID]; ok {
+			return nil, fmt.Errorf("duplicate city id: %v", c.ID)
+		}
+		if c.Points <= 0 {
+			return nil, fmt.Errorf("city %v: must need some points", c.ID)
+		}
+		if err := validateCost(c.Cost); err != nil {
+			return nil, fmt.Errorf("city %v: %v", c.ID, err)
+		}
+		set.cities[c.ID] = city{id: c.ID, points: c.Points, cost: c.Cost}
+	}
+
+	// Make sure there's enough of everything to deal out a full table.
+	for i, tier := range set.tiers {
+		if len(tier) < maxCardsPerTier {
+			return nil, fmt.Errorf("tier %v needs at least %v cards", i+1, maxCardsPerTier)
+		}
+	}
+	if len(set.nobles) < maxPlayers+1 {
+		return nil, fmt.Errorf("need at least %v nobles", maxPlayers+1)
+	}
+
+	return set, nil
+}
+
+func validateCost(c cost) error {
+	if len(c) == 0 {
+		return errors.New("no cost")
+	}
+	for color, count := range c {
+		if !isNormalColor(color) {
+			return fmt.Errorf("bad cost color %v", color)
+		}
+		if count <= 0 {
+			return fmt.Errorf("bad cost for %v", color)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package splenda
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if err := LoadCardSets("sets"); err != nil {
+		panic(err)
+	}
+	if err := LoadDuelSets("sets/duel"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestLoadCardSets(t *testing.T) {
+	set := cardSets[defaultCardSet]
+	if set == nil {
+		t.Fatal("no standard card set")
+	}
+	if len(set.tiers[0]) != 40 || len(set.tiers[1]) != 30 || len(set.tiers[2]) != 20 {
+		t.Errorf("bad tier sizes: %v %v %v", len(set.tiers[0]), len(set.tiers[1]), len(set.tiers[2]))
+	}
+	if len(set.nobles) != 10 {
+		t.Errorf("bad number of nobles: %v", len(set.nobles))
+	}
+
+	c, ok := set.card("3_7_3_0")
+	if !ok || c.tier != 3 || c.color != white || c.points != 5 || c.cost[black] != 7 {
+		t.Errorf("bad card: %v", c)
+	}
+	n, ok := set.noble("mary_stuart")
+	if !ok || n.points != noblePoints || n.cost[red] != 4 {
+		t.Errorf("bad noble: %v", n)
+	}
+
+	if err := LoadCardSets("web"); err == nil {
+		t.Error("expected an error loading a directory without a standard set")
+	}
+	if cardSets[defaultCardSet] != set {
+		t.Error("failed load replaced the card sets")
+	}
+}
+
+func TestPinnedCardSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer LoadCardSets("sets")
+
+	// Archive the standard set, then edit one of its nobles and bump its
+	// version.
+	data, err := ioutil.ReadFile("sets/standard.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "archive", "standard.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	csf := cardSetFile{}
+	if err := json.Unmarshal(data, &csf); err != nil {
+		t.Fatal(err)
+	}
+	for i := range csf.Nobles {
+		if csf.Nobles[i].ID == "mary_stuart" {
+			csf.Nobles[i].Cost = cost{red: 3, green: 3, blue: 3}
+		}
+	}
+	csf.Version += ".1"
+	if data, err = json.Marshal(&csf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "standard.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	old := cardSets[defaultCardSet].pinnedID()
+	if err := LoadCardSets(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// New games get the edited set, pinned to its version.
+	current := cardSets[defaultCardSet]
+	state, err := newGameState([]string{"a", "b"}, Options{}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Options.CardSet != current.pinnedID() {
+		t.Errorf("expected the game to be pinned to %v, got %v", current.pinnedID(), state.Options.CardSet)
+	}
+
+	// Games that started before the edit keep playing with the old cards.
+	set, err := getCardSet(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := set.noble("mary_stuart"); n.cost[red] != 4 {
+		t.Errorf("expected the archived noble, got %v", n)
+	}
+	if n, _ := current.noble("mary_stuart"); n.cost[red] != 3 {
+		t.Errorf("expected the edited noble, got %v", n)
+	}
+
+	// An archived file can't reuse a version that's already loaded.
+	if err := ioutil.WriteFile(filepath.Join(dir, "archive", "again.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCardSets(dir); err == nil {
+		t.Error("expected an error loading the same version twice")
+	}
+}
+
+func TestNewCardSet(t *testing.T) {
+	valid := func() *cardSetFile {
+		f := &cardSetFile{ID: "test", Version: "1"}
+		for tier := 1; tier <= numTiers; tier++ {
+			for i := 0; i < maxCardsPerTier; i++ {
+				f.Cards = append(f.Cards, cardSetCard{
+					ID:    fmt.Sprintf("%v_%v", tier, i),
+					Tier:  tier,
+					Color: red,
+					Cost:  cost{blue: 1},
+				})
+			}
+		}
+		for i := 0; i <= maxPlayers; i++ {
+			f.Nobles = append(f.Nobles, cardSetNoble{
+				ID:   fmt.Sprintf("noble_%v", i),
+				Cost: cost{green: 3},
+			})
+		}
+		return f
+	}
+
+	if _, err := newCardSet(valid()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]func(f *cardSetFile){
+		"no id":          func(f *cardSetFile) { f.ID = "" },
+		"no version":     func(f *cardSetFile) { f.Version = "" },
+		"duplicate card": func(f *cardSetFile) { f.Cards[1].ID = f.Cards[0].ID },
+		"bad tier":       func(f *cardSetFile) { f.Cards[0].Tier = 4 },
+		"bad color":      func(f *cardSetFile) { f.Cards[0].Color = wild },
+		"no cost":        func(f *cardSetFile) { f.Cards[0].Cost = nil },
+		"bad ability":    func(f *cardSetFile) { f.Cards[0].Ability = "fly" },
+		"colored joker":  func(f *cardSetFile) { f.Cards[0].Ability = abilityJoker },
+		"bad cost":       func(f *cardSetFile) { f.Nobles[0].Cost = cost{"purple": 1} },
+		"too few cards":  func(f *cardSetFile) { f.Cards = f.Cards[1:] },
+		"too few nobles": func(f *cardSetFile) { f.Nobles = f.Nobles[1:] },
+	}
+	for name, breakit := range tests {
+		f := valid()
+		breakit(f)
+		if _, err := newCardSet(f); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/lib/pq v1.3.0
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
+	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e
 )
@@ -3,13 +3,19 @@ package splenda
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"math/rand"
+	"sort"
+	"strconv"
+	"time"
 )
 
 // Impl implements Splenda's game logic.
 type Impl struct {
-	db  *DB
-	rng rng
+	db     *DB
+	rng    rng
+	clock  clock
+	notify *notifier
 }
 
 type realrng struct{}
@@ -21,34 +27,58 @@ func (realrng) Intn(n int) int {
 // NewImpl creates a new Impl.
 func NewImpl(db *DB) *Impl {
 	return &Impl{
-		db:  db,
-		rng: realrng{},
+		db:     db,
+		rng:    realrng{},
+		clock:  realclock{},
+		notify: newNotifier(),
 	}
 }
 
 // NewImplSeed creates a new impl with the given psuedorandom seed.
 func NewImplSeed(db *DB, seed int64) *Impl {
 	return &Impl{
-		db:  db,
-		rng: rand.New(rand.NewSource(seed)),
+		db:     db,
+		rng:    rand.New(rand.NewSource(seed)),
+		clock:  realclock{},
+		notify: newNotifier(),
 	}
 }
 
-// ListGames lists all the games that the given user is in.
-func (i *Impl) ListGames(userID string) ([]*GameSummary, error) {
-	games, err := i.db.ListGames(userID)
+// CheckCardSets makes sure every card set an unfinished game was pinned to,
+// Splendor Duel ones included, is loaded, so a set that's been edited
+// without archiving its old version is caught at startup rather than
+// breaking the games mid-play.
+func (i *Impl) CheckCardSets() error {
+	ids, err := i.db.ListCardSets()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	ret := []*GameSummary{}
-	for gameID, players := range games {
-		ret = append(ret, &GameSummary{
-			ID:      gameID,
-			Players: players,
-		})
+	missing := []string{}
+	for _, id := range ids {
+		if _, err := getCardSet(id); err != nil {
+			missing = append(missing, id)
+		}
 	}
-	return ret, nil
+
+	ids, err = i.db.ListDuelSets()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := getDuelSet(id); err != nil {
+			missing = append(missing, "duel "+id)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("games in progress use card sets that aren't loaded: %v", missing)
+	}
+	return nil
+}
+
+// ListGames lists all the games that the given user is in.
+func (i *Impl) ListGames(userID string) ([]*GameSummary, error) {
+	return i.db.ListGames(userID)
 }
 
 func newID() string {
@@ -59,35 +89,37 @@ func newID() string {
 	return base64.URLEncoding.EncodeToString(bs)
 }
 
-func numCoins(players []string) int {
-	switch len(players) {
-	case 2:
-		return 4
-	case 3:
-		return 5
-	case 4:
-		return 7
-	default:
-		panic("weird number of players")
-	}
-}
-
-// NewGame creates a new game.
-func (i *Impl) NewGame(userID string, players []string) (string, error) {
+// NewGame creates a new game, with optional house rules and time controls.
+func (i *Impl) NewGame(userID string, players []string, opts *Options, tc *TimeControl) (string, error) {
 	if find(userID, players) == -1 {
 		return "", errors.New("you must be one of the players")
 	}
 	if len(players) < 2 {
 		return "", errors.New("need at least two players")
 	}
-	if len(players) > 4 {
-		return "", errors.New("no more than four players")
+	if len(players) > maxPlayers {
+		return "", fmt.Errorf("no more than %v players", maxPlayers)
 	}
 	if !unique(players) {
 		return "", errors.New("players must be unique")
 	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	if err := validateOptions(opts); err != nil {
+		return "", err
+	}
+	if tc != nil {
+		if err := validateTimeControl(tc); err != nil {
+			return "", err
+		}
+	}
 
 	gameID := newID()
+	state, err := newGameState(players, *opts, i.rng)
+	if err != nil {
+		return "", err
+	}
 
 	tx, err := i.db.NewTX(gameID)
 	if err != nil {
@@ -95,52 +127,80 @@ func (i *Impl) NewGame(userID string, players []string) (string, error) {
 	}
 	defer tx.Close()
 
-	players = shuffle(players, i.rng)
+	// Set up the game and player records themselves.
+	if err := tx.InsertGame(state.Current, *opts); err != nil {
+		return "", err
+	}
+	if tc != nil {
+		if err := tx.UpdateTimeControl(tc, i.clock.Now()); err != nil {
+			return "", err
+		}
+	}
 
-	// Set up the game table itself.
-	if err := tx.InsertGame(players[0]); err != nil {
+	ids := []string{}
+	for _, p := range state.Players {
+		ids = append(ids, p.ID)
+	}
+	if err := tx.InsertPlayers(ids); err != nil {
 		return "", err
 	}
 
-	nc := numCoins(players)
-	coins := map[string]int{
-		red:   nc,
-		blue:  nc,
-		green: nc,
-		black: nc,
-		white: nc,
-		wild:  5,
+	// Then deal out the table, keeping a copy so the game can be replayed.
+	if err := tx.InsertState(state); err != nil {
+		return "", err
 	}
-	if err := tx.InsertCoins(coins); err != nil {
+	if err := tx.InsertStart(state); err != nil {
 		return "", err
 	}
 
-	nobles := pickNobles(len(players)+1, i.rng)
-	if err := tx.InsertNobles(nobles); err != nil {
+	if err := tx.Commit(); err != nil {
 		return "", err
 	}
 
-	t1 := shuffleCards(tier1, i.rng)
-	t2 := shuffleCards(tier2, i.rng)
-	t3 := shuffleCards(tier3, i.rng)
+	return gameID, nil
+}
+
+// NewDuel creates a new game of Splendor Duel between two players.
+func (i *Impl) NewDuel(userID string, players []string) (string, error) {
+	if find(userID, players) == -1 {
+		return "", errors.New("you must be one of the players")
+	}
+	if len(players) != numDuelPlayers {
+		return "", fmt.Errorf("need exactly %v players", numDuelPlayers)
+	}
+	if !unique(players) {
+		return "", errors.New("players must be unique")
+	}
+
+	gameID := newID()
+	state, err := newDuelState(players, i.rng)
+	if err != nil {
+		return "", err
+	}
 
-	if err := tx.InsertCards(t1[:4], t2[:4], t3[:4]); err != nil {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
 		return "", err
 	}
-	if err := tx.InsertDecks(t1[4:], t2[4:], t3[4:]); err != nil {
+	defer tx.Close()
+
+	if err := tx.InsertDuelGame(state.Current); err != nil {
 		return "", err
 	}
 
-	// Set up the players.
-	if err := tx.InsertPlayers(players); err != nil {
+	ids := []string{}
+	for _, p := range state.Players {
+		ids = append(ids, p.ID)
+	}
+	if err := tx.InsertPlayers(ids); err != nil {
 		return "", err
 	}
 
-	allcolors := []string{red, blue, green, black, white, wild}
-	for _, player := range players {
-		if err := tx.InsertPlayerCoins(player, allcolors); err != nil {
-			return "", err
-		}
+	if err := tx.InsertDuelState(state); err != nil {
+		return "", err
+	}
+	if err := tx.InsertStart(state); err != nil {
+		return "", err
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -150,8 +210,109 @@ func (i *Impl) NewGame(userID string, players []string) (string, error) {
 	return gameID, nil
 }
 
-// GetGame gets the current state of a given game.
-func (i *Impl) GetGame(gameID string, userID string, ts string) (*Game, error) {
+// GetGame gets the current state of a given game, of whichever type, as
+// the given user is allowed to see it. Users who aren't playing can watch
+// any game but a sandbox. If version is the game's current version it
+// returns ErrNotModified instead.
+func (i *Impl) GetGame(gameID string, userID string, version string) (*Game, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	if !tx.CanWatch(userID) {
+		return nil, errors.New("no such game")
+	}
+
+	basics, err := tx.GetGameBasics()
+	if err != nil {
+		return nil, err
+	}
+	current, err := tx.GetVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && version == current {
+		return nil, ErrNotModified
+	}
+
+	if basics.Type == gameDuel {
+		game, err := i.getDuel(tx, gameID, userID)
+		if err != nil {
+			return nil, err
+		}
+		game.Sandbox = basics.Sandbox
+		game.Version = current
+		return game, nil
+	}
+
+	state, err := tx.LoadState()
+	if err != nil {
+		return nil, err
+	}
+
+	mover, requested, before, err := tx.GetUndo()
+	if err != nil {
+		return nil, err
+	}
+
+	votes, err := tx.GetDeleteVotes()
+	if err != nil {
+		return nil, err
+	}
+
+	tc, started, err := tx.GetTimeControl()
+	if err != nil {
+		return nil, err
+	}
+	used, err := tx.GetTimeUsed()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	game, err := getGame(gameID, state)
+	if err != nil {
+		return nil, err
+	}
+	game.Sandbox = basics.Sandbox
+	game.Version = current
+
+	if len(votes) > 0 {
+		game.DeleteVotes = votes
+	}
+
+	if tc != nil {
+		game.TimeControl = tc
+		game.TimeLeft = map[string]int{}
+		for id, left := range timeLeft(tc, state, started, used, i.clock.Now()) {
+			game.TimeLeft[id] = int(left / time.Second)
+		}
+	}
+
+	if before != nil {
+		game.Undo = &Undo{
+			Player:    mover,
+			Responder: state.NextSeat(mover),
+			Requested: requested,
+		}
+	}
+
+	return view(game, userID), nil
+}
+
+// Pass passes the turn when the current player has no legal move.
+func (i *Impl) Pass(gameID string, userID string) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: movePass})
+}
+
+// LegalMoves lists the moves the given user could legally make right now.
+func (i *Impl) LegalMoves(gameID string, userID string) ([]Move, error) {
 	tx, err := i.db.NewTX(gameID)
 	if err != nil {
 		return nil, err
@@ -162,82 +323,210 @@ func (i *Impl) GetGame(gameID string, userID string, ts string) (*Game, error) {
 		return nil, errors.New("no such game")
 	}
 
-	game, err := tx.GetGameBasics()
+	state, err := tx.LoadState()
+	if err != nil {
+		return nil, err
+	}
+	seat, err := actingAs(tx, userID, state.Current)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Do something different if ts is current?
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return LegalMoves(state, seat), nil
+}
 
-	table, err := getTable(tx)
+// History lists every move made in a game so far.
+func (i *Impl) History(gameID string, userID string) ([]*HistoryEntry, error) {
+	tx, err := i.db.NewTX(gameID)
 	if err != nil {
 		return nil, err
 	}
-	game.Table = table
+	defer tx.Close()
 
-	players, err := getPlayers(tx)
+	if !tx.IsPlaying(userID) {
+		return nil, errors.New("no such game")
+	}
+
+	history, err := tx.GetHistory()
 	if err != nil {
 		return nil, err
 	}
-	game.Players = players
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return game, nil
+	return history, nil
 }
 
-// DeleteGame deletes a game.
-func (i *Impl) DeleteGame(gameID string, userID string) error {
+// Watch returns a game's current timestamp and version, and a channel that
+// gets each new one as the game changes, along with a function to call once
+// done watching.
+func (i *Impl) Watch(gameID string, userID string) (*Change, <-chan Change, func(), error) {
+	// Start watching first so nothing slips by between reading the
+	// version and the first notification.
+	updates, stop := i.notify.Watch(gameID)
+
 	tx, err := i.db.NewTX(gameID)
 	if err != nil {
-		return err
+		stop()
+		return nil, nil, nil, err
+	}
+	defer tx.Close()
+
+	if !tx.CanWatch(userID) {
+		stop()
+		return nil, nil, nil, errors.New("no such game")
+	}
+
+	basics, err := tx.GetGameBasics()
+	if err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+	version, err := tx.GetVersion()
+	if err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+
+	return &Change{basics.TS, version}, updates, stop, nil
+}
+
+// GetDuel gets the current state of a Splendor Duel game.
+func (i *Impl) getDuel(tx *TX, gameID string, userID string) (*Game, error) {
+	state, err := tx.LoadDuelState()
+	if err != nil {
+		return nil, err
+	}
+
+	votes, err := tx.GetDeleteVotes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	game, err := getDuelGame(gameID, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(votes) > 0 {
+		game.DeleteVotes = votes
+	}
+
+	return view(game, userID), nil
+}
+
+// LegalDuelMoves lists the moves the given user could legally make right now
+// in a Splendor Duel game.
+func (i *Impl) LegalDuelMoves(gameID string, userID string) ([]DuelMove, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return nil, err
 	}
 	defer tx.Close()
 
 	if !tx.IsPlaying(userID) {
-		return errors.New("no such game")
+		return nil, errors.New("no such game")
 	}
 
-	if err := tx.DeleteGame(); err != nil {
-		return err
+	state, err := tx.LoadDuelState()
+	if err != nil {
+		return nil, err
+	}
+	seat, err := actingAs(tx, userID, state.Current)
+	if err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return LegalDuelMoves(state, seat), nil
 }
 
-// Take3 takes three coins of different colors.
-func (i *Impl) Take3(gameID string, userID string, colors []string) (string, error) {
-	if len(colors) == 0 || len(colors) > 3 {
-		return "", errors.New("must specify three colors")
+// DuelMove makes a move in a Splendor Duel game.
+func (i *Impl) DuelMove(gameID string, userID string, move DuelMove) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.MoveDuel(move)
+}
+
+// DeleteGame deletes a game once it's over. Until then it only records the
+// player's vote, and the game is deleted when every player still in it has
+// voted. Returns true if the game was actually deleted.
+func (i *Impl) DeleteGame(gameID string, userID string) (bool, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return false, err
 	}
-	for _, c := range colors {
-		if !isNormalColor(c) {
-			return "", errors.New("invalid coin color")
-		}
+	defer tx.Close()
+
+	if !tx.IsPlaying(userID) {
+		return false, errors.New("no such game")
 	}
-	if !unique(colors) {
-		return "", errors.New("colors must be unique")
+	over, active, err := getActive(tx)
+	if err != nil {
+		return false, err
+	}
+	owner, err := tx.GetSandbox()
+	if err != nil {
+		return false, err
 	}
 
-	m := mover{gameID: gameID, userID: userID, db: i.db}
-	return m.Move(func(tx *TX) (string, string, error) {
-		if m.State() != play {
-			return "", "", errors.New("can't do that right now")
+	// Only the owner has a say over a sandbox.
+	deleted := over || owner != ""
+	if !deleted {
+		if err := tx.UpdateDeleteVote(userID); err != nil {
+			return false, err
 		}
 
-		delta := map[string]int{}
-		for _, c := range colors {
-			delta[c] = 1
+		votes, err := tx.GetDeleteVotes()
+		if err != nil {
+			return false, err
 		}
 
-		if err := m.EarnCoins(tx, delta, delta); err != nil {
-			return "", "", err
+		deleted = true
+		for _, id := range active {
+			if find(id, votes) == -1 {
+				deleted = false
+			}
 		}
+	}
 
-		return m.NextPlayer()
-	})
+	if deleted {
+		if err := tx.DeleteGame(); err != nil {
+			return false, err
+		}
+	}
+
+	return deleted, tx.Commit()
+}
+
+// Resign drops out of a game. It can be done at any time, not just on the
+// player's turn.
+func (i *Impl) Resign(gameID string, userID string) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: moveResign})
+}
+
+// Take3 takes three coins of different colors.
+func (i *Impl) Take3(gameID string, userID string, colors []string) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: moveTake3, Colors: colors})
 }
 
 func unique(strs []string) bool {
@@ -248,237 +537,322 @@ func unique(strs []string) bool {
 	return len(set) == len(strs)
 }
 
-// Take2 takes two coins of the same color.
-func (i *Impl) Take2(gameID string, userID string, color string) (string, error) {
-	if !isNormalColor(color) {
-		return "", errors.New("invalid coin color")
+// Take2 takes two coins of the same color, plus an extra coin if extra is
+// set.
+func (i *Impl) Take2(gameID string, userID string, color string, extra string) (string, error) {
+	colors := []string{color}
+	if extra != "" {
+		colors = append(colors, extra)
 	}
 
-	m := mover{gameID: gameID, userID: userID, db: i.db}
-	return m.Move(func(tx *TX) (string, string, error) {
-		if m.State() != play {
-			return "", "", errors.New("can't do that right now")
-		}
-
-		limit := map[string]int{color: 4}
-		delta := map[string]int{color: 2}
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: moveTake2, Colors: colors})
+}
 
-		if err := m.EarnCoins(tx, limit, delta); err != nil {
-			return "", "", err
-		}
+// Reserve reserves a face-up card, from the Orient row if orient is set.
+func (i *Impl) Reserve(gameID string, userID string, tier int, index int, orient bool) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: moveReserve, Tier: tier, Index: index, Orient: orient})
+}
 
-		return m.NextPlayer()
-	})
+// ReserveTop reserves the top card of one of the decks, without revealing it
+// to the other players.
+func (i *Impl) ReserveTop(gameID string, userID string, tier int, orient bool) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: moveReserve, Tier: tier, Deck: true, Orient: orient})
 }
 
-// Reserve reserves a card.
-func (i *Impl) Reserve(gameID string, userID string, tier int, index int) (string, error) {
-	m := mover{gameID: gameID, userID: userID, db: i.db}
-	return m.Move(func(tx *TX) (string, string, error) {
-		if m.State() != play {
-			return "", "", errors.New("can't do that right now")
-		}
+// Buy buys a card, from the Orient row if orient is set. If payment is nil,
+// the cheapest way to pay is worked out automatically. Joker cards need the
+// color they're copying.
+func (i *Impl) Buy(gameID string, userID string, tier int, index int, orient bool, payment map[string]int, joker string) (string, error) {
+	move := Move{Type: moveBuy, Tier: tier, Index: index, Orient: orient, Coins: payment}
+	if joker != "" {
+		move.Colors = []string{joker}
+	}
 
-		// Make sure the player does not already have too many reserved cards.
-		_, reservedIDs, err := tx.GetPlayerCards(userID)
-		if err != nil {
-			return "", "", err
-		}
-		if len(reservedIDs) >= 3 {
-			return "", "", errors.New("too many cards already reserved")
-		}
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(move)
+}
 
-		// Grab the ID of the card that's currently in that position.
-		// TODO: Handle reserving directly off the top of the deck.
-		card, err := m.GetCardID(tx, tier, index)
-		if err != nil {
-			return "", "", err
-		}
+// PickNoble claims one of the nobles the current player can afford, or any
+// noble if they just bought a card that claims one.
+func (i *Impl) PickNoble(gameID string, userID string, nobleID string) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: movePickNoble, Noble: nobleID})
+}
 
-		// Insert it to the player's hand.
-		reserved := true
-		if err := tx.InsertPlayerCard(userID, card, reserved); err != nil {
-			return "", "", err
-		}
+// ReturnCoins returns coins to the bank when the current player is holding
+// too many.
+func (i *Impl) ReturnCoins(gameID string, userID string, coins map[string]int) (string, error) {
+	m := mover{gameID: gameID, userID: userID, db: i.db, clock: i.clock, notify: i.notify}
+	return m.Move(Move{Type: moveReturnCoins, Coins: coins})
+}
 
-		// Replace it on the board.
-		if err := m.DealCard(tx, tier, index); err != nil {
-			return "", "", err
+// RequestUndo asks to take back the last move, which must have been made by
+// the given user. The next player gets to accept or decline. Nothing's been
+// moved, so the timestamp stays the same; only the game's version changes.
+func (i *Impl) RequestUndo(gameID string, userID string) (string, error) {
+	return i.undo(gameID, func(tx *TX, state *GameState, u *undo) (string, error) {
+		if u.mover != userID || u.requested {
+			return "", errors.New("can't do that right now")
 		}
-
-		// Give the player a wildcard coin if we can.
-		delta := map[string]int{wild: 1}
-		err = m.EarnCoins(tx, delta, delta)
-		if err != nil && err != ErrInsufficientCoins {
-			return "", "", err
+		if u.unresigns(state) {
+			return "", errors.New("can't take back a move from before someone resigned")
 		}
-
-		return m.NextPlayer()
+		if err := tx.UpdateUndo(true); err != nil {
+			return "", err
+		}
+		return strconv.Itoa(state.TS), nil
 	})
 }
 
-// Buy buys a card.
-func (i *Impl) Buy(gameID string, userID string, tier int, index int) (string, error) {
-	m := mover{gameID: gameID, userID: userID, db: i.db}
-	return m.Move(func(tx *TX) (string, string, error) {
-		if m.State() != play {
-			return "", "", errors.New("can't do that right now")
+// AcceptUndo agrees to take back the last move, putting the game back exactly
+// the way it was before it was made, timestamp and all.
+func (i *Impl) AcceptUndo(gameID string, userID string) (string, error) {
+	return i.undo(gameID, func(tx *TX, state *GameState, u *undo) (string, error) {
+		if !u.requested || state.NextSeat(u.mover) != userID {
+			return "", errors.New("can't do that right now")
 		}
-
-		// Grab the card that's currently in that position.
-		cardID, err := m.GetCardID(tx, tier, index)
-		if err != nil {
-			return "", "", err
+		if u.unresigns(state) {
+			return "", errors.New("can't take back a move from before someone resigned")
 		}
-		card, ok := cardFromID(cardID)
-		if !ok {
-			return "", "", errors.New("bogus card ID")
+		if err := tx.RestoreState(state.TS, u.before); err != nil {
+			return "", err
 		}
-
-		// Get the current card count.
-		cards, err := m.GetCardCounts(tx)
+		// Nobody gets their time back, but the restored turn starts afresh.
+		if err := tx.UpdateTurnStarted(i.clock.Now()); err != nil {
+			return "", err
+		}
+		if err := tx.DeleteUndo(); err != nil {
+			return "", err
+		}
+		// The history keeps the move, but notes that it was taken back.
+		err := tx.InsertMove(&HistoryEntry{
+			TS:     u.before.TS,
+			Time:   i.clock.Now(),
+			Player: u.mover,
+			Type:   moveUndo,
+		})
 		if err != nil {
-			return "", "", err
+			return "", err
 		}
+		return strconv.Itoa(u.before.TS), nil
+	})
+}
 
-		// Pay the cost of the card.
-		if err := m.PayCost(tx, cards, card.cost); err != nil {
-			return "", "", err
+// DeclineUndo refuses to take back the last move. Like RequestUndo, it leaves
+// the timestamp alone.
+func (i *Impl) DeclineUndo(gameID string, userID string) (string, error) {
+	return i.undo(gameID, func(tx *TX, state *GameState, u *undo) (string, error) {
+		if !u.requested || state.NextSeat(u.mover) != userID {
+			return "", errors.New("can't do that right now")
+		}
+		if err := tx.DeleteUndo(); err != nil {
+			return "", err
 		}
+		return strconv.Itoa(state.TS), nil
+	})
+}
 
-		reserved := false
-		if tier > 0 {
-			// Insert it to the player's hand.
-			if err := tx.InsertPlayerCard(userID, cardID, reserved); err != nil {
-				return "", "", err
-			}
+// An undo describes the move that can currently be taken back.
+type undo struct {
+	mover     string
+	requested bool
+	before    *GameState
+}
 
-			// Replace it on the board.
-			if err := m.DealCard(tx, tier, index); err != nil {
-				return "", "", err
-			}
-		} else {
-			// Simply convert it to un-reserved.
-			if err := tx.UpdatePlayerCard(userID, cardID, reserved); err != nil {
-				return "", "", err
-			}
+// Unresigns returns whether taking the move back would bring back a player
+// who has resigned since it was made.
+func (u *undo) unresigns(state *GameState) bool {
+	for _, p := range state.Players {
+		if b := u.before.Player(p.ID); p.Resigned && b != nil && !b.Resigned {
+			return true
 		}
-		cards[card.color]++
-
-		return nextState(&m, tx, cards)
-	})
+	}
+	return false
 }
 
-//
-// Helper functions.
-//
+// An undofunc implements one step of taking back a move, returning the new
+// timestamp for the game.
+type undofunc func(tx *TX, state *GameState, u *undo) (string, error)
+
+// Undo executes the overall workflow of a takeback transaction.
+func (i *Impl) undo(gameID string, step undofunc) (string, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Close()
 
-// NextState returns the next state to transition to after a player buys a card.
-func nextState(m *mover, tx *TX, cards map[string]int) (string, string, error) {
-	// Does this player now have enough cards to pick a noble? If yes, give them
-	// time to pick one.
-	can, err := m.CanAffordNoble(tx, cards)
+	state, err := tx.LoadState()
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-	if can {
-		return picknoble, m.userID, nil
+
+	// Not every step moves the timestamp on, so lock the game to keep them
+	// from racing each other or a move.
+	if err := tx.LockGame(state.TS); err != nil {
+		return "", err
 	}
 
-	// Is this the last player, and if so has someone won the game? If so
-	// stop playing and let them know they won.
-	over, err := isGameOver(tx)
+	owner, err := tx.GetSandbox()
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-	if over {
-		return gameover, m.userID, nil
+	if owner != "" {
+		return "", errors.New("sandboxes are rewound, not taken back")
 	}
 
-	// Otherwise just go to the next player's turn.
-	return m.NextPlayer()
+	mover, requested, before, err := tx.GetUndo()
+	if err != nil {
+		return "", err
+	}
+	if before == nil {
+		return "", errors.New("no move to take back")
+	}
+
+	ts, err := step(tx, state, &undo{mover, requested, before})
+	if err != nil {
+		return "", err
+	}
+
+	version, err := tx.GetVersion()
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	i.notify.Notify(gameID, Change{ts, version})
+
+	return ts, nil
 }
 
-// IsGameOver returns true if the game is now over.
-func isGameOver(tx *TX) (bool, error) {
-	players, err := getPlayers(tx)
+//
+// Helper functions.
+//
+
+// GetActive returns whether a game of either type is over, and the players
+// who are still in it.
+func getActive(tx *TX) (bool, []string, error) {
+	basics, err := tx.GetGameBasics()
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 
-	for _, p := range players {
-		if p.Points >= 15 {
-			return true, nil
+	active := []string{}
+	if basics.Type == gameDuel {
+		state, err := tx.LoadDuelState()
+		if err != nil {
+			return false, nil, err
+		}
+		for _, p := range state.Players {
+			if !p.Resigned {
+				active = append(active, p.ID)
+			}
 		}
+		return state.State == gameover, active, nil
 	}
 
-	return false, nil
+	state, err := tx.LoadState()
+	if err != nil {
+		return false, nil, err
+	}
+	for _, p := range state.Active() {
+		active = append(active, p.ID)
+	}
+	return state.State == gameover, active, nil
 }
 
-// GetTable gets information about the table.
-func getTable(tx *TX) (*Table, error) {
-	coins, err := tx.GetCoins()
+// GetGame builds the Game DTO for the given state, with everything visible.
+// Pass it through view before handing it to anyone.
+func getGame(gameID string, state *GameState) (*Game, error) {
+	table, err := getTable(state)
 	if err != nil {
 		return nil, err
 	}
 
-	nobleIDs, err := tx.GetNobles()
+	players, err := getPlayers(state)
 	if err != nil {
 		return nil, err
 	}
-	nobles, err := ToNobles(nobleIDs)
-	if err != nil {
-		return nil, err
+
+	opts := state.Options
+	game := &Game{
+		ID:      gameID,
+		TS:      strconv.Itoa(state.TS),
+		State:   state.State,
+		Current: state.Current,
+		Options: &opts,
+		Table:   table,
+		Players: players,
+	}
+
+	if game.State == gameover {
+		game.Standings = rank(players)
+		game.Winner = winner(game.Standings)
 	}
 
-	cards, err := getCards(tx)
+	return game, nil
+}
+
+// GetTable gets information about the table.
+func getTable(state *GameState) (*Table, error) {
+	set := state.Options.CardSet
+	nobles, err := ToNobles(set, state.Nobles)
 	if err != nil {
 		return nil, err
 	}
 
-	decks, err := tx.GetDecks()
+	cities, err := ToCities(set, state.Cities)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Table{
-		Coins:  coins,
-		Nobles: nobles,
-		Cards:  cards,
-		Decks:  decks,
-	}, nil
-}
-
-// GetCards gets the cards currently on the table.
-func getCards(tx *TX) ([][]*Card, error) {
 	cards := [][]*Card{}
-	for tier := 1; tier <= 3; tier++ {
-		ids, err := tx.GetCards(tier)
+	for _, ids := range state.Cards {
+		row, err := ToCards(set, ids)
 		if err != nil {
 			return nil, err
 		}
+		cards = append(cards, row)
+	}
 
-		row, err := ToCards(ids)
+	decks := []int{}
+	for _, deck := range state.Decks {
+		decks = append(decks, len(deck))
+	}
+
+	var orient [][]*Card
+	var orientDecks []int
+	for i, ids := range state.Orient {
+		row, err := ToCards(set, ids)
 		if err != nil {
 			return nil, err
 		}
-
-		cards = append(cards, row)
+		orient = append(orient, row)
+		orientDecks = append(orientDecks, len(state.OrientDecks[i]))
 	}
-	return cards, nil
+
+	return &Table{
+		Coins:       state.Coins,
+		Nobles:      nobles,
+		Cities:      cities,
+		Cards:       cards,
+		Decks:       decks,
+		Orient:      orient,
+		OrientDecks: orientDecks,
+	}, nil
 }
 
 // GetPlayers gets data about the players in this game.
-func getPlayers(tx *TX) ([]*Player, error) {
-	userIDs, err := tx.GetPlayers()
-	if err != nil {
-		return nil, err
-	}
-
+func getPlayers(state *GameState) ([]*Player, error) {
 	players := []*Player{}
 
-	for _, userID := range userIDs {
-		player, err := getPlayer(tx, userID)
+	for _, p := range state.Players {
+		player, err := getPlayer(state.Options.CardSet, p)
 		if err != nil {
 			return nil, err
 		}
@@ -488,55 +862,68 @@ func getPlayers(tx *TX) ([]*Player, error) {
 	return players, nil
 }
 
-// GetPlayer gets data about the given player.
-func getPlayer(tx *TX, userID string) (*Player, error) {
-	coins, err := tx.GetPlayerCoins(userID)
+// GetPlayer gets data about the given player, marking the cards they
+// reserved blind as hidden.
+func getPlayer(set string, p *PlayerState) (*Player, error) {
+	nobles, err := ToNobles(set, p.Nobles)
 	if err != nil {
 		return nil, err
 	}
 
-	nobleIDs, err := tx.GetPlayerNobles(userID)
+	cards, err := partitionCards(set, p.Cards, p.Jokers)
 	if err != nil {
 		return nil, err
 	}
-	nobles, err := ToNobles(nobleIDs)
+	reserved, err := ToCards(set, p.Reserved)
 	if err != nil {
 		return nil, err
 	}
 
-	cardIDs, reservedIDs, err := tx.GetPlayerCards(userID)
-	if err != nil {
-		return nil, err
+	for _, card := range reserved {
+		card.Hidden = find(card.ID, p.Hidden) != -1
 	}
-	cards, err := partitionCards(cardIDs)
-	if err != nil {
-		return nil, err
+
+	var city *City
+	if p.City != "" {
+		cities, err := ToCities(set, []string{p.City})
+		if err != nil {
+			return nil, err
+		}
+		city = cities[0]
 	}
-	reserved, err := ToCards(reservedIDs)
+
+	posts, err := ToPosts(p.Posts)
 	if err != nil {
 		return nil, err
 	}
 
-	points := score(nobles, cards)
+	points := score(nobles, cards, posts)
 
 	return &Player{
-		ID:       userID,
-		Coins:    coins,
+		ID:       p.ID,
+		Coins:    p.Coins,
 		Nobles:   nobles,
 		Cards:    cards,
 		Reserved: reserved,
 		Points:   points,
+		Resigned: p.Resigned,
+		City:     city,
+		Posts:    posts,
 	}, nil
 }
 
-// Partition partitions a player's cards by color.
-func partitionCards(ids []string) (map[string][]*Card, error) {
+// Partition partitions a player's cards by color, counting jokers as the
+// color they copy.
+func partitionCards(set string, ids []string, jokers map[string]string) (map[string][]*Card, error) {
 	ret := map[string][]*Card{}
 	for _, id := range ids {
-		card, err := ToCard(id)
+		card, err := ToCard(set, id)
 		if err != nil {
 			return nil, err
 		}
+		if color, ok := jokers[id]; ok {
+			card.Color = color
+		}
 
 		ret[card.Color] = append(ret[card.Color], card)
 	}
@@ -544,8 +931,12 @@ func partitionCards(ids []string) (map[string][]*Card, error) {
 }
 
 // Score calculates the current score for a player.
-func score(nobles []*Noble, cards map[string][]*Card) int {
-	points := 0
+func score(nobles []*Noble, cards map[string][]*Card, posts []*Post) int {
+	ids := []string{}
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	points := postPoints(ids)
 
 	for _, noble := range nobles {
 		points += noble.Points
@@ -559,3 +950,164 @@ func score(nobles []*Noble, cards map[string][]*Card) int {
 
 	return points
 }
+
+// Rank calculates the final standings for a game. Players are ranked by
+// points, with ties going to the player who purchased the fewest cards.
+// Anyone who resigned ranks below everyone who didn't, and in cities mode
+// anyone who qualified for a city ranks above everyone who didn't.
+func rank(players []*Player) []*Standing {
+	ret := []*Standing{}
+	for _, p := range players {
+		cards := 0
+		for _, row := range p.Cards {
+			cards += len(row)
+		}
+
+		s := &Standing{
+			ID:       p.ID,
+			Points:   p.Points,
+			Cards:    cards,
+			Resigned: p.Resigned,
+		}
+		if p.City != nil {
+			s.City = p.City.ID
+		}
+		ret = append(ret, s)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Resigned != ret[j].Resigned {
+			return !ret[i].Resigned
+		}
+		if (ret[i].City == "") != (ret[j].City == "") {
+			return ret[i].City != ""
+		}
+		if ret[i].Points != ret[j].Points {
+			return ret[i].Points > ret[j].Points
+		}
+		return ret[i].Cards < ret[j].Cards
+	})
+
+	for i, s := range ret {
+		s.Rank = i + 1
+		if i > 0 && s.Points == ret[i-1].Points && s.Cards == ret[i-1].Cards &&
+			s.Resigned == ret[i-1].Resigned && (s.City == "") == (ret[i-1].City == "") {
+			s.Rank = ret[i-1].Rank
+		}
+	}
+
+	return ret
+}
+
+// Winner returns the ID of the winning player, or "" if the top spot is
+// shared.
+func winner(standings []*Standing) string {
+	if len(standings) == 0 {
+		return ""
+	}
+	if len(standings) > 1 && standings[1].Rank == 1 {
+		return ""
+	}
+	return standings[0].ID
+}
+
+// GetDuelGame builds the Game DTO for the given Splendor Duel state, with
+// everything visible.
+func getDuelGame(gameID string, state *DuelState) (*Game, error) {
+	set, err := getDuelSet(state.CardSet)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := [][]*DuelCard{}
+	decks := []int{}
+	for i, ids := range state.Cards {
+		row, err := ToDuelCards(state.CardSet, ids)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, row)
+		decks = append(decks, len(state.Decks[i]))
+	}
+
+	royals, err := ToRoyals(state.CardSet, state.Royals)
+	if err != nil {
+		return nil, err
+	}
+
+	duel := &Duel{
+		Board:      state.Board,
+		Bag:        len(state.Bag),
+		Privileges: state.Privileges,
+		Cards:      cards,
+		Decks:      decks,
+		Royals:     royals,
+		Again:      state.Again,
+	}
+
+	for _, p := range state.Players {
+		player, err := getDuelPlayer(set, p)
+		if err != nil {
+			return nil, err
+		}
+		duel.Players = append(duel.Players, player)
+	}
+
+	game := &Game{
+		ID:      gameID,
+		Type:    gameDuel,
+		TS:      strconv.Itoa(state.TS),
+		State:   state.State,
+		Current: state.Current,
+		Duel:    duel,
+	}
+
+	if game.State == gameover {
+		game.Winner, duel.Victory = state.Winner(set)
+	}
+
+	return game, nil
+}
+
+// GetDuelPlayer gets data about the given player in a Splendor Duel game,
+// marking the cards they reserved blind as hidden.
+func getDuelPlayer(set *duelSet, p *DuelPlayerState) (*DuelPlayer, error) {
+	bought, err := ToDuelCards(set.pinnedID(), p.Cards)
+	if err != nil {
+		return nil, err
+	}
+	cards := map[string][]*DuelCard{}
+	for _, card := range bought {
+		if color, ok := p.Jokers[card.ID]; ok {
+			card.Color = color
+		}
+		cards[card.Color] = append(cards[card.Color], card)
+	}
+
+	reserved, err := ToDuelCards(set.pinnedID(), p.Reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, card := range reserved {
+		card.Hidden = find(card.ID, p.Hidden) != -1
+	}
+
+	royals, err := ToRoyals(set.pinnedID(), p.Royals)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DuelPlayer{
+		ID:          p.ID,
+		Coins:       p.Coins,
+		Cards:       cards,
+		Reserved:    reserved,
+		Royals:      royals,
+		Privileges:  p.Privileges,
+		Points:      p.Points(set),
+		Crowns:      p.Crowns(set),
+		ColorPoints: p.ColorPoints(set),
+		Resigned:    p.Resigned,
+	}, nil
+}
@@ -3,7 +3,9 @@ package splenda
 import (
 	"os"
 	"os/exec"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestTwoPlayers(t *testing.T) {
@@ -15,12 +17,12 @@ func TestTwoPlayers(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	id, err := impl.NewGame("user1", []string{"user1", "user2"})
+	id, err := impl.NewGame("user1", []string{"user1", "user2"}, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	game, err := impl.GetGame(id, "user1", "0")
+	game, err := impl.GetGame(id, "user1", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -34,6 +36,254 @@ func TestTwoPlayers(t *testing.T) {
 	// TODO: Make some moves.
 }
 
+func TestUndo(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	defer cleanup(url)
+
+	impl, err := setup(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := impl.NewGame("user1", []string{"user1", "user2"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := impl.GetGame(id, "user2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := impl.Take3(id, "user2", []string{red, green, blue}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.AcceptUndo(id, "user1"); err == nil {
+		t.Error("expected an error accepting an undo nobody asked for")
+	}
+
+	// Only the player who moved can ask to take it back.
+	if _, err := impl.RequestUndo(id, "user1"); err == nil {
+		t.Error("expected an error asking to undo someone else's move")
+	}
+	moved, err := impl.GetGame(id, "user2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := impl.RequestUndo(id, "user2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts != moved.TS {
+		t.Errorf("asking for an undo moved the ts from %v to %v", moved.TS, ts)
+	}
+
+	// Only the next player can answer.
+	if _, err := impl.AcceptUndo(id, "user2"); err == nil {
+		t.Error("expected an error accepting your own undo")
+	}
+	if _, err := impl.DeclineUndo(id, "user2"); err == nil {
+		t.Error("expected an error declining your own undo")
+	}
+
+	// Accepting puts everything back the way it was, ts and all.
+	if _, err := impl.AcceptUndo(id, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := impl.GetGame(id, "user2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGameState(t, after, id, play, "user2")
+	if after.TS != before.TS {
+		t.Errorf("bad ts: expected %v, got %v", before.TS, after.TS)
+	}
+	if !reflect.DeepEqual(after.Table, before.Table) {
+		t.Errorf("bad table: expected %+v, got %+v", before.Table, after.Table)
+	}
+	if !reflect.DeepEqual(after.Players, before.Players) {
+		t.Errorf("bad players: expected %+v, got %+v", before.Players, after.Players)
+	}
+	if after.Version == before.Version || after.Version == moved.Version {
+		t.Errorf("expected a new version, got %v again", after.Version)
+	}
+
+	// A request goes away once the next player moves instead.
+	if _, err := impl.Take3(id, "user2", []string{red, green, blue}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.RequestUndo(id, "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.Take3(id, "user1", []string{white, black, red}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.AcceptUndo(id, "user1"); err == nil {
+		t.Error("expected an error accepting an undo after moving")
+	}
+	if _, err := impl.RequestUndo(id, "user2"); err == nil {
+		t.Error("expected an error asking to undo an earlier move")
+	}
+
+	// Declining leaves the ts alone too, and the move can't be taken back
+	// after that.
+	moved, err = impl.GetGame(id, "user1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.RequestUndo(id, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.DeclineUndo(id, "user1"); err == nil {
+		t.Error("expected an error declining your own undo")
+	}
+	ts, err = impl.DeclineUndo(id, "user2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts != moved.TS {
+		t.Errorf("declining an undo moved the ts from %v to %v", moved.TS, ts)
+	}
+	if _, err := impl.AcceptUndo(id, "user2"); err == nil {
+		t.Error("expected an error accepting a declined undo")
+	}
+	if _, err := impl.RequestUndo(id, "user1"); err == nil {
+		t.Error("expected an error asking again after a decline")
+	}
+
+	history, err := impl.History(id, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []string{}
+	for _, e := range history {
+		types = append(types, e.Type)
+	}
+	assertStrings(t, "history", types, []string{moveTake3, moveUndo, moveTake3, moveTake3})
+}
+
+func TestUndoTimeout(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	defer cleanup(url)
+
+	impl, err := setup(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &mockclock{now: nowish}
+	impl.clock = clock
+
+	tc := &TimeControl{Mode: timePerMove, Seconds: 60}
+	id, err := impl.NewGame("user1", []string{"user1", "user2"}, nil, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A move made for someone who ran out of time can't be taken back.
+	clock.now = nowish.Add(2 * time.Minute)
+	if err := impl.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	game, err := impl.GetGame(id, "user1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGameState(t, game, id, play, "user1")
+	if game.Undo != nil {
+		t.Errorf("expected no undo after a timeout, got %+v", game.Undo)
+	}
+	if _, err := impl.RequestUndo(id, "user2"); err == nil {
+		t.Error("expected an error undoing a timeout")
+	}
+}
+
+func TestUndoResign(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	defer cleanup(url)
+
+	impl, err := setup(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := impl.NewGame("user1", []string{"user1", "user2"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impl.Take3(id, "user2", []string{red, green, blue}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resigning out of turn doesn't replace the move that can be taken back,
+	// and that move can't be taken back anymore, since it would bring the
+	// resigned player back into a game that's already been won.
+	if _, err := impl.Resign(id, "user2"); err != nil {
+		t.Fatal(err)
+	}
+	game, err := impl.GetGame(id, "user1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGameState(t, game, id, gameover, game.Current)
+	if game.Winner != "user1" {
+		t.Errorf("expected user1 to win, got %v", game.Winner)
+	}
+	if _, err := impl.RequestUndo(id, "user2"); err == nil {
+		t.Error("expected an error taking back a move from before resigning")
+	}
+	if _, err := impl.RequestUndo(id, "user1"); err == nil {
+		t.Error("expected an error taking back the resignation")
+	}
+}
+
+func TestRank(t *testing.T) {
+	cards := func(n int) map[string][]*Card {
+		return map[string][]*Card{red: make([]*Card, n)}
+	}
+
+	players := []*Player{
+		{ID: "user1", Points: 15, Cards: cards(9)},
+		{ID: "user2", Points: 16, Cards: cards(10)},
+		{ID: "user3", Points: 15, Cards: cards(8)},
+		{ID: "user4", Points: 15, Cards: cards(8)},
+		{ID: "user5", Points: 17, Cards: cards(8), Resigned: true},
+	}
+
+	standings := rank(players)
+
+	expected := []Standing{
+		{ID: "user2", Rank: 1, Points: 16, Cards: 10},
+		{ID: "user3", Rank: 2, Points: 15, Cards: 8},
+		{ID: "user4", Rank: 2, Points: 15, Cards: 8},
+		{ID: "user1", Rank: 4, Points: 15, Cards: 9},
+		{ID: "user5", Rank: 5, Points: 17, Cards: 8, Resigned: true},
+	}
+	if len(standings) != len(expected) {
+		t.Fatalf("expected %v standings, got %v", len(expected), len(standings))
+	}
+	for i, s := range standings {
+		if *s != expected[i] {
+			t.Errorf("bad standing %v: expected %v, got %v", i, expected[i], *s)
+		}
+	}
+
+	if w := winner(standings); w != "user2" {
+		t.Errorf("bad winner: expected user2, got %v", w)
+	}
+	// Qualifying for a city beats having more points.
+	cities := rank([]*Player{
+		{ID: "user1", Points: 20},
+		{ID: "user2", Points: 16, City: &City{ID: "cairo"}},
+	})
+	if cities[0].ID != "user2" || cities[0].City != "cairo" || cities[1].Rank != 2 {
+		t.Errorf("bad standings with a city: %v, %v", *cities[0], *cities[1])
+	}
+
+	shared := []*Standing{{ID: "user1", Rank: 1}, {ID: "user2", Rank: 1}}
+	if w := winner(shared); w != "" {
+		t.Errorf("bad winner: expected shared, got %v", w)
+	}
+}
+
 func assertGameState(t *testing.T, game *Game, id string, state string, current string) {
 	if game.ID != id {
 		t.Errorf("bad ID: expected %v, got %v", id, game.ID)
@@ -94,7 +344,26 @@ func assertCards(t *testing.T, cards []*Card, expected []string) {
 	}
 }
 
+// A database given by DATABASE_URL can only be set up once, so every test
+// shares it.
+var sharedDB *DB
+
 func setup(url string) (*Impl, error) {
+	if url != "" && sharedDB != nil {
+		return NewImplSeed(sharedDB, 1), nil
+	}
+
+	db, err := setupDB(url)
+	if err != nil {
+		return nil, err
+	}
+	if url != "" {
+		sharedDB = db
+	}
+	return NewImplSeed(db, 1), nil
+}
+
+func setupDB(url string) (*DB, error) {
 	if url == "" {
 		cleanup(url)
 
@@ -121,8 +390,7 @@ func setup(url string) (*Impl, error) {
 		return nil, err
 	}
 
-	impl := NewImplSeed(db, 1)
-	return impl, nil
+	return db, nil
 }
 
 func cleanup(url string) {
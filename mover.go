@@ -1,24 +1,26 @@
 package splenda
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+)
 
-// A mover is a utility that holds shared code across different types of moves.
+// A mover is a utility that holds the shared workflow for executing a move
+// against the database. The rules themselves live in Apply.
 type mover struct {
 	gameID string
 	userID string
 	db     *DB
+	clock  clock
+	notify *notifier
 
-	game    *Game
-	players []string
-	index   int
+	// Set when the move is made for a player who ran out of time.
+	timedOut bool
 }
 
-// A movefunc implements the actual business logic of a move.
-type movefunc func(*TX) (string, string, error)
-
-// Move executes the overall workflow of a move transaction, calling out to
-// a movefunc that implements the actual business logic.
-func (m *mover) Move(move movefunc) (string, error) {
+// Move executes the overall workflow of a move transaction: loading the
+// state of the game, applying the move to it, and saving the result.
+func (m *mover) Move(move Move) (string, error) {
 	tx, err := m.db.NewTX(m.gameID)
 	if err != nil {
 		return "", err
@@ -26,61 +28,56 @@ func (m *mover) Move(move movefunc) (string, error) {
 	defer tx.Close()
 
 	// Pre-move work.
-	if err := m.premove(tx); err != nil {
-		return "", err
-	}
-
-	// Run the actual move.
-	newstate, newplayer, err := move(tx)
+	state, err := m.premove(tx)
 	if err != nil {
 		return "", err
 	}
 
-	// Clean up with post-move work.
-	return m.postmove(tx, newstate, newplayer)
+	return m.move(tx, state, move)
 }
 
-// Premove does the common work to set up for a game move.
-func (m *mover) premove(tx *TX) error {
-	game, err := tx.GetGameBasics() // TODO: FOR UPDATE to lock?
+// MoveDuel executes the same workflow for a move in a Splendor Duel game.
+// Duel moves can't be taken back, so there's no undo to record.
+func (m *mover) MoveDuel(move DuelMove) (string, error) {
+	tx, err := m.db.NewTX(m.gameID)
 	if err != nil {
-		return err
+		return "", err
 	}
-	m.game = game
+	defer tx.Close()
 
-	// Read the set of players for this game, find the index of
-	// the calling player, and confirm that it's their turn to move.
-	players, err := tx.GetPlayers()
+	state, err := tx.LoadDuelState()
 	if err != nil {
-		return err
+		return "", err
+	}
+	if m.userID, err = actingAs(tx, m.userID, state.Current); err != nil {
+		return "", err
+	}
+	if state.Player(m.userID) == nil {
+		return "", errors.New("no such game")
 	}
-	m.players = players
 
-	index := find(m.userID, players)
-	if index == -1 {
-		return errors.New("no such game")
+	move.Player = m.userID
+	next, events, err := ApplyDuel(state, move)
+	if err != nil {
+		return "", err
 	}
-	m.index = index
 
-	if m.userID != game.Current {
-		return errors.New("not your turn")
+	ts, err := tx.SaveDuelState(state.TS, next)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
-}
+	if err := m.record(tx, state.TS, move.Type, move, events); err != nil {
+		return "", err
+	}
 
-func find(needle string, haystack []string) int {
-	for i, hay := range haystack {
-		if hay == needle {
-			return i
+	if next.Current != state.Current {
+		if err := m.startTurn(tx, state.Current); err != nil {
+			return "", err
 		}
 	}
-	return -1
-}
 
-// Postmove does the common work to finish up after a move.
-func (m *mover) postmove(tx *TX, newstate string, newplayer string) (string, error) {
-	ts, err := tx.UpdateGame(m.game.TS, newstate, newplayer)
+	version, err := tx.GetVersion()
 	if err != nil {
 		return "", err
 	}
@@ -88,218 +85,168 @@ func (m *mover) postmove(tx *TX, newstate string, newplayer string) (string, err
 	if err := tx.Commit(); err != nil {
 		return "", err
 	}
+	m.notify.Notify(m.gameID, Change{ts, version})
 
 	return ts, nil
 }
 
-// State returns the current state of the game.
-func (m *mover) State() string {
-	return m.game.State
-}
-
-// IsRoundOver returns true if this is the last turn for the round.
-func (m *mover) IsRoundOver() bool {
-	return m.index == len(m.players)-1
-}
-
-// GetCardID gets the ID of the card at a given index.
-func (m *mover) GetCardID(tx *TX, tier int, index int) (string, error) {
-	if tier == 0 {
-		return m.GetReservedCardID(tx, index)
-	}
-
-	cards, err := tx.GetCards(tier)
+// Move runs a move against an already-loaded state and saves the result.
+func (m *mover) move(tx *TX, state *GameState, move Move) (string, error) {
+	move.Player = m.userID
+	next, events, err := Apply(state, move)
 	if err != nil {
 		return "", err
 	}
-	card := cards[index]
-	if card == "" {
-		return "", errors.New("no card there")
-	}
-	return card, nil
-}
 
-func (m *mover) GetReservedCardID(tx *TX, index int) (string, error) {
-	_, reserved, err := tx.GetPlayerCards(m.userID)
-	if err != nil {
+	// Clean up with post-move work.
+	if err := m.record(tx, state.TS, move.Type, move, events); err != nil {
 		return "", err
 	}
-	if index < 0 || index >= len(reserved) {
-		return "", errors.New("no card there")
-	}
-	return reserved[index], nil
+	return m.postmove(tx, state, move.Type, next)
 }
 
-// GetCardCounts gets the number of cards of each color that the player has.
-func (m *mover) GetCardCounts(tx *TX) (map[string]int, error) {
-	cards, _, err := tx.GetPlayerCards(m.userID)
+// Premove does the common work to set up for a game move.
+func (m *mover) premove(tx *TX) (*GameState, error) {
+	state, err := tx.LoadState() // TODO: FOR UPDATE to lock?
 	if err != nil {
 		return nil, err
 	}
 
-	ret := map[string]int{}
-
-	for _, id := range cards {
-		card, ok := cardFromID(id)
-		if !ok {
-			return nil, errors.New("bogus card ID")
-		}
-		ret[card.color]++
+	// Confirm that the calling player is actually in this game. Apply takes
+	// care of checking whether it's their turn.
+	if m.userID, err = actingAs(tx, m.userID, state.Current); err != nil {
+		return nil, err
+	}
+	if state.Player(m.userID) == nil {
+		return nil, errors.New("no such game")
 	}
 
-	return ret, nil
+	return state, nil
 }
 
-// EarnCoins transfers coins from the bank to the player if possible.
-func (m *mover) EarnCoins(tx *TX, limits, coins map[string]int) error {
-	bank, err := tx.GetCoins()
-	if err != nil {
-		return err
-	}
-	purse, err := tx.GetPlayerCoins(m.userID)
-	if err != nil {
-		return err
-	}
-
-	for color, limit := range limits {
-		if bank[color] < limit {
-			return ErrInsufficientCoins
+func find(needle string, haystack []string) int {
+	for i, hay := range haystack {
+		if hay == needle {
+			return i
 		}
 	}
-
-	newbank := map[string]int{}
-	newpurse := map[string]int{}
-
-	for color, count := range coins {
-		newbank[color] = bank[color] - count
-		newpurse[color] = purse[color] + count
-	}
-
-	if err := tx.UpdateCoins(newbank); err != nil {
-		return err
-	}
-	if err := tx.UpdatePlayerCoins(m.userID, newpurse); err != nil {
-		return err
-	}
-
-	// TODO: If player has more than 10 coins now, make then give some back.
-
-	return nil
+	return -1
 }
 
-// PayCost attempts to pay the cost for a given card.
-func (m *mover) PayCost(tx *TX, cards, cost map[string]int) error {
-	bank, err := tx.GetCoins()
-	if err != nil {
-		return err
-	}
-	purse, err := tx.GetPlayerCoins(m.userID)
+// Postmove does the common work to finish up after a move.
+func (m *mover) postmove(tx *TX, state *GameState, moveType string, next *GameState) (string, error) {
+	ts, err := tx.SaveState(state.TS, next)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	newbank := map[string]int{}
-	newpurse := map[string]int{}
-	wildsneeded := 0
-
-	for color, coins := range cost {
-		coincost, wildcost := calculateActualCost(cards[color], purse[color], coins)
-		if coincost > 0 {
-			newbank[color] = bank[color] + coincost
-			newpurse[color] = purse[color] - coincost
+	// Hang on to the old state in case they want to take the move back,
+	// unless it was made for them when they ran out of time. Resigning can't
+	// be taken back, and can happen out of turn, so it leaves any takeback
+	// that's already pending alone.
+	switch {
+	case m.timedOut:
+		if err := tx.DeleteUndo(); err != nil {
+			return "", err
 		}
-		wildsneeded += wildcost
-	}
-
-	if wildsneeded > 0 {
-		if wildsneeded > purse[wild] {
-			return ErrInsufficientCoins
+	case moveType == moveResign:
+	default:
+		if err := tx.InsertUndo(m.userID, state); err != nil {
+			return "", err
 		}
-		newbank[wild] = bank[wild] + wildsneeded
-		newpurse[wild] = purse[wild] - wildsneeded
 	}
 
-	if err := tx.UpdateCoins(newbank); err != nil {
-		return err
-	}
-	if err := tx.UpdatePlayerCoins(m.userID, newpurse); err != nil {
-		return err
+	if next.Current != state.Current {
+		if err := m.startTurn(tx, state.Current); err != nil {
+			return "", err
+		}
 	}
 
-	return nil
-}
-
-func calculateActualCost(cards, purse, cost int) (int, int) {
-	cost -= cards
-	if cost <= 0 {
-		// We have enough cards to totally cancel the cost.
-		return 0, 0
+	version, err := tx.GetVersion()
+	if err != nil {
+		return "", err
 	}
 
-	// We can directly afford it, pay the cost in regular coins.
-	if cost <= purse {
-		return cost, 0
+	if err := tx.Commit(); err != nil {
+		return "", err
 	}
+	m.notify.Notify(m.gameID, Change{ts, version})
 
-	// If we can't we need to spend some wilds.
-	return purse, cost - purse
+	return ts, nil
 }
 
-// DealCard deals a card from the deck onto the board.
-func (m *mover) DealCard(tx *TX, tier int, index int) error {
-	newcard, err := tx.GetTopCard(tier)
-	if err != nil {
-		return err
-	}
+// The type of history entry recorded when the last move is taken back.
+const moveUndo = "undo"
 
-	if newcard != "" {
-		err = tx.TransferCard(tier, index, newcard)
-	} else {
-		err = tx.DeleteCard(tier, index)
-	}
+// Record appends a move to the game's history. TS is the timestamp before
+// the move.
+func (m *mover) record(tx *TX, ts int, moveType string, params interface{}, events []Event) error {
+	e, err := newHistoryEntry(m.userID, moveType, params, events)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	e.TS = ts + 1
+	e.Time = m.clock.Now()
+	return tx.InsertMove(e)
 }
 
-// CanAffordNoble checks if the player can now afford a noble.
-func (m *mover) CanAffordNoble(tx *TX, cards map[string]int) (bool, error) {
-	nobles, err := tx.GetNobles()
+// NewHistoryEntry summarizes a move for the game's history, adding up the
+// coins the player exchanged with the bank and picking the card dealt and
+// the noble claimed out of the move's events.
+func newHistoryEntry(player string, moveType string, params interface{}, events []Event) (*HistoryEntry, error) {
+	bs, err := json.Marshal(params)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	for _, id := range nobles {
-		noble, ok := nobleFromID(id)
-		if !ok {
-			return false, errors.New("invalid noble ID")
+	e := &HistoryEntry{
+		Player: player,
+		Type:   moveType,
+		Params: bs,
+	}
+
+	coins := map[string]int{}
+	for _, ev := range events {
+		switch ev.Type {
+		case eventCoins:
+			if ev.Player == player {
+				for color, n := range ev.Coins {
+					coins[color] += n
+				}
+			}
+		case eventDeal:
+			if ev.Card != "" {
+				e.Card = ev.Card
+			}
+		case eventNoble, eventRoyal:
+			e.Noble = ev.Noble
 		}
-
-		if canAfford(cards, noble.cost) {
-			return true, nil
+	}
+	for color, n := range coins {
+		if n != 0 {
+			if e.Coins == nil {
+				e.Coins = map[string]int{}
+			}
+			e.Coins[color] = n
 		}
 	}
 
-	return false, nil
+	return e, nil
 }
 
-func canAfford(cards, cost map[string]int) bool {
-	for color, num := range cost {
-		if cards[color] < num {
-			return false
-		}
+// StartTurn restarts the clock for a new turn, charging the time the last
+// one took to the player whose turn it was.
+func (m *mover) startTurn(tx *TX, last string) error {
+	tc, started, err := tx.GetTimeControl()
+	if err != nil || tc == nil {
+		return err
 	}
-	return true
-}
 
-// NextPlayer returns a triple that causes postmove to move to the next
-// player's turn.
-func (m *mover) NextPlayer() (string, string, error) {
-	next := m.index + 1
-	if next >= len(m.players) {
-		next = 0
+	now := m.clock.Now()
+	if tc.Mode == timeTotal {
+		if err := tx.UpdateTimeUsed(last, now.Sub(started)); err != nil {
+			return err
+		}
 	}
-	return play, m.players[next], nil
+	return tx.UpdateTurnStarted(now)
 }
@@ -0,0 +1,55 @@
+package splenda
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNewHistoryEntry(t *testing.T) {
+	entry := func(state *GameState, move Move) *HistoryEntry {
+		t.Helper()
+		_, events, err := Apply(state, move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := newHistoryEntry(move.Player, move.Type, move, events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// Paying for a card gives coins back to the bank and deals a new one.
+	state := testState()
+	state.Players[0].Coins[red] = 1
+	state.Players[0].Coins[wild] = 2
+	move := Move{Type: moveBuy, Player: "user1", Tier: 1, Index: 1}
+
+	e := entry(state, move)
+	if e.Player != "user1" || e.Type != moveBuy || e.Card != "1_3_0" || e.Noble != "" {
+		t.Errorf("bad entry: %+v", e)
+	}
+	if !reflect.DeepEqual(e.Coins, map[string]int{red: -1, wild: -2}) {
+		t.Errorf("bad coins: %v", e.Coins)
+	}
+
+	parsed := Move{}
+	if err := json.Unmarshal(e.Params, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, move) {
+		t.Errorf("params don't round-trip: %+v", parsed)
+	}
+
+	// Bonuses pay for it all here, and earn a noble.
+	state = testState()
+	state.Players[0].Cards = []string{
+		"1_4_4", "1_3_4", "1_2_1_4", "1_22_4",
+		"1_4_1", "1_2_1_1", "1_22_1",
+	}
+	e = entry(state, move)
+	if e.Coins != nil || e.Noble != "mary_stuart" {
+		t.Errorf("bad entry: %+v", e)
+	}
+}
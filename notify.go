@@ -0,0 +1,55 @@
+package splenda
+
+import "sync"
+
+// A notifier tells whoever is watching a game when it has changed, passing on
+// its new timestamp and version. It only knows about changes made through
+// this process, which is fine as long as there's just the one server.
+type notifier struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan Change]bool
+}
+
+func newNotifier() *notifier {
+	return &notifier{watchers: map[string]map[chan Change]bool{}}
+}
+
+// Watch starts watching the given game, returning a channel that gets each
+// new version and a function to call to stop watching. Anyone who falls
+// behind only gets the latest one, since that's all they need to catch up.
+func (n *notifier) Watch(gameID string) (<-chan Change, func()) {
+	ch := make(chan Change, 1)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.watchers[gameID] == nil {
+		n.watchers[gameID] = map[chan Change]bool{}
+	}
+	n.watchers[gameID][ch] = true
+
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
+		delete(n.watchers[gameID], ch)
+		if len(n.watchers[gameID]) == 0 {
+			delete(n.watchers, gameID)
+		}
+	}
+}
+
+// Notify tells everyone watching the given game about its new version.
+func (n *notifier) Notify(gameID string, change Change) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for ch := range n.watchers[gameID] {
+		// Replace anything they haven't picked up yet.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- change
+	}
+}
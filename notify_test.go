@@ -0,0 +1,41 @@
+package splenda
+
+import "testing"
+
+func TestNotifier(t *testing.T) {
+	n := newNotifier()
+	updates, stop := n.Watch("game1")
+	other, stopOther := n.Watch("game2")
+	defer stopOther()
+
+	// Someone who falls behind only sees the latest version.
+	n.Notify("game1", Change{TS: "1", Version: "1.1.0"})
+	n.Notify("game1", Change{TS: "2", Version: "2.2.0"})
+	if ts := <-updates; ts.Version != "2.2.0" {
+		t.Errorf("expected 2.2.0, got %v", ts.Version)
+	}
+	select {
+	case ts := <-updates:
+		t.Errorf("unexpected update: %v", ts)
+	default:
+	}
+
+	// Nobody hears about other games.
+	select {
+	case ts := <-other:
+		t.Errorf("unexpected update for game2: %v", ts)
+	default:
+	}
+
+	// Or about anything once they stop watching.
+	stop()
+	n.Notify("game1", Change{TS: "3", Version: "3.3.0"})
+	select {
+	case ts := <-updates:
+		t.Errorf("unexpected update after stopping: %v", ts)
+	default:
+	}
+	if _, ok := n.watchers["game1"]; ok {
+		t.Error("expected game1 to be forgotten")
+	}
+}
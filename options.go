@@ -0,0 +1,103 @@
+package splenda
+
+import "fmt"
+
+// The standard rules.
+const (
+	defaultPoints       = 15
+	defaultGold         = 5
+	defaultCardsPerTier = 4
+	defaultReserveSlots = 3
+)
+
+// Game modes.
+const (
+	modeStandard = ""
+	modeCities   = "cities"
+	modePosts    = "posts"
+	modeOrient   = "orient"
+)
+
+// The number of cities dealt out in cities mode.
+const numCities = 3
+
+// The number of Orient cards dealt face up for each tier in Orient mode.
+const orientCardsPerTier = 2
+
+// The most any of the house rules can stretch things.
+const (
+	maxPoints       = 30
+	maxBankCoins    = 10
+	maxCardsPerTier = 5
+	maxReserveSlots = 5
+)
+
+// WithDefaults returns a copy of the options with anything that wasn't set
+// filled in from the standard rules for the given number of players.
+func (o Options) withDefaults(players int) Options {
+	if o.Points == 0 {
+		o.Points = defaultPoints
+	}
+	if o.Coins == 0 {
+		o.Coins = numCoins(players)
+	}
+	if o.Gold == 0 {
+		o.Gold = defaultGold
+	}
+	if o.Nobles == 0 {
+		o.Nobles = players + 1
+	}
+	if o.CardsPerTier == 0 {
+		o.CardsPerTier = defaultCardsPerTier
+	}
+	if o.ReserveSlots == 0 {
+		o.ReserveSlots = defaultReserveSlots
+	}
+	if o.CardSet == "" {
+		o.CardSet = defaultCardSet
+	}
+	return o
+}
+
+// ValidateOptions checks that the given house rules are playable.
+func validateOptions(o *Options) error {
+	set, err := getCardSet(o.withDefaults(2).CardSet)
+	if err != nil {
+		return err
+	}
+
+	checks := []struct {
+		name     string
+		val, max int
+	}{
+		{"points", o.Points, maxPoints},
+		{"coins", o.Coins, maxBankCoins},
+		{"gold", o.Gold, maxBankCoins},
+		{"nobles", o.Nobles, len(set.nobles)},
+		{"cards per tier", o.CardsPerTier, maxCardsPerTier},
+		{"reserve slots", o.ReserveSlots, maxReserveSlots},
+	}
+	switch o.Mode {
+	case modeStandard, modePosts:
+	case modeCities:
+		if len(set.cities) < numCities {
+			return fmt.Errorf("the %v card set doesn't have enough cities", set.id)
+		}
+	case modeOrient:
+		if !set.hasOrient() {
+			return fmt.Errorf("the %v card set doesn't have enough Orient cards", set.id)
+		}
+	default:
+		return fmt.Errorf("unknown game mode: %v", o.Mode)
+	}
+
+	for _, c := range checks {
+		if c.val < 0 {
+			return fmt.Errorf("%v can't be negative", c.name)
+		}
+		if c.val > c.max {
+			return fmt.Errorf("%v can't be more than %v", c.name, c.max)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package splenda
+
+// Trading post IDs.
+const (
+	postExtraCoin  = "extracoin"
+	postBuyCoin    = "buycoin"
+	postDoubleGold = "doublegold"
+	postFivePoints = "fivepoints"
+	postPointEach  = "pointeach"
+)
+
+// A tradingPost is a power a player unlocks for the rest of the game once
+// they own enough cards of each color, and enough nobles.
+type tradingPost struct {
+	id          string
+	cost        map[string]int
+	nobles      int
+	description string
+}
+
+// The trading posts, in the order they're unlocked in the usual game.
+var tradingPosts = []tradingPost{
+	{
+		id:          postExtraCoin,
+		cost:        map[string]int{red: 3, white: 1},
+		description: "take an extra coin of another color when taking two",
+	},
+	{
+		id:          postBuyCoin,
+		cost:        map[string]int{white: 2, blue: 2},
+		description: "take a coin of the same color as each card bought",
+	},
+	{
+		id:          postDoubleGold,
+		cost:        map[string]int{blue: 3, black: 1},
+		description: "gold coins are worth two coins when paying",
+	},
+	{
+		id:          postFivePoints,
+		cost:        map[string]int{black: 5},
+		nobles:      1,
+		description: "worth 5 points",
+	},
+	{
+		id:          postPointEach,
+		cost:        map[string]int{green: 5},
+		description: "worth a point for each trading post unlocked",
+	},
+}
+
+func getTradingPost(id string) (tradingPost, bool) {
+	for _, p := range tradingPosts {
+		if p.id == id {
+			return p, true
+		}
+	}
+	return tradingPost{}, false
+}
+
+// HasPost returns true if the player has unlocked the given trading post.
+func (p *PlayerState) HasPost(id string) bool {
+	return find(id, p.Posts) != -1
+}
+
+// PostPoints returns the points a player's trading posts are worth.
+func postPoints(posts []string) int {
+	points := 0
+	for _, id := range posts {
+		switch id {
+		case postFivePoints:
+			points += 5
+		case postPointEach:
+			points += len(posts)
+		}
+	}
+	return points
+}
@@ -0,0 +1,136 @@
+package splenda
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Replay rebuilds a finished game as it was at the given timestamp, as seen
+// by the given user, by re-running its history from the initial deal.
+func (i *Impl) Replay(gameID string, userID string, ts int) (*Game, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	if !tx.IsPlaying(userID) {
+		return nil, errors.New("no such game")
+	}
+
+	over, _, err := getActive(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !over {
+		return nil, errors.New("the game isn't over yet")
+	}
+
+	basics, err := tx.GetGameBasics()
+	if err != nil {
+		return nil, err
+	}
+	history, err := tx.GetHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	if basics.Type == gameDuel {
+		start := &DuelState{}
+		if err := tx.GetStart(start); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+
+		state, err := replayDuel(start, history, ts)
+		if err != nil {
+			return nil, err
+		}
+		game, err := getDuelGame(gameID, state)
+		if err != nil {
+			return nil, err
+		}
+		return view(game, userID), nil
+	}
+
+	start := &GameState{}
+	if err := tx.GetStart(start); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	state, err := replay(start, history, ts)
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(gameID, state)
+	if err != nil {
+		return nil, err
+	}
+	return view(game, userID), nil
+}
+
+// MovesMade filters a game's history down to the moves that still stand,
+// dropping any that were taken back.
+func movesMade(history []*HistoryEntry) []*HistoryEntry {
+	moves := []*HistoryEntry{}
+	for _, e := range history {
+		if e.Type != moveUndo {
+			moves = append(moves, e)
+			continue
+		}
+		for len(moves) > 0 && moves[len(moves)-1].TS > e.TS {
+			moves = moves[:len(moves)-1]
+		}
+	}
+	return moves
+}
+
+// Replay re-runs the moves from a game's history against its initial state,
+// stopping at the last one made at or before the given timestamp.
+func replay(start *GameState, history []*HistoryEntry, ts int) (*GameState, error) {
+	state := start
+	for _, e := range movesMade(history) {
+		if e.TS > ts {
+			break
+		}
+
+		move := Move{}
+		if err := json.Unmarshal(e.Params, &move); err != nil {
+			return nil, err
+		}
+		next, _, err := Apply(state, move)
+		if err != nil {
+			return nil, err
+		}
+		next.TS = e.TS
+		state = next
+	}
+	return state, nil
+}
+
+// ReplayDuel is Replay for Splendor Duel games.
+func replayDuel(start *DuelState, history []*HistoryEntry, ts int) (*DuelState, error) {
+	state := start
+	for _, e := range movesMade(history) {
+		if e.TS > ts {
+			break
+		}
+
+		move := DuelMove{}
+		if err := json.Unmarshal(e.Params, &move); err != nil {
+			return nil, err
+		}
+		next, _, err := ApplyDuel(state, move)
+		if err != nil {
+			return nil, err
+		}
+		next.TS = e.TS
+		state = next
+	}
+	return state, nil
+}
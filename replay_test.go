@@ -0,0 +1,53 @@
+package splenda
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	entry := func(ts int, move Move) *HistoryEntry {
+		bs, err := json.Marshal(move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &HistoryEntry{TS: ts, Player: move.Player, Type: move.Type, Params: bs}
+	}
+
+	// The second move is taken back and made differently.
+	history := []*HistoryEntry{
+		entry(1, Move{Type: moveTake3, Player: "user1", Colors: []string{red, blue, green}}),
+		entry(2, Move{Type: moveTake3, Player: "user2", Colors: []string{red, blue, green}}),
+		{TS: 1, Player: "user2", Type: moveUndo},
+		entry(2, Move{Type: moveTake3, Player: "user2", Colors: []string{white, black, red}}),
+	}
+
+	if moves := movesMade(history); len(moves) != 2 || moves[1] != history[3] {
+		t.Errorf("expected the undone move to be dropped, got %v", moves)
+	}
+
+	state, err := replay(testState(), history, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.TS != 0 || state.Current != "user1" || state.Players[0].Coins[red] != 0 {
+		t.Errorf("expected the initial state, got %+v", state)
+	}
+
+	state, err = replay(testState(), history, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.TS != 1 || state.Current != "user2" || state.Players[0].Coins[red] != 1 {
+		t.Errorf("bad state after the first move: %+v", state)
+	}
+
+	state, err = replay(testState(), history, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := state.Players[1]
+	if state.TS != 2 || p.Coins[white] != 1 || p.Coins[blue] != 0 || state.Coins[red] != 2 {
+		t.Errorf("bad final state: %v %v", p.Coins, state.Coins)
+	}
+}
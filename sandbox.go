@@ -0,0 +1,381 @@
+package splenda
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Fork copies a game, as it is now or as it was at an earlier timestamp, into
+// a new sandbox owned by the given user. In a sandbox the owner moves for
+// every seat and can rewind as they please. Time controls aren't copied. If
+// the game isn't over yet, anything its players couldn't know is shuffled up
+// again so the sandbox can't be used to peek at it.
+func (i *Impl) Fork(gameID string, userID string, ts string) (*GameSummary, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	if !tx.IsPlaying(userID) {
+		return nil, errors.New("no such game")
+	}
+
+	basics, err := tx.GetGameBasics()
+	if err != nil {
+		return nil, err
+	}
+	if ts == "" {
+		ts = basics.TS
+	}
+	n, err := strconv.Atoi(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	if basics.Type == gameDuel {
+		state, err := forkedDuelState(tx, n)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		if basics.State != gameover {
+			if err := concealDuel(state, userID, i.rng); err != nil {
+				return nil, err
+			}
+		}
+		return i.newDuelSandbox(userID, state)
+	}
+
+	state, err := forkedState(tx, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if basics.State != gameover {
+		if err := conceal(state, userID, i.rng); err != nil {
+			return nil, err
+		}
+	}
+	return i.newSandbox(userID, state)
+}
+
+// Rewind puts a sandbox back the way it was at an earlier timestamp.
+func (i *Impl) Rewind(gameID string, userID string, ts int) (string, error) {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Close()
+
+	owner, err := tx.GetSandbox()
+	if err != nil {
+		return "", err
+	}
+	if owner == "" || owner != userID {
+		return "", errors.New("only sandboxes can be rewound")
+	}
+
+	basics, err := tx.GetGameBasics()
+	if err != nil {
+		return "", err
+	}
+	curTS, err := strconv.Atoi(basics.TS)
+	if err != nil {
+		return "", err
+	}
+	if ts >= curTS {
+		return "", errors.New("can only rewind to an earlier timestamp")
+	}
+
+	history, err := tx.GetHistory()
+	if err != nil {
+		return "", err
+	}
+
+	var restored int
+	if basics.Type == gameDuel {
+		start := &DuelState{}
+		if err := tx.GetStart(start); err != nil {
+			return "", err
+		}
+		state, err := replayDuel(start, history, ts)
+		if err != nil {
+			return "", err
+		}
+		if err := tx.RestoreDuelState(curTS, state); err != nil {
+			return "", err
+		}
+		restored = state.TS
+	} else {
+		start := &GameState{}
+		if err := tx.GetStart(start); err != nil {
+			return "", err
+		}
+		state, err := replay(start, history, ts)
+		if err != nil {
+			return "", err
+		}
+		if err := tx.RestoreState(curTS, state); err != nil {
+			return "", err
+		}
+		if err := tx.DeleteUndo(); err != nil {
+			return "", err
+		}
+		restored = state.TS
+	}
+
+	// Rewinding takes back every move since, same as an undo.
+	err = tx.InsertMove(&HistoryEntry{
+		TS:     restored,
+		Time:   i.clock.Now(),
+		Player: userID,
+		Type:   moveUndo,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	version, err := tx.GetVersion()
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	i.notify.Notify(gameID, Change{strconv.Itoa(restored), version})
+
+	return strconv.Itoa(restored), nil
+}
+
+// ForkedState gets the state of a game at the given timestamp, replaying its
+// history if that's earlier than now.
+func forkedState(tx *TX, ts int) (*GameState, error) {
+	state, err := tx.LoadState()
+	if err != nil {
+		return nil, err
+	}
+	if ts >= state.TS {
+		return state, nil
+	}
+
+	start := &GameState{}
+	if err := tx.GetStart(start); err != nil {
+		return nil, err
+	}
+	history, err := tx.GetHistory()
+	if err != nil {
+		return nil, err
+	}
+	return replay(start, history, ts)
+}
+
+// ForkedDuelState is ForkedState for Splendor Duel games.
+func forkedDuelState(tx *TX, ts int) (*DuelState, error) {
+	state, err := tx.LoadDuelState()
+	if err != nil {
+		return nil, err
+	}
+	if ts >= state.TS {
+		return state, nil
+	}
+
+	start := &DuelState{}
+	if err := tx.GetStart(start); err != nil {
+		return nil, err
+	}
+	history, err := tx.GetHistory()
+	if err != nil {
+		return nil, err
+	}
+	return replayDuel(start, history, ts)
+}
+
+// NewSandbox saves a copy of the given state as a new sandbox, the same way
+// NewGame saves a new game.
+func (i *Impl) newSandbox(owner string, state *GameState) (*GameSummary, error) {
+	gameID := newID()
+	state.TS = 0
+
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	if err := tx.InsertGame(state.Current, state.Options); err != nil {
+		return nil, err
+	}
+	if err := tx.UpdateSandbox(owner); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, p := range state.Players {
+		ids = append(ids, p.ID)
+	}
+	if err := tx.InsertPlayers(ids); err != nil {
+		return nil, err
+	}
+	if err := tx.UpdateResigned(state.Players); err != nil {
+		return nil, err
+	}
+
+	if err := tx.InsertState(state); err != nil {
+		return nil, err
+	}
+	if err := tx.InsertStart(state); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &GameSummary{ID: gameID, Type: gameSplendor, Sandbox: true, Players: ids}, nil
+}
+
+// NewDuelSandbox is NewSandbox for Splendor Duel games.
+func (i *Impl) newDuelSandbox(owner string, state *DuelState) (*GameSummary, error) {
+	gameID := newID()
+	state.TS = 0
+
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	if err := tx.InsertDuelGame(state.Current); err != nil {
+		return nil, err
+	}
+	if err := tx.UpdateSandbox(owner); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, p := range state.Players {
+		ids = append(ids, p.ID)
+	}
+	if err := tx.InsertPlayers(ids); err != nil {
+		return nil, err
+	}
+	if err := tx.UpdateDuelResigned(state.Players); err != nil {
+		return nil, err
+	}
+
+	if err := tx.InsertDuelState(state); err != nil {
+		return nil, err
+	}
+	if err := tx.InsertStart(state); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &GameSummary{ID: gameID, Type: gameDuel, Sandbox: true, Players: ids}, nil
+}
+
+// ActingAs returns which seat the given user is moving for: whoever's turn it
+// is in their own sandbox, and their own anywhere else. Nobody else gets to
+// move in a sandbox.
+func actingAs(tx *TX, userID string, current string) (string, error) {
+	owner, err := tx.GetSandbox()
+	if err != nil {
+		return "", err
+	}
+	switch owner {
+	case "":
+		return userID, nil
+	case userID:
+		return current, nil
+	default:
+		return "", errors.New("no such game")
+	}
+}
+
+// Conceal shuffles the decks of a copied game, and swaps the cards the other
+// players reserved blind for fresh ones from the same decks, so that nothing
+// the viewer couldn't have known carries over.
+func conceal(state *GameState, viewer string, rng rng) error {
+	set, err := getCardSet(state.Options.CardSet)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range state.Players {
+		if p.ID == viewer {
+			continue
+		}
+		for _, id := range copyStrings(p.Hidden) {
+			c, ok := set.card(id)
+			if !ok {
+				return fmt.Errorf("no such card: %v", id)
+			}
+			decks := state.Decks
+			if _, ok := set.tiers[c.tier-1][id]; !ok {
+				decks = state.OrientDecks
+			}
+
+			deck := shuffle(append(copyStrings(decks[c.tier-1]), id), rng)
+			decks[c.tier-1] = deck[1:]
+			replaceCard(p.Reserved, id, deck[0])
+			replaceCard(p.Hidden, id, deck[0])
+		}
+	}
+
+	for tier, deck := range state.Decks {
+		state.Decks[tier] = shuffle(copyStrings(deck), rng)
+	}
+	for tier, deck := range state.OrientDecks {
+		state.OrientDecks[tier] = shuffle(copyStrings(deck), rng)
+	}
+	return nil
+}
+
+// ConcealDuel is Conceal for Splendor Duel games, which also shuffles the
+// bag.
+func concealDuel(state *DuelState, viewer string, rng rng) error {
+	set, err := getDuelSet(state.CardSet)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range state.Players {
+		if p.ID == viewer {
+			continue
+		}
+		for _, id := range copyStrings(p.Hidden) {
+			c, ok := set.card(id)
+			if !ok {
+				return fmt.Errorf("no such card: %v", id)
+			}
+
+			deck := shuffle(append(copyStrings(state.Decks[c.tier-1]), id), rng)
+			state.Decks[c.tier-1] = deck[1:]
+			replaceCard(p.Reserved, id, deck[0])
+			replaceCard(p.Hidden, id, deck[0])
+		}
+	}
+
+	for tier, deck := range state.Decks {
+		state.Decks[tier] = shuffle(copyStrings(deck), rng)
+	}
+	state.Bag = shuffle(copyStrings(state.Bag), rng)
+	return nil
+}
+
+// ReplaceCard swaps one card in a list for another.
+func replaceCard(ids []string, old string, new string) {
+	if i := find(old, ids); i != -1 {
+		ids[i] = new
+	}
+}
@@ -0,0 +1,39 @@
+package splenda
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestConceal(t *testing.T) {
+	state := testState()
+	state.Decks[0] = []string{"1_3_0", "1_3_2", "1_4_1", "1_4_2", "1_4_3"}
+	state.Players[0].Reserved = []string{"2_5_2", "1_4_4"}
+	state.Players[0].Hidden = []string{"1_4_4"}
+	state.Players[1].Reserved = []string{"1_2_1_1", "1_22_1"}
+	state.Players[1].Hidden = []string{"1_22_1"}
+
+	before := append(copyStrings(state.Decks[0]), "1_22_1")
+	sort.Strings(before)
+
+	if err := conceal(state, "user1", rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The viewer's own cards stay put.
+	assertStrings(t, "user1 reserved", state.Players[0].Reserved, []string{"2_5_2", "1_4_4"})
+	assertStrings(t, "user1 hidden", state.Players[0].Hidden, []string{"1_4_4"})
+
+	// The other player's blind reserve is swapped for something from the
+	// same deck, and their open one stays.
+	p := state.Players[1]
+	if len(p.Reserved) != 2 || p.Reserved[0] != "1_2_1_1" || p.Reserved[1] != p.Hidden[0] {
+		t.Errorf("bad reserved: %v, hidden %v", p.Reserved, p.Hidden)
+	}
+	after := append(copyStrings(state.Decks[0]), p.Hidden[0])
+	sort.Strings(after)
+	assertStrings(t, "tier 1 cards", after, before)
+
+	assertStrings(t, "tier 2 deck", state.Decks[1], []string{"2_5_2"})
+}
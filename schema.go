@@ -9,19 +9,30 @@ var schema = []string{
 
 	// Enumeration of game states.
 	"CREATE TYPE game_state AS ENUM (" +
-		"'play', 'picknoble', 'gameover'" +
+		"'play', 'picknoble', 'claimnoble', 'reservecard', 'losecoin', 'gameover', " +
+		"'taketoken', 'stealtoken', 'pickroyal'" +
 		")",
 	// Enumeration of colors.
 	"CREATE TYPE color AS ENUM (" +
-		"'red', 'blue', 'green', 'white', 'black', 'wild'" +
+		"'red', 'blue', 'green', 'white', 'black', 'wild', 'pearl'" +
 		")",
 
-	// The games table; one entry per active game.
+	// The games table; one entry per active game. Type says which game is
+	// being played: 'splendor' or 'duel'. Sandbox is the owner of a private
+	// copy of another game made for analysis, or '' for a real game;
+	// sandboxes are only visible to their owner and don't count for anything.
 	"CREATE TABLE games (" +
 		"id varchar(256) PRIMARY KEY, " +
+		"type varchar(16) NOT NULL DEFAULT 'splendor', " +
+		"sandbox varchar(256) NOT NULL DEFAULT '', " +
 		"ts integer NOT NULL, " +
 		"state game_state NOT NULL, " +
-		"current varchar(256) NOT NULL REFERENCES users" +
+		"current varchar(256) NOT NULL REFERENCES users, " +
+		"options text NOT NULL DEFAULT '{}', " +
+		"time_mode varchar(16) NOT NULL DEFAULT '', " +
+		"time_limit integer NOT NULL DEFAULT 0, " +
+		"time_action varchar(16) NOT NULL DEFAULT '', " +
+		"turn_started timestamp with time zone NOT NULL DEFAULT now()" +
 		")",
 	// How many of each type of coin are in the bank.
 	"CREATE TABLE game_coins (" +
@@ -37,6 +48,13 @@ var schema = []string{
 		"noble_id varchar(256) NOT NULL, " +
 		"PRIMARY KEY (game_id, index)" +
 		")",
+	// Which cities are on the table, in cities mode.
+	"CREATE TABLE game_cities (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"index integer, " +
+		"city_id varchar(256) NOT NULL, " +
+		"PRIMARY KEY (game_id, index)" +
+		")",
 	// Which cards are currently on the table.
 	"CREATE TABLE game_cards (" +
 		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
@@ -53,12 +71,95 @@ var schema = []string{
 		"card_id varchar(256) NOT NULL, " +
 		"PRIMARY KEY (game_id, tier, index)" +
 		")",
+	// Which Orient cards are currently on the table, in Orient mode.
+	"CREATE TABLE game_orient_cards (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"tier integer, " +
+		"index integer, " +
+		"card_id varchar(256) NOT NULL, " +
+		"PRIMARY KEY (game_id, tier, index)" +
+		")",
+	// Which Orient cards are currently in the deck, in Orient mode.
+	"CREATE TABLE game_orient_decks (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"tier integer, " +
+		"index integer, " +
+		"card_id varchar(256) NOT NULL, " +
+		"PRIMARY KEY (game_id, tier, index)" +
+		")",
+
+	// The privileges left on the table in a Splendor Duel game, whether the
+	// current player has earned another turn, and the pinned ID of the card
+	// set it's played with ('' for the standard set).
+	"CREATE TABLE duel_games (" +
+		"game_id varchar(256) PRIMARY KEY REFERENCES games ON DELETE CASCADE, " +
+		"card_set varchar(256) NOT NULL DEFAULT '', " +
+		"privileges integer NOT NULL, " +
+		"again boolean NOT NULL DEFAULT FALSE" +
+		")",
+	// Which tokens are on the Splendor Duel board, by cell.
+	"CREATE TABLE duel_board (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"index integer, " +
+		"color color NOT NULL, " +
+		"PRIMARY KEY (game_id, index)" +
+		")",
+	// Which tokens are in the Splendor Duel bag, in the order they'll be drawn.
+	"CREATE TABLE duel_bag (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"index integer, " +
+		"color color NOT NULL, " +
+		"PRIMARY KEY (game_id, index)" +
+		")",
+	// Which royals are still on the table in a Splendor Duel game.
+	"CREATE TABLE duel_royals (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"index integer, " +
+		"royal_id varchar(256) NOT NULL, " +
+		"PRIMARY KEY (game_id, index)" +
+		")",
+
+	// The state of the game before its last move, so that the move can be
+	// taken back if the next player agrees.
+	"CREATE TABLE game_undo (" +
+		"game_id varchar(256) PRIMARY KEY REFERENCES games ON DELETE CASCADE, " +
+		"user_id varchar(256) NOT NULL, " +
+		"requested boolean NOT NULL DEFAULT FALSE, " +
+		"state text NOT NULL" +
+		")",
+
+	// The state of the game as it was first dealt, so that it can be
+	// replayed from its history.
+	"CREATE TABLE game_start (" +
+		"game_id varchar(256) PRIMARY KEY REFERENCES games ON DELETE CASCADE, " +
+		"state text NOT NULL" +
+		")",
+	// Every move made in the game, oldest first. Entries are never changed; a
+	// move that was taken back is followed by an 'undo' entry, so ts can
+	// repeat. Params is the move as submitted, and coins (as JSON) are what
+	// the player took from or gave back to the bank.
+	"CREATE TABLE game_moves (" +
+		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
+		"seq serial, " +
+		"ts integer NOT NULL, " +
+		"made timestamp with time zone NOT NULL, " +
+		"user_id varchar(256) NOT NULL, " +
+		"move_type varchar(32) NOT NULL, " +
+		"params text NOT NULL DEFAULT '{}', " +
+		"coins text NOT NULL DEFAULT '{}', " +
+		"card_id varchar(256) NOT NULL DEFAULT '', " +
+		"noble_id varchar(256) NOT NULL DEFAULT '', " +
+		"PRIMARY KEY (game_id, seq)" +
+		")",
 
 	// The players table; one entry for each user for each game they're in.
 	"CREATE TABLE players (" +
 		"game_id varchar(256) REFERENCES games ON DELETE CASCADE, " +
 		"user_id varchar(256) REFERENCES users ON DELETE RESTRICT, " +
 		"index integer NOT NULL, " +
+		"resigned boolean NOT NULL DEFAULT FALSE, " +
+		"delete_vote boolean NOT NULL DEFAULT FALSE, " +
+		"time_used bigint NOT NULL DEFAULT 0, " +
 		"PRIMARY KEY (game_id, user_id)" +
 		")",
 	// How many coins the player owns.
@@ -78,13 +179,58 @@ var schema = []string{
 		"PRIMARY KEY (game_id, user_id, noble_id), " +
 		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
 		")",
-	// Which cards the player owns (or has reserved)
+	// Which city the player has qualified for, in cities mode.
+	"CREATE TABLE player_cities (" +
+		"game_id varchar(256), " +
+		"user_id varchar(256), " +
+		"city_id varchar(256) NOT NULL, " +
+		"PRIMARY KEY (game_id, user_id), " +
+		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
+		")",
+	// Which trading posts the player has unlocked, in trading posts mode.
+	"CREATE TABLE player_posts (" +
+		"game_id varchar(256), " +
+		"user_id varchar(256), " +
+		"index integer NOT NULL, " +
+		"post_id varchar(256), " +
+		"PRIMARY KEY (game_id, user_id, post_id), " +
+		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
+		")",
+	// Which color each of the player's joker cards is copying, in Orient mode.
+	"CREATE TABLE player_jokers (" +
+		"game_id varchar(256), " +
+		"user_id varchar(256), " +
+		"card_id varchar(256), " +
+		"color color NOT NULL, " +
+		"PRIMARY KEY (game_id, user_id, card_id), " +
+		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
+		")",
+	// Which cards the player owns (or has reserved, possibly blind off the top of a deck)
 	"CREATE TABLE player_cards (" +
 		"game_id varchar(256), " +
 		"user_id varchar(256), " +
 		"card_id varchar(256), " +
+		"index integer NOT NULL DEFAULT 0, " +
 		"reserved boolean NOT NULL DEFAULT FALSE, " +
+		"hidden boolean NOT NULL DEFAULT FALSE, " +
 		"PRIMARY KEY (game_id, user_id, card_id), " +
 		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
 		")",
+	// How many privileges the player holds, in a Splendor Duel game.
+	"CREATE TABLE duel_players (" +
+		"game_id varchar(256), " +
+		"user_id varchar(256), " +
+		"privileges integer NOT NULL DEFAULT 0, " +
+		"PRIMARY KEY (game_id, user_id), " +
+		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
+		")",
+	// Which royals the player has claimed, in a Splendor Duel game.
+	"CREATE TABLE duel_player_royals (" +
+		"game_id varchar(256), " +
+		"user_id varchar(256), " +
+		"index integer NOT NULL, " +
+		"royal_id varchar(256), " +
+		"PRIMARY KEY (game_id, user_id, royal_id), " +
+		"FOREIGN KEY (game_id, user_id) REFERENCES players ON DELETE CASCADE" +
+		")",
 }
@@ -0,0 +1,135 @@
+package splenda
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/websocket"
+)
+
+// SocketAPI handles GET /api/games/<id>/socket, upgrading to a WebSocket that
+// takes Commands and sends back SocketMessages, so a client can play a game
+// over a single connection. It's authorized the same way as every other game
+// request, before the upgrade.
+func (a *api) SocketAPI(gameID string, userID string, res http.ResponseWriter, req *http.Request) {
+	s := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			a.play(ws, gameID, userID)
+		},
+	}
+	s.ServeHTTP(res, req)
+}
+
+// SameOrigin only lets browsers connect from pages we served, since the
+// session cookie goes along no matter which site opened the socket. Other
+// clients don't send an Origin and are let through.
+func sameOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Host != req.Host {
+		return fmt.Errorf("bad origin: %v", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+// Play runs a game's WebSocket until the client goes away: sending the game
+// whenever it changes, and running commands as they come in.
+func (a *api) play(ws *websocket.Conn, gameID string, userID string) {
+	defer ws.Close()
+
+	_, updates, stop, err := a.impl.Watch(gameID, userID)
+	if err != nil {
+		websocket.JSON.Send(ws, &SocketMessage{Type: "error", Error: err.Error()})
+		return
+	}
+	defer stop()
+
+	if err := a.sendGame(ws, gameID, userID); err != nil {
+		return
+	}
+
+	commands := make(chan *Command)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(commands)
+		for {
+			cmd := &Command{}
+			if err := websocket.JSON.Receive(ws, cmd); err != nil {
+				return
+			}
+			select {
+			case commands <- cmd:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				return
+			}
+			reply := &SocketMessage{Type: "ok", ID: cmd.ID, Command: cmd.Type}
+			if reply.Result, err = a.command(gameID, userID, cmd); err != nil {
+				reply.Type = "error"
+				reply.Status = errorStatus(err)
+				reply.Error = err.Error()
+			}
+			if err := websocket.JSON.Send(ws, reply); err != nil {
+				return
+			}
+
+		case <-updates:
+			if err := a.sendGame(ws, gameID, userID); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// SendGame sends the latest state of a game, as the user sees it.
+func (a *api) sendGame(ws *websocket.Conn, gameID string, userID string) error {
+	msg := &SocketMessage{Type: "game"}
+	if game, err := a.impl.GetGame(gameID, userID, ""); err != nil {
+		msg.Type = "error"
+		msg.Error = err.Error()
+	} else {
+		msg.Game = game
+		msg.TS = game.TS
+	}
+	return websocket.JSON.Send(ws, msg)
+}
+
+// Command runs a command from a game's WebSocket, the same way MoveAPI would
+// if it had been POSTed, and returns what MoveAPI would have sent back.
+func (a *api) command(gameID string, userID string, cmd *Command) (interface{}, error) {
+	move, ok := gameMoves[cmd.Type]
+	if !ok {
+		return nil, badRequest{fmt.Errorf("no such command: %v", cmd.Type)}
+	}
+
+	return move(a.impl, gameID, userID, func(dst interface{}) error {
+		if len(cmd.Params) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(cmd.Params, dst); err != nil {
+			return badRequest{err}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package splenda
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"http://splenda.example", true},
+		{"https://splenda.example", true},
+		{"http://evil.example", false},
+		{"http://splenda.example.evil.example", false},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, "http://splenda.example/api/games/g/socket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+
+		err = sameOrigin(&websocket.Config{}, req)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: expected ok=%v, got %v", test.origin, test.ok, err)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	a := &api{}
+	if _, err := a.command("game", "user1", &Command{Type: "cheat"}); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,139 @@
+package splenda
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Time control modes.
+const (
+	timePerMove = "move"
+	timeTotal   = "total"
+)
+
+// What to do when a player runs out of time.
+const (
+	timeoutPass   = "pass"
+	timeoutResign = "resign"
+	timeoutBot    = "bot"
+)
+
+// ValidateTimeControl checks that the given time controls make sense, filling
+// in the default timeout action if none was given.
+func validateTimeControl(tc *TimeControl) error {
+	if tc.Mode != timePerMove && tc.Mode != timeTotal {
+		return errors.New("time control mode must be move or total")
+	}
+	if tc.Seconds <= 0 {
+		return errors.New("time control must allow some time")
+	}
+
+	switch tc.Timeout {
+	case "":
+		tc.Timeout = timeoutPass
+	case timeoutPass, timeoutResign, timeoutBot:
+	default:
+		return errors.New("timeout must be pass, resign or bot")
+	}
+	return nil
+}
+
+// TimeLeft works out how much time each player still has, as of now. Players
+// who have resigned don't need any.
+func timeLeft(tc *TimeControl, state *GameState, started time.Time, used map[string]time.Duration, now time.Time) map[string]time.Duration {
+	limit := time.Duration(tc.Seconds) * time.Second
+
+	ret := map[string]time.Duration{}
+	for _, p := range state.Active() {
+		left := limit
+		if tc.Mode == timeTotal {
+			left -= used[p.ID]
+		}
+		if p.ID == state.Current && state.State != gameover {
+			left -= now.Sub(started)
+		}
+		if left < 0 {
+			left = 0
+		}
+		ret[p.ID] = left
+	}
+	return ret
+}
+
+// TimeoutMove picks the move to make for a player who has run out of time.
+func timeoutMove(tc *TimeControl, state *GameState) Move {
+	switch tc.Timeout {
+	case timeoutResign:
+		return Move{Type: moveResign, Player: state.Current}
+
+	case timeoutBot:
+		if move, err := BotMove(state, state.Current); err == nil {
+			return move
+		}
+	}
+	return Move{Type: moveTimeout, Player: state.Current}
+}
+
+// RunSweeper sweeps for players who have run out of time every interval,
+// forever, logging any sweep that fails. It's meant to be run in its own
+// goroutine.
+func (i *Impl) RunSweeper(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := i.Sweep(); err != nil {
+			log.Printf("sweeping for timeouts: %v", err)
+		}
+	}
+}
+
+// Sweep applies the timeout action in every game whose current player has
+// run out of time. It keeps going if one of the games fails, returning the
+// first error.
+func (i *Impl) Sweep() error {
+	ids, err := i.db.ListTimedGames()
+	if err != nil {
+		return err
+	}
+
+	var first error
+	for _, id := range ids {
+		if err := i.sweep(id); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Sweep applies the timeout action in the given game, if the current player
+// has run out of time.
+func (i *Impl) sweep(gameID string) error {
+	tx, err := i.db.NewTX(gameID)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	state, err := tx.LoadState()
+	if err != nil {
+		return err
+	}
+	tc, started, err := tx.GetTimeControl()
+	if err != nil {
+		return err
+	}
+	used, err := tx.GetTimeUsed()
+	if err != nil {
+		return err
+	}
+
+	if tc == nil || state.State == gameover {
+		return nil
+	}
+	if timeLeft(tc, state, started, used, i.clock.Now())[state.Current] > 0 {
+		return nil
+	}
+
+	m := mover{gameID: gameID, userID: state.Current, db: i.db, clock: i.clock, notify: i.notify, timedOut: true}
+	_, err = m.move(tx, state, timeoutMove(tc, state))
+	return err
+}
@@ -0,0 +1,69 @@
+package splenda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTimeControl(t *testing.T) {
+	tc := &TimeControl{Mode: timePerMove, Seconds: 60}
+	if err := validateTimeControl(tc); err != nil {
+		t.Fatal(err)
+	}
+	if tc.Timeout != timeoutPass {
+		t.Errorf("expected default timeout of pass, got %v", tc.Timeout)
+	}
+
+	bad := []*TimeControl{
+		{Mode: "blitz", Seconds: 60},
+		{Mode: timeTotal, Seconds: 0},
+		{Mode: timeTotal, Seconds: 60, Timeout: "cry"},
+	}
+	for _, tc := range bad {
+		if err := validateTimeControl(tc); err == nil {
+			t.Errorf("expected an error for %v", *tc)
+		}
+	}
+}
+
+func TestTimeLeft(t *testing.T) {
+	state := testState()
+	clock := mockclock{now: nowish.Add(90 * time.Second)}
+	used := map[string]time.Duration{"user1": time.Minute, "user2": 4 * time.Minute}
+
+	perMove := &TimeControl{Mode: timePerMove, Seconds: 120}
+	left := timeLeft(perMove, state, nowish, used, clock.Now())
+	if left["user1"] != 30*time.Second || left["user2"] != 2*time.Minute {
+		t.Errorf("bad time left per move: %v", left)
+	}
+
+	total := &TimeControl{Mode: timeTotal, Seconds: 300}
+	left = timeLeft(total, state, nowish, used, clock.Now())
+	if left["user1"] != 150*time.Second || left["user2"] != time.Minute {
+		t.Errorf("bad total time left: %v", left)
+	}
+
+	// Time never goes negative.
+	clock.now = laterish
+	left = timeLeft(total, state, nowish, used, clock.Now())
+	if left["user1"] != 0 {
+		t.Errorf("expected no time left, got %v", left["user1"])
+	}
+}
+
+func TestTimeoutMove(t *testing.T) {
+	state := testState()
+
+	tests := map[string]string{
+		timeoutPass:   moveTimeout,
+		timeoutResign: moveResign,
+		timeoutBot:    moveTake3,
+	}
+	for timeout, expected := range tests {
+		move := timeoutMove(&TimeControl{Mode: timePerMove, Seconds: 1, Timeout: timeout}, state)
+		if move.Type != expected || move.Player != "user1" {
+			t.Errorf("bad move for %v: expected %v, got %v", timeout, expected, move)
+		}
+		mustApply(t, state, move)
+	}
+}
@@ -1,6 +1,13 @@
 package splenda
 
-import "database/sql"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // TX is a single DB transaction on a specific game.
 type TX struct {
@@ -14,9 +21,11 @@ type TX struct {
 // Query Methods.
 //
 
-// IsPlaying returns true if the given player is playing in this game.
+// IsPlaying returns true if the given player is playing in this game. Only
+// its owner counts as playing in a sandbox.
 func (t *TX) IsPlaying(userID string) bool {
-	q := "SELECT 1 FROM players WHERE game_id = $1 AND user_id = $2"
+	q := "SELECT 1 FROM games WHERE id = $1 AND (sandbox = $2 OR (sandbox = '' AND " +
+		"EXISTS (SELECT 1 FROM players WHERE game_id = $1 AND user_id = $2)))"
 	row := t.tx.QueryRow(q, t.gameID, userID)
 
 	var ignored int
@@ -24,24 +33,49 @@ func (t *TX) IsPlaying(userID string) bool {
 	return err == nil
 }
 
-// GetGameBasics returns the basic info about a game.
+// GetGameBasics returns the basic info about a game, including which type of
+// game it is and whether it's a sandbox.
 func (t *TX) GetGameBasics() (*Game, error) {
-	q := "SELECT ts, state, current FROM games WHERE id = $1"
+	q := "SELECT type, sandbox, ts, state, current FROM games WHERE id = $1"
 	row := t.tx.QueryRow(q, t.gameID)
 
-	var ts, state, current string
-	if err := row.Scan(&ts, &state, &current); err != nil {
+	var typ, sandbox, ts, state, current string
+	if err := row.Scan(&typ, &sandbox, &ts, &state, &current); err != nil {
 		return nil, err
 	}
 
 	return &Game{
 		ID:      t.gameID,
+		Type:    typ,
+		Sandbox: sandbox != "",
 		TS:      ts,
 		State:   state,
 		Current: current,
 	}, nil
 }
 
+// CanWatch returns true if the given user can see this game: anyone can
+// watch a real game, but only its owner can see a sandbox.
+func (t *TX) CanWatch(userID string) bool {
+	q := "SELECT 1 FROM games WHERE id = $1 AND (sandbox = '' OR sandbox = $2)"
+	row := t.tx.QueryRow(q, t.gameID, userID)
+
+	var ignored int
+	err := row.Scan(&ignored)
+	return err == nil
+}
+
+// GetSandbox returns the owner of the game if it's a sandbox, or "" if it's
+// a real game.
+func (t *TX) GetSandbox() (string, error) {
+	q := "SELECT sandbox FROM games WHERE id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	var owner string
+	err := row.Scan(&owner)
+	return owner, err
+}
+
 // GetCoins returns the number of coins of each color on the table.
 func (t *TX) GetCoins() (map[string]int, error) {
 	q := "SELECT color, count FROM game_coins WHERE game_id = $1"
@@ -87,8 +121,31 @@ func (t *TX) GetNobles() ([]string, error) {
 	return nobles, rows.Err()
 }
 
-// GetCards returns the IDs of the cards from the given tier currently on the table.
-func (t *TX) GetCards(tier int) ([]string, error) {
+// GetCities returns the IDs of the cities on the table.
+func (t *TX) GetCities() ([]string, error) {
+	q := "SELECT city_id FROM game_cities WHERE game_id = $1 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := []string{}
+
+	for rows.Next() {
+		var city string
+		if err := rows.Scan(&city); err != nil {
+			return nil, err
+		}
+		cities = append(cities, city)
+	}
+
+	return cities, rows.Err()
+}
+
+// GetCards returns the IDs of the cards from the given tier currently on the
+// table, in a row of the given width.
+func (t *TX) GetCards(tier int, width int) ([]string, error) {
 	q := "SELECT index, card_id FROM game_cards WHERE game_id = $1 AND tier = $2"
 	rows, err := t.tx.Query(q, t.gameID, tier)
 	if err != nil {
@@ -96,7 +153,7 @@ func (t *TX) GetCards(tier int) ([]string, error) {
 	}
 	defer rows.Close()
 
-	cards := [4]string{}
+	cards := make([]string, width)
 
 	for rows.Next() {
 		var index int
@@ -104,53 +161,169 @@ func (t *TX) GetCards(tier int) ([]string, error) {
 		if err := rows.Scan(&index, &card); err != nil {
 			return nil, err
 		}
+		if index < 0 || index >= width {
+			return nil, fmt.Errorf("card %v is off the end of tier %v", card, tier)
+		}
 		cards[index] = card
 	}
 
-	return cards[:], rows.Err()
+	return cards, rows.Err()
 }
 
-// GetDecks gets the sizes of the decks for each tier.
-func (t *TX) GetDecks() ([]int, error) {
-	q := "SELECT tier, COUNT(*) FROM game_decks WHERE game_id = $1 GROUP BY tier"
-	rows, err := t.tx.Query(q, t.gameID)
+// GetDeck returns the IDs of the cards in the deck for the given tier, from the top down.
+func (t *TX) GetDeck(tier int) ([]string, error) {
+	q := "SELECT card_id FROM game_decks WHERE game_id = $1 AND tier = $2 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID, tier)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	counts := [3]int{0, 0, 0}
+	ids := []string{}
 
 	for rows.Next() {
-		var tier, count int
-		if err := rows.Scan(&tier, &count); err != nil {
+		var id string
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		counts[tier-1] = count
+		ids = append(ids, id)
 	}
 
-	return counts[:], rows.Err()
+	return ids, rows.Err()
 }
 
-// GetTopCard gets the top card on the given deck.
-func (t *TX) GetTopCard(tier int) (string, error) {
-	q := "SELECT card_id FROM game_decks WHERE game_id = $1 AND tier = $2 ORDER BY index ASC LIMIT 1"
+// GetOrientCards returns the IDs of the Orient cards from the given tier
+// currently on the table.
+func (t *TX) GetOrientCards(tier int) ([]string, error) {
+	q := "SELECT index, card_id FROM game_orient_cards WHERE game_id = $1 AND tier = $2"
 	rows, err := t.tx.Query(q, t.gameID, tier)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer rows.Close()
 
-	if !rows.Next() {
-		return "", nil
+	cards := make([]string, orientCardsPerTier)
+
+	for rows.Next() {
+		var index int
+		var card string
+		if err := rows.Scan(&index, &card); err != nil {
+			return nil, err
+		}
+		cards[index] = card
 	}
 
-	var id string
-	if err := rows.Scan(&id); err != nil {
-		return "", err
+	return cards, rows.Err()
+}
+
+// GetOrientDeck returns the IDs of the cards in the Orient deck for the given
+// tier, from the top down.
+func (t *TX) GetOrientDeck(tier int) ([]string, error) {
+	q := "SELECT card_id FROM game_orient_decks WHERE game_id = $1 AND tier = $2 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID, tier)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return id, nil
+	ids := []string{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetDuelTable returns the card set a Splendor Duel game is played with, the
+// number of privileges on the table, and whether the current player has
+// earned another turn.
+func (t *TX) GetDuelTable() (string, int, bool, error) {
+	q := "SELECT card_set, privileges, again FROM duel_games WHERE game_id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	var cardSet string
+	var privileges int
+	var again bool
+	if err := row.Scan(&cardSet, &privileges, &again); err != nil {
+		return "", 0, false, err
+	}
+	return cardSet, privileges, again, nil
+}
+
+// GetBoard returns the tokens on the Splendor Duel board, by cell.
+func (t *TX) GetBoard() ([]string, error) {
+	q := "SELECT index, color FROM duel_board WHERE game_id = $1"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	board := make([]string, boardCells)
+
+	for rows.Next() {
+		var index int
+		var color string
+		if err := rows.Scan(&index, &color); err != nil {
+			return nil, err
+		}
+		if index < 0 || index >= boardCells {
+			return nil, fmt.Errorf("token %v is off the board", index)
+		}
+		board[index] = color
+	}
+
+	return board, rows.Err()
+}
+
+// GetBag returns the tokens in the Splendor Duel bag, in the order they'll be
+// drawn.
+func (t *TX) GetBag() ([]string, error) {
+	q := "SELECT color FROM duel_bag WHERE game_id = $1 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bag := []string{}
+
+	for rows.Next() {
+		var color string
+		if err := rows.Scan(&color); err != nil {
+			return nil, err
+		}
+		bag = append(bag, color)
+	}
+
+	return bag, rows.Err()
+}
+
+// GetRoyals returns the IDs of the royals still on the table.
+func (t *TX) GetRoyals() ([]string, error) {
+	q := "SELECT royal_id FROM duel_royals WHERE game_id = $1 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	royals := []string{}
+
+	for rows.Next() {
+		var royal string
+		if err := rows.Scan(&royal); err != nil {
+			return nil, err
+		}
+		royals = append(royals, royal)
+	}
+
+	return royals, rows.Err()
 }
 
 // GetPlayers returns the IDs of the players in the game.
@@ -175,6 +348,51 @@ func (t *TX) GetPlayers() ([]string, error) {
 	return ids, rows.Err()
 }
 
+// GetResigned returns the set of players who have resigned from the game.
+func (t *TX) GetResigned() (map[string]bool, error) {
+	q := "SELECT user_id FROM players WHERE game_id = $1 AND resigned"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]bool{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// GetDeleteVotes returns the players who have voted to delete the game, in
+// seat order.
+func (t *TX) GetDeleteVotes() ([]string, error) {
+	q := "SELECT user_id FROM players WHERE game_id = $1 AND delete_vote ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
 // GetPlayerCoins returns the number of coins of each color that the given player has.
 func (t *TX) GetPlayerCoins(userID string) (map[string]int, error) {
 	q := "SELECT color, count FROM player_coins WHERE game_id = $1 AND user_id = $2"
@@ -220,9 +438,110 @@ func (t *TX) GetPlayerNobles(userID string) ([]string, error) {
 	return ids, nil
 }
 
+// GetPlayerCity returns the ID of the city the given player has qualified
+// for, or "" if they haven't.
+func (t *TX) GetPlayerCity(userID string) (string, error) {
+	q := "SELECT city_id FROM player_cities WHERE game_id = $1 AND user_id = $2"
+	row := t.tx.QueryRow(q, t.gameID, userID)
+
+	var id string
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// GetPlayerPosts returns the IDs of the trading posts the given player has
+// unlocked, in the order they unlocked them.
+func (t *TX) GetPlayerPosts(userID string) ([]string, error) {
+	q := "SELECT post_id FROM player_posts WHERE game_id = $1 AND user_id = $2 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetPlayerJokers returns the color each of the given player's joker cards
+// is copying.
+func (t *TX) GetPlayerJokers(userID string) (map[string]string, error) {
+	q := "SELECT card_id, color FROM player_jokers WHERE game_id = $1 AND user_id = $2"
+	rows, err := t.tx.Query(q, t.gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jokers map[string]string
+
+	for rows.Next() {
+		var id, color string
+		if err := rows.Scan(&id, &color); err != nil {
+			return nil, err
+		}
+		if jokers == nil {
+			jokers = map[string]string{}
+		}
+		jokers[id] = color
+	}
+
+	return jokers, rows.Err()
+}
+
+// GetPlayerPrivileges returns the number of privileges the given player
+// holds in a Splendor Duel game.
+func (t *TX) GetPlayerPrivileges(userID string) (int, error) {
+	q := "SELECT privileges FROM duel_players WHERE game_id = $1 AND user_id = $2"
+	row := t.tx.QueryRow(q, t.gameID, userID)
+
+	var privileges int
+	if err := row.Scan(&privileges); err != nil {
+		return 0, err
+	}
+	return privileges, nil
+}
+
+// GetPlayerRoyals returns the IDs of the royals the given player has claimed,
+// in the order they claimed them.
+func (t *TX) GetPlayerRoyals(userID string) ([]string, error) {
+	q := "SELECT royal_id FROM duel_player_royals WHERE game_id = $1 AND user_id = $2 ORDER BY index ASC"
+	rows, err := t.tx.Query(q, t.gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	royals := []string{}
+
+	for rows.Next() {
+		var royal string
+		if err := rows.Scan(&royal); err != nil {
+			return nil, err
+		}
+		royals = append(royals, royal)
+	}
+
+	return royals, rows.Err()
+}
+
 // GetPlayerCards returns the IDs of the cards the given player has.
 func (t *TX) GetPlayerCards(userID string) ([]string, []string, error) {
-	q := "SELECT card_id, reserved FROM player_cards WHERE game_id = $1 AND user_id = $2"
+	q := "SELECT card_id, reserved FROM player_cards WHERE game_id = $1 AND user_id = $2 ORDER BY index ASC"
 	rows, err := t.tx.Query(q, t.gameID, userID)
 	if err != nil {
 		return nil, nil, err
@@ -249,87 +568,351 @@ func (t *TX) GetPlayerCards(userID string) ([]string, []string, error) {
 	return ids, reserved, nil
 }
 
-//
-// Insert Methods.
-//
+// GetHiddenCards returns the IDs of the given player's reserved cards that
+// were reserved blind and should only be visible to that player.
+func (t *TX) GetHiddenCards(userID string) (map[string]bool, error) {
+	q := "SELECT card_id FROM player_cards WHERE game_id = $1 AND user_id = $2 AND reserved AND hidden"
+	rows, err := t.tx.Query(q, t.gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-// InsertGame inserts a new game record with the given first player.
-func (t *TX) InsertGame(firstPlayer string) error {
-	q := "INSERT INTO games (id, ts, state, current) VALUES ($1, $2, $3, $4)"
-	_, err := t.tx.Exec(q, t.gameID, 0, "play", firstPlayer)
-	return err
-}
+	ids := map[string]bool{}
 
-// InsertCoins inserts the given initial coin records.
-func (t *TX) InsertCoins(coins map[string]int) error {
-	q := "INSERT INTO game_coins (game_id, color, count) VALUES ($1, $2, $3)"
-	for color, count := range coins {
-		if _, err := t.tx.Exec(q, t.gameID, color, count); err != nil {
-			return err
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
+		ids[id] = true
 	}
-	return nil
+
+	return ids, rows.Err()
 }
 
-// InsertNobles inserts the given initial noble IDs.
-func (t *TX) InsertNobles(nobles []string) error {
-	q := "INSERT INTO game_nobles (game_id, index, noble_id) VALUES ($1, $2, $3)"
-	for i, noble := range nobles {
-		if _, err := t.tx.Exec(q, t.gameID, i, noble); err != nil {
-			return err
-		}
+// GetOptions returns the house rules the game is being played with.
+func (t *TX) GetOptions() (Options, error) {
+	q := "SELECT options FROM games WHERE id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	var str string
+	if err := row.Scan(&str); err != nil {
+		return Options{}, err
 	}
-	return nil
+
+	opts := Options{}
+	err := json.Unmarshal([]byte(str), &opts)
+	return opts, err
 }
 
-// InsertCards inserts the given set of cards for each tier.
-func (t *TX) InsertCards(t1 []string, t2 []string, t3 []string) error {
-	if err := t.doInsertCards(1, t1); err != nil {
-		return err
-	}
-	if err := t.doInsertCards(2, t2); err != nil {
-		return err
+// GetTimeControl returns the game's time controls and when the current turn
+// started. The time controls are nil if the game doesn't have any.
+func (t *TX) GetTimeControl() (*TimeControl, time.Time, error) {
+	q := "SELECT time_mode, time_limit, time_action, turn_started FROM games WHERE id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	tc := &TimeControl{}
+	var started time.Time
+	if err := row.Scan(&tc.Mode, &tc.Seconds, &tc.Timeout, &started); err != nil {
+		return nil, time.Time{}, err
 	}
-	if err := t.doInsertCards(3, t3); err != nil {
-		return err
+	if tc.Mode == "" {
+		return nil, started, nil
 	}
-	return nil
+	return tc, started, nil
 }
 
-func (t *TX) doInsertCards(tier int, cards []string) error {
-	q := "INSERT INTO game_cards (game_id, tier, index, card_id) VALUES ($1, $2, $3, $4)"
-	for i, card := range cards {
-		if _, err := t.tx.Exec(q, t.gameID, tier, i, card); err != nil {
-			return err
+// GetTimeUsed returns how much time each player has spent on their turns so
+// far, not counting the turn in progress.
+func (t *TX) GetTimeUsed() (map[string]time.Duration, error) {
+	q := "SELECT user_id, time_used FROM players WHERE game_id = $1"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	used := map[string]time.Duration{}
+
+	for rows.Next() {
+		var id string
+		var ms int64
+		if err := rows.Scan(&id, &ms); err != nil {
+			return nil, err
 		}
+		used[id] = time.Duration(ms) * time.Millisecond
 	}
-	return nil
+
+	return used, rows.Err()
 }
 
-// InsertDecks inserts the given decks for each tier.
-func (t *TX) InsertDecks(d1 []string, d2 []string, d3 []string) error {
-	if err := t.doInsertDecks(1, d1); err != nil {
-		return err
+// GetUndo returns the player who made the last move, whether they've asked
+// to take it back, and the state of the game before they made it. The state
+// is nil if there's no move that can be taken back.
+func (t *TX) GetUndo() (string, bool, *GameState, error) {
+	q := "SELECT user_id, requested, state FROM game_undo WHERE game_id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	var userID, data string
+	var requested bool
+	if err := row.Scan(&userID, &requested, &data); err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil, nil
+		}
+		return "", false, nil, err
+	}
+
+	state := &GameState{}
+	if err := json.Unmarshal([]byte(data), state); err != nil {
+		return "", false, nil, err
 	}
-	if err := t.doInsertDecks(2, d2); err != nil {
+
+	return userID, requested, state, nil
+}
+
+// GetStart loads the state the game was first dealt in into state, which
+// should be a *GameState or *DuelState to match the type of game.
+func (t *TX) GetStart(state interface{}) error {
+	q := "SELECT state FROM game_start WHERE game_id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	var data string
+	if err := row.Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("this game can't be replayed")
+		}
 		return err
 	}
-	if err := t.doInsertDecks(3, d3); err != nil {
+
+	return json.Unmarshal([]byte(data), state)
+}
+
+// GetHistory returns every move made in the game, oldest first.
+func (t *TX) GetHistory() ([]*HistoryEntry, error) {
+	q := "SELECT ts, made, user_id, move_type, params, coins, card_id, noble_id FROM game_moves " +
+		"WHERE game_id = $1 ORDER BY seq ASC"
+	rows, err := t.tx.Query(q, t.gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*HistoryEntry{}
+
+	for rows.Next() {
+		e := &HistoryEntry{}
+		var params, coins string
+		if err := rows.Scan(&e.TS, &e.Time, &e.Player, &e.Type, &params, &coins, &e.Card, &e.Noble); err != nil {
+			return nil, err
+		}
+		e.Params = json.RawMessage(params)
+		if err := json.Unmarshal([]byte(coins), &e.Coins); err != nil {
+			return nil, err
+		}
+		if len(e.Coins) == 0 {
+			e.Coins = nil
+		}
+		history = append(history, e)
+	}
+
+	return history, rows.Err()
+}
+
+// GetVersion returns a tag that changes every time the game does. The
+// timestamp alone won't do, since it goes back when a move is taken back and
+// can then repeat for a different move; the history only ever grows. Delete
+// votes and undo requests count too, since they don't touch the timestamp:
+// between moves an undo only goes from offered (1) to requested (2) to
+// declined (0), so it never repeats either.
+func (t *TX) GetVersion() (string, error) {
+	q := "SELECT ts, " +
+		"(SELECT count(*) FROM game_moves WHERE game_id = $1), " +
+		"(SELECT count(*) FROM players WHERE game_id = $1 AND delete_vote), " +
+		"COALESCE((SELECT CASE WHEN requested THEN 2 ELSE 1 END FROM game_undo WHERE game_id = $1), 0) " +
+		"FROM games WHERE id = $1"
+	row := t.tx.QueryRow(q, t.gameID)
+
+	var ts, moves, votes, undo int
+	if err := row.Scan(&ts, &moves, &votes, &undo); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v.%v.%v.%v", ts, moves, votes, undo), nil
+}
+
+// LockGame locks the game record until the transaction is done, failing if
+// someone else has moved since curTS.
+func (t *TX) LockGame(curTS int) error {
+	q := "SELECT ts FROM games WHERE id = $1 AND ts = $2 FOR UPDATE"
+	row := t.tx.QueryRow(q, t.gameID, curTS)
+
+	var ignored int
+	return row.Scan(&ignored)
+}
+
+//
+// Insert Methods.
+//
+
+// InsertGame inserts a new game record with the given first player and house rules.
+func (t *TX) InsertGame(firstPlayer string, opts Options) error {
+	bs, err := json.Marshal(opts)
+	if err != nil {
 		return err
 	}
+
+	q := "INSERT INTO games (id, ts, state, current, options) VALUES ($1, $2, $3, $4, $5)"
+	_, err = t.tx.Exec(q, t.gameID, 0, "play", firstPlayer, string(bs))
+	return err
+}
+
+// InsertDuelGame inserts a new Splendor Duel game record with the given first
+// player.
+func (t *TX) InsertDuelGame(firstPlayer string) error {
+	q := "INSERT INTO games (id, type, ts, state, current) VALUES ($1, $2, $3, $4, $5)"
+	_, err := t.tx.Exec(q, t.gameID, gameDuel, 0, "play", firstPlayer)
+	return err
+}
+
+// InsertDuelTable records the card set a Splendor Duel game is played with,
+// the number of privileges on the table, and whether the current player has
+// earned another turn.
+func (t *TX) InsertDuelTable(cardSet string, privileges int, again bool) error {
+	q := "INSERT INTO duel_games (game_id, card_set, privileges, again) VALUES ($1, $2, $3, $4)"
+	_, err := t.tx.Exec(q, t.gameID, cardSet, privileges, again)
+	return err
+}
+
+// InsertBoard inserts the tokens on the Splendor Duel board. Empty cells are
+// skipped.
+func (t *TX) InsertBoard(board []string) error {
+	q := "INSERT INTO duel_board (game_id, index, color) VALUES ($1, $2, $3)"
+	for i, color := range board {
+		if color == "" {
+			continue
+		}
+		if _, err := t.tx.Exec(q, t.gameID, i, color); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (t *TX) doInsertDecks(tier int, cards []string) error {
-	q := "INSERT INTO game_decks (game_id, tier, index, card_id) VALUES ($1, $2, $3, $4)"
-	for i, card := range cards {
-		if _, err := t.tx.Exec(q, t.gameID, tier, i, card); err != nil {
+// InsertBag inserts the tokens in the Splendor Duel bag.
+func (t *TX) InsertBag(bag []string) error {
+	q := "INSERT INTO duel_bag (game_id, index, color) VALUES ($1, $2, $3)"
+	for i, color := range bag {
+		if _, err := t.tx.Exec(q, t.gameID, i, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertRoyals inserts the royals on the table.
+func (t *TX) InsertRoyals(royals []string) error {
+	q := "INSERT INTO duel_royals (game_id, index, royal_id) VALUES ($1, $2, $3)"
+	for i, royal := range royals {
+		if _, err := t.tx.Exec(q, t.gameID, i, royal); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// InsertCoins inserts the given initial coin records.
+func (t *TX) InsertCoins(coins map[string]int) error {
+	q := "INSERT INTO game_coins (game_id, color, count) VALUES ($1, $2, $3)"
+	for color, count := range coins {
+		if _, err := t.tx.Exec(q, t.gameID, color, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertNobles inserts the given initial noble IDs.
+func (t *TX) InsertNobles(nobles []string) error {
+	q := "INSERT INTO game_nobles (game_id, index, noble_id) VALUES ($1, $2, $3)"
+	for i, noble := range nobles {
+		if _, err := t.tx.Exec(q, t.gameID, i, noble); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertCities inserts the given initial city records.
+func (t *TX) InsertCities(cities []string) error {
+	q := "INSERT INTO game_cities (game_id, index, city_id) VALUES ($1, $2, $3)"
+	for i, city := range cities {
+		if _, err := t.tx.Exec(q, t.gameID, i, city); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertCards inserts the given set of face-up cards for each tier. Empty
+// spots are skipped.
+func (t *TX) InsertCards(tiers [][]string) error {
+	q := "INSERT INTO game_cards (game_id, tier, index, card_id) VALUES ($1, $2, $3, $4)"
+	for i, cards := range tiers {
+		for j, card := range cards {
+			if card == "" {
+				continue
+			}
+			if _, err := t.tx.Exec(q, t.gameID, i+1, j, card); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// InsertDecks inserts the given decks for each tier.
+func (t *TX) InsertDecks(decks [][]string) error {
+	q := "INSERT INTO game_decks (game_id, tier, index, card_id) VALUES ($1, $2, $3, $4)"
+	for i, cards := range decks {
+		for j, card := range cards {
+			if _, err := t.tx.Exec(q, t.gameID, i+1, j, card); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// InsertOrientCards inserts the given set of face-up Orient cards for each
+// tier. Empty spots are skipped.
+func (t *TX) InsertOrientCards(tiers [][]string) error {
+	q := "INSERT INTO game_orient_cards (game_id, tier, index, card_id) VALUES ($1, $2, $3, $4)"
+	for i, cards := range tiers {
+		for j, card := range cards {
+			if card == "" {
+				continue
+			}
+			if _, err := t.tx.Exec(q, t.gameID, i+1, j, card); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// InsertOrientDecks inserts the given Orient decks for each tier.
+func (t *TX) InsertOrientDecks(decks [][]string) error {
+	q := "INSERT INTO game_orient_decks (game_id, tier, index, card_id) VALUES ($1, $2, $3, $4)"
+	for i, cards := range decks {
+		for j, card := range cards {
+			if _, err := t.tx.Exec(q, t.gameID, i+1, j, card); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // InsertPlayers inserts initial player records for each of the given users.
 func (t *TX) InsertPlayers(userIDs []string) error {
 	q := "INSERT INTO players (game_id, user_id, index) VALUES ($1, $2, $3)"
@@ -341,62 +924,151 @@ func (t *TX) InsertPlayers(userIDs []string) error {
 	return nil
 }
 
-// InsertPlayerCoins inserts zeros for the given player's coin balance.
-func (t *TX) InsertPlayerCoins(userID string, colors []string) error {
+// InsertPlayerCoins inserts the given player's coin balance.
+func (t *TX) InsertPlayerCoins(userID string, coins map[string]int) error {
 	q := "INSERT INTO player_coins (game_id, user_id, color, count) VALUES ($1, $2, $3, $4)"
-	for _, color := range colors {
-		if _, err := t.tx.Exec(q, t.gameID, userID, color, 0); err != nil {
+	for color, count := range coins {
+		if _, err := t.tx.Exec(q, t.gameID, userID, color, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertPlayerNobles inserts the nobles the given player has.
+func (t *TX) InsertPlayerNobles(userID string, nobles []string) error {
+	q := "INSERT INTO player_nobles (game_id, user_id, noble_id) VALUES ($1, $2, $3)"
+	for _, noble := range nobles {
+		if _, err := t.tx.Exec(q, t.gameID, userID, noble); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// InsertPlayerCard inserts a card into the player's hand.
-func (t *TX) InsertPlayerCard(userID string, cardID string, reserved bool) error {
-	q := "INSERT INTO player_cards (game_id, user_id, card_id, reserved) VALUES ($1, $2, $3, $4)"
-	_, err := t.tx.Exec(q, t.gameID, userID, cardID, reserved)
+// InsertPlayerCity records the city the given player has qualified for, if any.
+func (t *TX) InsertPlayerCity(userID string, city string) error {
+	if city == "" {
+		return nil
+	}
+	q := "INSERT INTO player_cities (game_id, user_id, city_id) VALUES ($1, $2, $3)"
+	_, err := t.tx.Exec(q, t.gameID, userID, city)
 	return err
 }
 
-//
-// Update Methods.
-//
+// InsertPlayerPosts inserts the trading posts the given player has unlocked.
+func (t *TX) InsertPlayerPosts(userID string, posts []string) error {
+	q := "INSERT INTO player_posts (game_id, user_id, index, post_id) VALUES ($1, $2, $3, $4)"
+	for i, post := range posts {
+		if _, err := t.tx.Exec(q, t.gameID, userID, i, post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-// UpdateCoins updates the given coin records.
-func (t *TX) UpdateCoins(coins map[string]int) error {
-	q := "UPDATE game_coins SET count = $1 WHERE game_id = $2 AND color = $3"
-	for color, count := range coins {
-		if _, err := t.tx.Exec(q, count, t.gameID, color); err != nil {
+// InsertPlayerJokers records the color each of the given player's joker
+// cards is copying.
+func (t *TX) InsertPlayerJokers(userID string, jokers map[string]string) error {
+	q := "INSERT INTO player_jokers (game_id, user_id, card_id, color) VALUES ($1, $2, $3, $4)"
+	for card, color := range jokers {
+		if _, err := t.tx.Exec(q, t.gameID, userID, card, color); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// UpdatePlayerCoins updates the given coin records.
-func (t *TX) UpdatePlayerCoins(userID string, coins map[string]int) error {
-	q := "UPDATE player_coins SET count = $1 WHERE game_id = $2 AND user_id = $3 AND color = $4"
-	for color, count := range coins {
-		if _, err := t.tx.Exec(q, count, t.gameID, userID, color); err != nil {
+// InsertPlayerPrivileges records how many privileges the given player holds.
+func (t *TX) InsertPlayerPrivileges(userID string, privileges int) error {
+	q := "INSERT INTO duel_players (game_id, user_id, privileges) VALUES ($1, $2, $3)"
+	_, err := t.tx.Exec(q, t.gameID, userID, privileges)
+	return err
+}
+
+// InsertPlayerRoyals inserts the royals the given player has claimed.
+func (t *TX) InsertPlayerRoyals(userID string, royals []string) error {
+	q := "INSERT INTO duel_player_royals (game_id, user_id, index, royal_id) VALUES ($1, $2, $3, $4)"
+	for i, royal := range royals {
+		if _, err := t.tx.Exec(q, t.gameID, userID, i, royal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertPlayerCards inserts the cards in the given player's hand, both bought
+// and reserved.
+func (t *TX) InsertPlayerCards(userID string, cards []string, reserved []string, hidden []string) error {
+	q := "INSERT INTO player_cards (game_id, user_id, index, card_id, reserved, hidden) VALUES ($1, $2, $3, $4, $5, $6)"
+	for i, card := range cards {
+		if _, err := t.tx.Exec(q, t.gameID, userID, i, card, false, false); err != nil {
+			return err
+		}
+	}
+	for i, card := range reserved {
+		if _, err := t.tx.Exec(q, t.gameID, userID, i, card, true, find(card, hidden) != -1); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// UpdatePlayerCard updates a card in the player's hand.
-func (t *TX) UpdatePlayerCard(userID string, cardID string, reserved bool) error {
-	q := "UPDATE player_cards SET reserved = $1 WHERE game_id = $2 AND user_id = $3 AND card_id = $4"
-	_, err := t.tx.Exec(q, reserved, t.gameID, userID, cardID)
+// InsertUndo records the state of the game before the given player's move,
+// replacing (and so expiring) any earlier one.
+func (t *TX) InsertUndo(userID string, state *GameState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if err := t.DeleteUndo(); err != nil {
+		return err
+	}
+
+	q := "INSERT INTO game_undo (game_id, user_id, state) VALUES ($1, $2, $3)"
+	_, err = t.tx.Exec(q, t.gameID, userID, string(data))
+	return err
+}
+
+// InsertStart records the state the game was first dealt in.
+func (t *TX) InsertStart(state interface{}) error {
+	data, err := json.Marshal(state)
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	q := "INSERT INTO game_start (game_id, state) VALUES ($1, $2)"
+	_, err = t.tx.Exec(q, t.gameID, string(data))
 	return err
 }
 
+// InsertMove appends an entry to the game's history.
+func (t *TX) InsertMove(e *HistoryEntry) error {
+	params := string(e.Params)
+	if params == "" {
+		params = "{}"
+	}
+	coins, err := json.Marshal(e.Coins)
+	if err != nil {
+		return err
+	}
+	if e.Coins == nil {
+		coins = []byte("{}")
+	}
+
+	q := "INSERT INTO game_moves (game_id, ts, made, user_id, move_type, params, coins, card_id, noble_id) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	_, err = t.tx.Exec(q, t.gameID, e.TS, e.Time, e.Player, e.Type, params, string(coins), e.Card, e.Noble)
+	return err
+}
+
+//
+// Update Methods.
+//
+
 // UpdateGame updates the game state after a move.
-func (t *TX) UpdateGame(curTS string, newstate string, newcurrent string) (string, error) {
+func (t *TX) UpdateGame(curTS int, newstate string, newcurrent string) (string, error) {
 	q := "UPDATE games SET ts = ts+1, state = $1, current = $2 WHERE id = $3 AND ts = $4 RETURNING ts"
 	row := t.tx.QueryRow(q, newstate, newcurrent, t.gameID, curTS)
 
@@ -408,26 +1080,141 @@ func (t *TX) UpdateGame(curTS string, newstate string, newcurrent string) (strin
 	return newts, nil
 }
 
-// TransferCard transfers a card from a deck to the table.
-func (t *TX) TransferCard(tier int, index int, cardID string) error {
-	q := "DELETE FROM game_decks WHERE game_id = $1 AND tier = $2 AND card_id = $3"
-	if _, err := t.tx.Exec(q, t.gameID, tier, cardID); err != nil {
-		return err
+// UpdateResigned records which of the players have resigned.
+func (t *TX) UpdateResigned(players []*PlayerState) error {
+	q := "UPDATE players SET resigned = $3 WHERE game_id = $1 AND user_id = $2"
+	for _, p := range players {
+		if _, err := t.tx.Exec(q, t.gameID, p.ID, p.Resigned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateDuelResigned records which of the players in a Splendor Duel game
+// have resigned.
+func (t *TX) UpdateDuelResigned(players []*DuelPlayerState) error {
+	q := "UPDATE players SET resigned = $3 WHERE game_id = $1 AND user_id = $2"
+	for _, p := range players {
+		if _, err := t.tx.Exec(q, t.gameID, p.ID, p.Resigned); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	q = "UPDATE game_cards SET card_id = $1 WHERE game_id = $2 AND tier = $3 AND index = $4"
-	_, err := t.tx.Exec(q, cardID, t.gameID, tier, index)
+// UpdateSandbox marks the game as a sandbox belonging to the given user.
+func (t *TX) UpdateSandbox(owner string) error {
+	q := "UPDATE games SET sandbox = $2 WHERE id = $1"
+	_, err := t.tx.Exec(q, t.gameID, owner)
 	return err
 }
 
+// UpdateDeleteVote records that the given player wants the game deleted.
+func (t *TX) UpdateDeleteVote(userID string) error {
+	q := "UPDATE players SET delete_vote = TRUE WHERE game_id = $1 AND user_id = $2"
+	_, err := t.tx.Exec(q, t.gameID, userID)
+	return err
+}
+
+// UpdateTimeControl sets the game's time controls, starting the clock on the
+// first turn.
+func (t *TX) UpdateTimeControl(tc *TimeControl, started time.Time) error {
+	q := "UPDATE games SET time_mode = $2, time_limit = $3, time_action = $4, turn_started = $5 WHERE id = $1"
+	_, err := t.tx.Exec(q, t.gameID, tc.Mode, tc.Seconds, tc.Timeout, started)
+	return err
+}
+
+// UpdateTurnStarted records when the current turn started.
+func (t *TX) UpdateTurnStarted(started time.Time) error {
+	q := "UPDATE games SET turn_started = $2 WHERE id = $1"
+	_, err := t.tx.Exec(q, t.gameID, started)
+	return err
+}
+
+// UpdateTimeUsed adds to the time the given player has spent on their turns.
+func (t *TX) UpdateTimeUsed(userID string, used time.Duration) error {
+	q := "UPDATE players SET time_used = time_used + $3 WHERE game_id = $1 AND user_id = $2"
+	_, err := t.tx.Exec(q, t.gameID, userID, int64(used/time.Millisecond))
+	return err
+}
+
+// UpdateUndo records that the player who made the last move wants to take it back.
+func (t *TX) UpdateUndo(requested bool) error {
+	q := "UPDATE game_undo SET requested = $1 WHERE game_id = $2"
+	_, err := t.tx.Exec(q, requested, t.gameID)
+	return err
+}
+
+// RestoreGame puts the game record back the way it was at an earlier point.
+func (t *TX) RestoreGame(curTS int, ts int, state string, current string) error {
+	q := "UPDATE games SET ts = $1, state = $2, current = $3 WHERE id = $4 AND ts = $5 RETURNING ts"
+	row := t.tx.QueryRow(q, ts, state, current, t.gameID, curTS)
+
+	var ignored int
+	return row.Scan(&ignored)
+}
+
 //
 // Delete Methods.
 //
 
-// DeleteCard removes a card from the board when the corresponding deck is empty.
-func (t *TX) DeleteCard(tier int, index int) error {
-	q := "DELETE FROM game_cards WHERE game_id = $1 AND tier = $2 AND index = $3"
-	_, err := t.tx.Exec(q, t.gameID, tier, index)
+// DeleteState deletes everything on the table and in the players' hands, so
+// that it can be replaced.
+func (t *TX) DeleteState() error {
+	tables := []string{
+		"game_coins",
+		"game_nobles",
+		"game_cities",
+		"game_cards",
+		"game_decks",
+		"game_orient_cards",
+		"game_orient_decks",
+		"player_coins",
+		"player_nobles",
+		"player_cities",
+		"player_posts",
+		"player_jokers",
+		"player_cards",
+	}
+	for _, table := range tables {
+		q := "DELETE FROM " + table + " WHERE game_id = $1"
+		if _, err := t.tx.Exec(q, t.gameID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteDuelState deletes everything on the table and in the players' hands
+// in a Splendor Duel game, so that it can be replaced.
+func (t *TX) DeleteDuelState() error {
+	tables := []string{
+		"duel_games",
+		"duel_board",
+		"duel_bag",
+		"duel_royals",
+		"game_cards",
+		"game_decks",
+		"player_coins",
+		"player_jokers",
+		"player_cards",
+		"duel_players",
+		"duel_player_royals",
+	}
+	for _, table := range tables {
+		q := "DELETE FROM " + table + " WHERE game_id = $1"
+		if _, err := t.tx.Exec(q, t.gameID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUndo removes the record of the last move once it can no longer be taken back.
+func (t *TX) DeleteUndo() error {
+	q := "DELETE FROM game_undo WHERE game_id = $1"
+	_, err := t.tx.Exec(q, t.gameID)
 	return err
 }
 
@@ -438,6 +1225,388 @@ func (t *TX) DeleteGame() error {
 	return err
 }
 
+//
+// State Methods.
+//
+
+// LoadState loads the complete state of the game.
+func (t *TX) LoadState() (*GameState, error) {
+	game, err := t.GetGameBasics()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no such game")
+		}
+		return nil, err
+	}
+	if game.Type != gameSplendor {
+		return nil, errors.New("not a Splendor game")
+	}
+	ts, err := strconv.Atoi(game.TS)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &GameState{
+		TS:      ts,
+		State:   game.State,
+		Current: game.Current,
+	}
+
+	if s.Coins, err = t.GetCoins(); err != nil {
+		return nil, err
+	}
+	if s.Nobles, err = t.GetNobles(); err != nil {
+		return nil, err
+	}
+	if s.Cities, err = t.GetCities(); err != nil {
+		return nil, err
+	}
+
+	userIDs, err := t.GetPlayers()
+	if err != nil {
+		return nil, err
+	}
+	resigned, err := t.GetResigned()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := t.GetOptions()
+	if err != nil {
+		return nil, err
+	}
+	s.Options = opts.withDefaults(len(userIDs))
+
+	for tier := 1; tier <= numTiers; tier++ {
+		cards, err := t.GetCards(tier, s.Options.CardsPerTier)
+		if err != nil {
+			return nil, err
+		}
+		s.Cards = append(s.Cards, cards)
+
+		deck, err := t.GetDeck(tier)
+		if err != nil {
+			return nil, err
+		}
+		s.Decks = append(s.Decks, deck)
+	}
+
+	if s.Options.Mode == modeOrient {
+		for tier := 1; tier <= numTiers; tier++ {
+			cards, err := t.GetOrientCards(tier)
+			if err != nil {
+				return nil, err
+			}
+			s.Orient = append(s.Orient, cards)
+
+			deck, err := t.GetOrientDeck(tier)
+			if err != nil {
+				return nil, err
+			}
+			s.OrientDecks = append(s.OrientDecks, deck)
+		}
+	}
+
+	for _, userID := range userIDs {
+		p := &PlayerState{ID: userID, Resigned: resigned[userID]}
+
+		if p.Coins, err = t.GetPlayerCoins(userID); err != nil {
+			return nil, err
+		}
+		if p.Nobles, err = t.GetPlayerNobles(userID); err != nil {
+			return nil, err
+		}
+		if p.City, err = t.GetPlayerCity(userID); err != nil {
+			return nil, err
+		}
+		if p.Posts, err = t.GetPlayerPosts(userID); err != nil {
+			return nil, err
+		}
+		if p.Jokers, err = t.GetPlayerJokers(userID); err != nil {
+			return nil, err
+		}
+		if p.Cards, p.Reserved, err = t.GetPlayerCards(userID); err != nil {
+			return nil, err
+		}
+
+		hidden, err := t.GetHiddenCards(userID)
+		if err != nil {
+			return nil, err
+		}
+		p.Hidden = []string{}
+		for _, id := range p.Reserved {
+			if hidden[id] {
+				p.Hidden = append(p.Hidden, id)
+			}
+		}
+
+		s.Players = append(s.Players, p)
+	}
+
+	return s, nil
+}
+
+// InsertState inserts everything on the table and in the players' hands. The
+// game and player records must already exist.
+func (t *TX) InsertState(s *GameState) error {
+	if err := t.InsertCoins(s.Coins); err != nil {
+		return err
+	}
+	if err := t.InsertNobles(s.Nobles); err != nil {
+		return err
+	}
+	if err := t.InsertCities(s.Cities); err != nil {
+		return err
+	}
+	if err := t.InsertCards(s.Cards); err != nil {
+		return err
+	}
+	if err := t.InsertDecks(s.Decks); err != nil {
+		return err
+	}
+	if err := t.InsertOrientCards(s.Orient); err != nil {
+		return err
+	}
+	if err := t.InsertOrientDecks(s.OrientDecks); err != nil {
+		return err
+	}
+
+	for _, p := range s.Players {
+		if err := t.InsertPlayerCoins(p.ID, p.Coins); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerNobles(p.ID, p.Nobles); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerCity(p.ID, p.City); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerPosts(p.ID, p.Posts); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerJokers(p.ID, p.Jokers); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerCards(p.ID, p.Cards, p.Reserved, p.Hidden); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveState saves the state of the game after a move, returning the new
+// timestamp. It fails if someone else has moved since curTS.
+func (t *TX) SaveState(curTS int, s *GameState) (string, error) {
+	ts, err := t.UpdateGame(curTS, s.State, s.Current)
+	if err != nil {
+		return "", err
+	}
+
+	if err := t.UpdateResigned(s.Players); err != nil {
+		return "", err
+	}
+	if err := t.DeleteState(); err != nil {
+		return "", err
+	}
+	if err := t.InsertState(s); err != nil {
+		return "", err
+	}
+
+	return ts, nil
+}
+
+// RestoreState puts the whole game back to an earlier state, including its
+// timestamp. It fails if someone else has moved since curTS.
+func (t *TX) RestoreState(curTS int, s *GameState) error {
+	if err := t.RestoreGame(curTS, s.TS, s.State, s.Current); err != nil {
+		return err
+	}
+	if err := t.UpdateResigned(s.Players); err != nil {
+		return err
+	}
+
+	if err := t.DeleteState(); err != nil {
+		return err
+	}
+	return t.InsertState(s)
+}
+
+// RestoreDuelState puts a whole Splendor Duel game back to an earlier state,
+// including its timestamp. It fails if someone else has moved since curTS.
+func (t *TX) RestoreDuelState(curTS int, s *DuelState) error {
+	if err := t.RestoreGame(curTS, s.TS, s.State, s.Current); err != nil {
+		return err
+	}
+	if err := t.UpdateDuelResigned(s.Players); err != nil {
+		return err
+	}
+
+	if err := t.DeleteDuelState(); err != nil {
+		return err
+	}
+	return t.InsertDuelState(s)
+}
+
+// LoadDuelState loads the complete state of a Splendor Duel game.
+func (t *TX) LoadDuelState() (*DuelState, error) {
+	game, err := t.GetGameBasics()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("no such game")
+		}
+		return nil, err
+	}
+	if game.Type != gameDuel {
+		return nil, errors.New("not a Splendor Duel game")
+	}
+	ts, err := strconv.Atoi(game.TS)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DuelState{
+		TS:      ts,
+		State:   game.State,
+		Current: game.Current,
+	}
+
+	if s.CardSet, s.Privileges, s.Again, err = t.GetDuelTable(); err != nil {
+		return nil, err
+	}
+	if s.Board, err = t.GetBoard(); err != nil {
+		return nil, err
+	}
+	if s.Bag, err = t.GetBag(); err != nil {
+		return nil, err
+	}
+	if s.Royals, err = t.GetRoyals(); err != nil {
+		return nil, err
+	}
+
+	for tier, width := range duelCardsPerTier {
+		cards, err := t.GetCards(tier+1, width)
+		if err != nil {
+			return nil, err
+		}
+		s.Cards = append(s.Cards, cards)
+
+		deck, err := t.GetDeck(tier + 1)
+		if err != nil {
+			return nil, err
+		}
+		s.Decks = append(s.Decks, deck)
+	}
+
+	userIDs, err := t.GetPlayers()
+	if err != nil {
+		return nil, err
+	}
+	resigned, err := t.GetResigned()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range userIDs {
+		p := &DuelPlayerState{ID: userID, Resigned: resigned[userID]}
+
+		if p.Coins, err = t.GetPlayerCoins(userID); err != nil {
+			return nil, err
+		}
+		if p.Privileges, err = t.GetPlayerPrivileges(userID); err != nil {
+			return nil, err
+		}
+		if p.Royals, err = t.GetPlayerRoyals(userID); err != nil {
+			return nil, err
+		}
+		if p.Jokers, err = t.GetPlayerJokers(userID); err != nil {
+			return nil, err
+		}
+		if p.Cards, p.Reserved, err = t.GetPlayerCards(userID); err != nil {
+			return nil, err
+		}
+
+		hidden, err := t.GetHiddenCards(userID)
+		if err != nil {
+			return nil, err
+		}
+		p.Hidden = []string{}
+		for _, id := range p.Reserved {
+			if hidden[id] {
+				p.Hidden = append(p.Hidden, id)
+			}
+		}
+
+		s.Players = append(s.Players, p)
+	}
+
+	return s, nil
+}
+
+// InsertDuelState inserts everything on the table and in the players' hands
+// in a Splendor Duel game. The game and player records must already exist.
+func (t *TX) InsertDuelState(s *DuelState) error {
+	if err := t.InsertDuelTable(s.CardSet, s.Privileges, s.Again); err != nil {
+		return err
+	}
+	if err := t.InsertBoard(s.Board); err != nil {
+		return err
+	}
+	if err := t.InsertBag(s.Bag); err != nil {
+		return err
+	}
+	if err := t.InsertRoyals(s.Royals); err != nil {
+		return err
+	}
+	if err := t.InsertCards(s.Cards); err != nil {
+		return err
+	}
+	if err := t.InsertDecks(s.Decks); err != nil {
+		return err
+	}
+
+	for _, p := range s.Players {
+		if err := t.InsertPlayerCoins(p.ID, p.Coins); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerPrivileges(p.ID, p.Privileges); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerRoyals(p.ID, p.Royals); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerJokers(p.ID, p.Jokers); err != nil {
+			return err
+		}
+		if err := t.InsertPlayerCards(p.ID, p.Cards, p.Reserved, p.Hidden); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveDuelState saves the state of a Splendor Duel game after a move,
+// returning the new timestamp. It fails if someone else has moved since curTS.
+func (t *TX) SaveDuelState(curTS int, s *DuelState) (string, error) {
+	ts, err := t.UpdateGame(curTS, s.State, s.Current)
+	if err != nil {
+		return "", err
+	}
+
+	if err := t.UpdateDuelResigned(s.Players); err != nil {
+		return "", err
+	}
+	if err := t.DeleteDuelState(); err != nil {
+		return "", err
+	}
+	if err := t.InsertDuelState(s); err != nil {
+		return "", err
+	}
+
+	return ts, nil
+}
+
 // Commit commits the current transaction.
 func (t *TX) Commit() error {
 	if err := t.tx.Commit(); err != nil {
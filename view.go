@@ -0,0 +1,59 @@
+package splenda
+
+// View cuts a game down to what the given viewer is allowed to see. The Game
+// passed in is built with everything visible, and cards reserved blind are
+// marked hidden; only the player who reserved one gets to see what it is, and
+// everyone else sees just its tier. Deck order is never part of a Game, only
+// how many cards are left. Spectators, anyone not playing, only get the
+// public parts of the game, so they don't see delete votes either.
+func view(game *Game, viewer string) *Game {
+	seated := false
+
+	for _, p := range game.Players {
+		mine := p.ID == viewer
+		seated = seated || mine
+
+		reserved := []*Card{}
+		for _, card := range p.Reserved {
+			switch {
+			case !card.Hidden:
+				reserved = append(reserved, card)
+			case mine:
+				c := *card
+				c.Hidden = false
+				reserved = append(reserved, &c)
+			default:
+				reserved = append(reserved, &Card{Tier: card.Tier, Hidden: true})
+			}
+		}
+		p.Reserved = reserved
+	}
+
+	if game.Duel != nil {
+		for _, p := range game.Duel.Players {
+			mine := p.ID == viewer
+			seated = seated || mine
+
+			reserved := []*DuelCard{}
+			for _, card := range p.Reserved {
+				switch {
+				case !card.Hidden:
+					reserved = append(reserved, card)
+				case mine:
+					c := *card
+					c.Hidden = false
+					reserved = append(reserved, &c)
+				default:
+					reserved = append(reserved, &DuelCard{Tier: card.Tier, Hidden: true})
+				}
+			}
+			p.Reserved = reserved
+		}
+	}
+
+	if !seated {
+		game.DeleteVotes = nil
+	}
+
+	return game
+}
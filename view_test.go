@@ -0,0 +1,63 @@
+package splenda
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	state := testState()
+	state.Players[0].Reserved = []string{"2_5_2", "1_4_4"}
+	state.Players[0].Hidden = []string{"1_4_4"}
+
+	viewAs := func(viewer string) *Game {
+		t.Helper()
+		game, err := getGame("game", state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		game.DeleteVotes = []string{"user2"}
+		return view(game, viewer)
+	}
+
+	// The player who reserved the card blind sees it.
+	game := viewAs("user1")
+	reserved := game.Players[0].Reserved
+	if reserved[0].ID != "2_5_2" || reserved[1].ID != "1_4_4" || reserved[1].Hidden {
+		t.Errorf("expected user1 to see their own cards, got %+v %+v", reserved[0], reserved[1])
+	}
+
+	// Their opponent only sees its tier.
+	for _, viewer := range []string{"user2", "spectator"} {
+		game = viewAs(viewer)
+		reserved = game.Players[0].Reserved
+		if reserved[0].ID != "2_5_2" || !reflect.DeepEqual(reserved[1], &Card{Tier: 1, Hidden: true}) {
+			t.Errorf("%v: expected the blind reserve to be hidden, got %+v %+v", viewer, reserved[0], reserved[1])
+		}
+	}
+
+	// And spectators don't get a say in deleting the game.
+	if len(viewAs("user2").DeleteVotes) != 1 || len(viewAs("spectator").DeleteVotes) != 0 {
+		t.Error("expected only players to see delete votes")
+	}
+}
+
+func TestViewDuel(t *testing.T) {
+	state := testDuelState()
+	state.Players[1].Reserved = []string{"d1_red_0"}
+	state.Players[1].Hidden = []string{"d1_red_0"}
+
+	for viewer, visible := range map[string]bool{"user1": false, "user2": true, "spectator": false} {
+		game, err := getDuelGame("game", state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		card := view(game, viewer).Duel.Players[1].Reserved[0]
+		if visible && (card.ID != "d1_red_0" || card.Hidden) {
+			t.Errorf("%v: expected to see the card, got %+v", viewer, card)
+		}
+		if !visible && !reflect.DeepEqual(card, &DuelCard{Tier: 1, Hidden: true}) {
+			t.Errorf("%v: expected the card to be hidden, got %+v", viewer, card)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Splendor Duel games get their own set of components, since the table
+// looks nothing like the original game's. The app and update() are shared
+// with game.js, which is loaded after this.
+
+const duelColors = ['green', 'white', 'blue', 'black', 'red', 'pearl', 'wild']
+
+// The little marks shown on Splendor Duel cards and royals with abilities.
+const duelAbilities = {
+  'again': '↻',
+  'token': '+T',
+  'privilege': '+P',
+  'steal': '⇆',
+  'joker': '★',
+}
+
+function duelPost(move, body) {
+  return fetch('/api/games/'+gameid+'/duel/'+move, {
+    method: 'POST',
+    body: JSON.stringify(body || {}),
+  }).then(function(res) {
+    if (res.ok) {
+      update(app)
+    } else {
+      res.text().then(function(err) {
+        alert(err)
+      })
+    }
+  })
+}
+
+function duelLegal(type) {
+  return (app.moves || []).some(function(m) { return m.type === type })
+}
+
+const duelCard = {
+  props: {
+    'card': Object,
+    'selected': Boolean,
+  },
+  data: function() { return {
+    abilities: duelAbilities,
+  }},
+  computed: {
+    classes: function() {
+      var ret = {'card': true, 'buyable': this.selected}
+      if (!this.card) {
+        ret['hidden'] = true
+      } else if (this.card.hidden) {
+        ret['backcard'] = true
+      } else {
+        ret[(this.card.color || 'joker')+'card'] = true
+      }
+      return ret
+    },
+  },
+  methods: {
+    'select': function() {
+      if (this.card) {
+        this.$emit('select')
+      }
+    },
+  },
+  template: `
+    <div :class="classes" @click="select">
+      <div v-if="card && card.hidden" class="back">{{card.tier}}</div>
+      <div v-if="card && !card.hidden" class="top">
+        <div class="points">{{card.points}}</div>
+        <div v-if="card.crowns" title="crowns">♛{{card.crowns}}</div>
+        <div v-if="card.ability" class="ability" :title="card.ability">{{abilities[card.ability]}}</div>
+        <div class="gem" :class="card.color"></div>
+      </div>
+      <div v-if="card && !card.hidden" class="info">
+        <div v-for="(count, color) in card.cost" class="cost" :class="color">
+          {{count}}
+        </div>
+      </div>
+    </div>
+  `
+}
+
+const duelBoard = {
+  props: {
+    'board': Array,
+    'selected': Array,
+  },
+  methods: {
+    'select': function(cell) {
+      if (this.board[cell] !== '') {
+        this.$emit('select', cell)
+      }
+    },
+  },
+  template: `
+    <div class="duel-board">
+      <div v-for="row in [0, 1, 2, 3, 4]" class="flex-row">
+        <div v-for="col in [0, 1, 2, 3, 4]"
+          class="duel-cell"
+          :class="{'buyable': selected.indexOf(row*5+col) >= 0}"
+          @click="select(row*5+col)">
+          <div v-if="board[row*5+col]" class="coin" :class="board[row*5+col]"></div>
+        </div>
+      </div>
+    </div>
+  `
+}
+
+const duelPlayer = {
+  props: {
+    'player': Object,
+    'current': String,
+  },
+  components: {
+    'duelcard': duelCard,
+  },
+  data: function() { return {
+    colors: duelColors,
+  }},
+  methods: {
+    'count': function(color) {
+      return (this.player.cards[color] || []).length
+    },
+    'select': function(index) {
+      this.$emit('select', {'tier': 0, 'index': index})
+    },
+  },
+  template: `
+    <div class="player">
+      <div class="header">
+        <div class="id">{{player.id}}<span v-if="player.id === current"> *</span></div>
+        <div>{{player.points}} points, ♛{{player.crowns}}, {{player.privileges}} privileges</div>
+      </div>
+      <div v-if="player.resigned">resigned</div>
+      <div class="flex-row-evenly">
+        <div v-for="color in colors" class="coin" :class="color">
+          <div class="num">{{player.coins[color] || 0}}</div>
+        </div>
+      </div>
+      <div class="flex-row-evenly">
+        <div v-for="color in colors.slice(0, 5)" class="pcard" :class="color" :title="(player.colorpoints || {})[color] + ' points'">
+          <div class="num">{{count(color)}}</div>
+        </div>
+      </div>
+      <div class="flex-row">
+        <duelcard v-for="(card, index) in player.reserved" :card="card" :key="index" @select="select(index)"></duelcard>
+      </div>
+      <div v-for="r in player.royals">{{r.id}}</div>
+    </div>
+  `
+}
+
+Vue.component('duel', {
+  props: {
+    'game': Object,
+  },
+  data: function() { return {
+    cells: [],
+    card: null,
+    color: '',
+    returns: {},
+    abilities: duelAbilities,
+  }},
+  components: {
+    'duelcard': duelCard,
+    'duelboard': duelBoard,
+    'duelplayer': duelPlayer,
+  },
+  computed: {
+    'duel': function() {
+      return this.game.duel
+    },
+    'mine': function() {
+      return this.game.current === seat() && this.game.state !== 'gameover'
+    },
+    'me': function() {
+      return (this.duel.players || []).find(function(p) { return p.id === seat() })
+    },
+  },
+  methods: {
+    'legal': function(type) {
+      return this.mine && duelLegal(type)
+    },
+    'selectCell': function(cell) {
+      const i = this.cells.indexOf(cell)
+      if (i >= 0) {
+        this.cells.splice(i, 1)
+      } else {
+        this.cells.push(cell)
+      }
+    },
+    'selectCard': function(tier, index, deck) {
+      this.card = {'tier': tier, 'index': index, 'deck': !!deck}
+    },
+    'isSelected': function(tier, index) {
+      return !!this.card && this.card.tier === tier && this.card.index === index && !this.card.deck
+    },
+    'clear': function() {
+      this.cells = []
+      this.card = null
+      this.color = ''
+      this.returns = {}
+    },
+    'send': function(move, body) {
+      const self = this
+      duelPost(move, body).then(function() {
+        self.clear()
+      })
+    },
+    'take': function() {
+      this.send('take', {'cells': this.cells})
+    },
+    'privilege': function() {
+      this.send('privilege', {'cells': this.cells})
+    },
+    'taketoken': function() {
+      this.send('taketoken', {'cells': this.cells})
+    },
+    'reserve': function() {
+      this.send('reserve', Object.assign({'cells': this.cells}, this.card))
+    },
+    'buy': function() {
+      this.send('buy', {'tier': this.card.tier, 'index': this.card.index, 'color': this.color})
+    },
+    'steal': function() {
+      this.send('steal', {'color': this.color})
+    },
+    'pickroyal': function(id) {
+      if (this.legal('pickroyal')) {
+        this.send('pickroyal', {'royal': id})
+      }
+    },
+    'returnCoin': function(color) {
+      this.$set(this.returns, color, (this.returns[color] || 0) + 1)
+    },
+    'returncoins': function() {
+      this.send('returncoins', {'coins': this.returns})
+    },
+    'refill': function() {
+      this.send('refill')
+    },
+    'resign': function() {
+      if (confirm('Resign?')) {
+        this.send('resign')
+      }
+    },
+  },
+  template: `
+    <div class="flex-row full-height">
+      <div class="left-pane">
+        <div v-if="game.state === 'gameover'">
+          {{game.winner}} wins ({{duel.victory}})
+        </div>
+        <div v-if="duel.again && mine">another turn</div>
+        <div v-if="mine" class="flex-column">
+          <input v-if="legal('take')" type="button" class="button" value="take" @click="take">
+          <input v-if="legal('privilege')" type="button" class="button" value="use privileges" @click="privilege">
+          <input v-if="legal('refill')" type="button" class="button" value="refill" @click="refill">
+          <input v-if="legal('reserve') && card" type="button" class="button" value="reserve" @click="reserve">
+          <input v-if="legal('buy') && card && !card.deck" type="button" class="button" value="buy" @click="buy">
+          <input v-if="legal('taketoken')" type="button" class="button" value="take token" @click="taketoken">
+          <select v-if="legal('buy') || legal('steal')" v-model="color">
+            <option value="">color</option>
+            <option v-for="c in ['green', 'white', 'blue', 'black', 'red', 'pearl']" :value="c">{{c}}</option>
+          </select>
+          <input v-if="legal('steal')" type="button" class="button" value="steal" @click="steal">
+          <div v-if="legal('returncoins')">
+            <div>return:</div>
+            <div class="flex-row-evenly">
+              <div v-for="(n, c) in me.coins" v-if="n > 0" class="coin" :class="c" @click="returnCoin(c)">
+                <div class="num">{{returns[c] || 0}}</div>
+              </div>
+            </div>
+            <input type="button" class="button" value="return" @click="returncoins">
+          </div>
+          <input type="button" class="button" value="clear" @click="clear">
+        </div>
+        <input v-if="me && !me.resigned && game.state !== 'gameover'" type="button" class="button" value="resign" @click="resign">
+      </div>
+      <div class="center-pane">
+        <div class="flex-row-evenly">
+          <div v-for="r in duel.royals" class="noble" :class="{'buyable': legal('pickroyal')}" @click="pickroyal(r.id)">
+            <div class="points">{{r.points}}</div>
+            <div v-if="r.ability" :title="r.ability">{{abilities[r.ability]}}</div>
+          </div>
+        </div>
+        <div v-for="tier in [3, 2, 1]" class="flex-row-evenly" :key="tier">
+          <duelcard :card="{'hidden': true, 'tier': tier}" :selected="!!card && card.deck && card.tier === tier" @select="selectCard(tier, 0, true)"></duelcard>
+          <duelcard v-for="(c, index) in duel.cards[tier-1]" :card="c" :key="index" :selected="isSelected(tier, index)" @select="selectCard(tier, index)"></duelcard>
+        </div>
+        <duelboard :board="duel.board" :selected="cells" @select="selectCell($event)"></duelboard>
+        <div>{{duel.bag}} in the bag, {{duel.privileges}} privileges on the table</div>
+      </div>
+      <div class="right-pane">
+        <duelplayer v-for="player in duel.players" :player="player" :current="game.current" :key="player.id" @select="selectCard($event.tier, $event.index)"></duelplayer>
+      </div>
+    </div>
+  `
+})
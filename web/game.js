@@ -40,48 +40,67 @@ const pcards = {
   `
 }
 
+// The little marks shown on Orient cards with abilities.
+const abilities = {
+  'double': '×2',
+  'joker': '★',
+  'reserve': '+R',
+  'noble': '+N',
+}
+
 const card = {
   props: {
     'card': Object,
     'tier': Number,
     'index': Number,
+    'orient': Boolean,
     'offlimits': Boolean,
   },
   computed: {
     buyable: function() {
-      if (userid !== app.game.current) {
+      if (seat() !== app.game.current) {
         return false
       }
       if (this.offlimits) {
         return false
       }
-      // TODO: Calculate if we can afford it?
-      return true
+      const move = {'tier': this.tier, 'index': this.index, 'orient': this.orient}
+      return islegal('buy', move) || islegal('reserve', move)
     },
     classes: function() {
       var ret = {'card': true}
-      ret[this.card.color+'card'] = true
+      if (this.card.hidden) {
+        ret['backcard'] = true
+      } else {
+        ret[(this.card.color || 'joker')+'card'] = true
+      }
       ret['buyable'] = this.buyable
       return ret
     },
+    ability: function() {
+      return abilities[this.card.ability]
+    },
   },
   methods: {
     'select': function() {
       if (this.buyable) {
         this.$emit('select', {
           'tier': this.tier,
-          'index': this.index
+          'index': this.index,
+          'orient': this.orient,
         })
       }
     }
   },
   template: `
     <div :class="classes" @click="select">
-      <div class="top">
+      <div v-if="card.hidden" class="back">{{card.tier}}</div>
+      <div v-if="!card.hidden" class="top">
         <div class="points">{{card.points}}</div>
+        <div v-if="ability" class="ability" :title="card.ability">{{ability}}</div>
         <div class="gem" :class="card.color"></div>
       </div>
-      <div class="info">
+      <div v-if="!card.hidden" class="info">
         <div v-for="(count, color) in card.cost" class="cost" :class="color">
           {{count}}
         </div>
@@ -90,14 +109,46 @@ const card = {
   `
 }
 
+const deck = {
+  props: {
+    'tier': Number,
+    'count': Number,
+    'orient': Boolean,
+  },
+  computed: {
+    reservable: function() {
+      return seat() === app.game.current && this.count > 0
+    },
+  },
+  methods: {
+    'select': function() {
+      if (this.reservable) {
+        this.$emit('select', {
+          'tier': this.tier,
+          'deck': true,
+          'orient': this.orient,
+        })
+      }
+    }
+  },
+  template: `
+    <div class="card backcard" :class="{'buyable': reservable}" @click="select">
+      <div class="back">{{count}}</div>
+    </div>
+  `
+}
+
 const cards = {
   props: {
     'cards': Array,
     'tier': Number,
+    'deck': Number,
+    'orient': Boolean,
     'offlimits': Boolean,
   },
   components: {
     'card': card,
+    'deck': deck,
   },
   methods: {
     'select': function(card) {
@@ -106,12 +157,19 @@ const cards = {
   },
   template: `
     <div class="flex-row-evenly">
+      <deck v-if="deck !== undefined"
+        :tier="tier"
+        :count="deck"
+        :orient="orient"
+        @select="select($event)">
+      </deck>
       <card v-for="(card, index) in cards"
         :card="card"
         :tier="tier"
         :index="index"
+        :orient="orient"
         :offlimits="offlimits"
-        :key="card.id"
+        :key="card.id || index"
         @select="select($event)">
       </card>
     </div>
@@ -128,6 +186,15 @@ const player = {
     'cards': pcards,
     'reserved': cards,
   },
+  computed: {
+    'timeleft': function() {
+      return (app.game.timeleft || {})[this.player.id]
+    },
+    'clock': function() {
+      const secs = this.timeleft % 60
+      return Math.floor(this.timeleft / 60) + ':' + (secs < 10 ? '0' : '') + secs
+    },
+  },
   methods: {
     'select': function(card) {
       this.$emit('select', card)
@@ -136,9 +203,11 @@ const player = {
   template: `
     <div class="player">
       <div class="header">
-        <div class="id">{{player.id}} <span v-show="player.id === current"> 👈</span></div>
+        <div class="id">{{player.id}} <span v-show="player.id === current"> 👈</span><span v-show="player.resigned"> (resigned)</span><span v-if="player.city"> 🏰 {{player.city.id}}</span></div>
+        <div class="clock" v-if="timeleft !== undefined">{{clock}}</div>
         <div class="points">points: {{player.points}}</div>
       </div>
+      <div class="posts" v-for="post in player.posts" :key="post.id">⚓ {{post.description}}</div>
       <coins :coins="player.coins"></coins>
       <cards :cards="player.cards"></cards>
       <reserved
@@ -155,8 +224,21 @@ const noble = {
   props: {
     'noble': Object,
   },
+  computed: {
+    pickable: function() {
+      const state = app.game.state
+      return seat() === app.game.current && (state === 'picknoble' || state === 'claimnoble')
+    },
+  },
+  methods: {
+    'select': function() {
+      if (this.pickable) {
+        this.$emit('pick', this.noble.id)
+      }
+    }
+  },
   template: `
-    <div class="noble">
+    <div class="noble" :class="{'buyable': pickable}" @click="select">
       <div class="info">
         <div class="points">{{noble.points}}</div>
         <div style="flex-grow: 1;"></div>
@@ -168,6 +250,38 @@ const noble = {
   `
 }
 
+const city = {
+  props: {
+    'city': Object,
+  },
+  template: `
+    <div class="noble city">
+      <div class="info">
+        <div class="points">{{city.points}}</div>
+        <div style="flex-grow: 1;"></div>
+        <div v-for="(count, color) in city.cost" class="cost" :class="color">
+          {{count}}
+        </div>
+      </div>
+      <div class="name">{{city.id}}</div>
+    </div>
+  `
+}
+
+const cities = {
+  props: {
+    'cities': Array,
+  },
+  components: {
+    'city': city,
+  },
+  template: `
+    <div class="flex-row-evenly">
+      <city v-for="city in cities" :city="city" :key="city.id"></city>
+    </div>
+  `
+}
+
 const nobles = {
   props: {
     'nobles': Array,
@@ -175,16 +289,62 @@ const nobles = {
   components: {
     'noble': noble,
   },
+  methods: {
+    'pick': function(id) {
+      fetch('/api/games/'+gameid+'/picknoble', {
+        method: 'POST',
+        body: JSON.stringify({'noble': id}),
+      }).then(function(res) {
+        if (res.ok) {
+          update(app)
+        } else {
+          res.text().then(function(body) {
+            alert(body)
+          })
+        }
+      })
+    },
+  },
   template: `
     <div class="flex-row-evenly">
       <noble v-for="noble in nobles"
         :noble="noble"
-        :key="noble.id">
+        :key="noble.id"
+        @pick="pick($event)">
       </noble>
     </div>
   `
 }
 
+// Islegal checks whether a move is in the list of legal moves the server
+// gave us for this turn.
+function islegal(type, want) {
+  const same = function(a, b) {
+    return (a || []).slice().sort().join() === (b || []).slice().sort().join()
+  }
+  return app.moves.some(function(m) {
+    if (m.type !== type) {
+      return false
+    }
+    if (want.colors !== undefined && !same(m.colors, want.colors)) {
+      return false
+    }
+    if (!!m.deck !== !!want.deck) {
+      return false
+    }
+    if (!!m.orient !== !!want.orient) {
+      return false
+    }
+    if (want.tier !== undefined && (m.tier || 0) !== want.tier) {
+      return false
+    }
+    if (!want.deck && want.index !== undefined && (m.index || 0) !== want.index) {
+      return false
+    }
+    return true
+  })
+}
+
 function count(els) {
   var count = 0
   for (var el of els) {
@@ -213,7 +373,11 @@ const takemenu = {
   }},
   methods: {
     'validate': function() {
-      this.takeable = (this.colors.length > 0)
+      // Taking two coins only ever has one real color; any second one is the
+      // extra coin from a trading post.
+      const type = (this.num === 3) ? 'take3' : 'take2'
+      const colors = (type === 'take2') ? this.colors.slice(0, 1) : this.colors
+      this.takeable = (this.colors.length > 0) && islegal(type, {'colors': colors})
       const enough = (this.colors.length === this.num)
       for (var color in this.disabled) {
         this.disabled[color] = (enough && !this.colors.includes(color))
@@ -281,26 +445,64 @@ const buymenu = {
     'card': function() {
       const tier = this.selection.tier
       const index = this.selection.index
+      if (this.selection.deck) {
+        if (this.label !== 'reserve') {
+          // You can't buy a card you haven't seen.
+          return null
+        }
+        return {'tier': tier, 'hidden': true}
+      }
       if (tier !== undefined && index !== undefined) {
         if (tier === 0) {
           if (this.label === 'reserve') {
             // HACK HACK HACK: you're trying to reserve a reserved card.
             return null
           }
-          return findplayer(userid, this.game.players).reserved[index]
+          return findplayer(seat(), this.game.players).reserved[index]
+        }
+        if (this.selection.orient) {
+          return this.game.table.orient[tier-1][index]
         }
         return this.game.table.cards[tier-1][index]
       }
       return null
     }
   },
+  data: function() { return {
+    'colors': ['green', 'white', 'blue', 'black', 'red', 'wild'],
+    'payment': {},
+    'joker': '',
+  }},
   methods: {
+    'change': function(color, delta) {
+      const count = (this.payment[color] || 0) + delta
+      if (count < 0) {
+        return
+      }
+      this.$set(this.payment, color, count)
+    },
     'buy': function() {
-      this.$emit('buy', this.selection)
+      // Only send an explicit payment if the player chose one; otherwise let
+      // the server work out the cheapest way to pay.
+      const move = Object.assign({}, this.selection)
+      for (var color in this.payment) {
+        if (this.payment[color] > 0) {
+          move.payment = this.payment
+        }
+      }
+      if (this.joker !== '') {
+        move.color = this.joker
+      }
+      this.$emit('buy', move)
+      this.payment = {}
+      this.joker = ''
     },
     'cancel': function() {
       this.$emit('cancel')
-    }
+      this.payment = {}
+      this.joker = ''
+    },
+    'islegal': islegal,
   },
   components: {
     'card': card,
@@ -312,13 +514,83 @@ const buymenu = {
       <div style="display: flex; flex-direction: column; align-items: center;">
         <card v-if="card" :card="card" :offlimits="true"></card>
       </div>
+      <div v-if="label === 'buy' && card && card.ability === 'joker'" style="text-align: center;">
+        <div style="height: 1em;"></div>
+        copy
+        <select v-model="joker">
+          <option v-for="color in colors.slice(0, 5)" :value="color">{{color}}</option>
+        </select>
+      </div>
+      <div v-if="label === 'buy' && card">
+        <div style="height: 1em;"></div>
+        <div style="text-align: center;">pay with (optional)</div>
+        <div v-for="color in colors" class="flex-row-between">
+          <div class="coin" :class="color"><div class="num">{{payment[color] || 0}}</div></div>
+          <input type="button" class="button" value="-" @click="change(color, -1)">
+          <input type="button" class="button" value="+" @click="change(color, 1)">
+        </div>
+      </div>
       <div style="height: 1em;"></div>
-      <input type="button" class="button" :value="label" @click="buy" :disabled="card===null">
+      <input type="button" class="button" :value="label" @click="buy" :disabled="card===null || !islegal(label, selection)">
       <input type="button" class="button" value="cancel" @click="cancel">
     </div>
   `
 }
 
+const returnmenu = {
+  props: {
+    'player': Object,
+  },
+  data: function() { return {
+    'colors': ['green', 'white', 'blue', 'black', 'red', 'wild'],
+    'coins': {},
+  }},
+  computed: {
+    'excess': function() {
+      var total = 0
+      for (var color in this.player.coins) {
+        total += this.player.coins[color]
+      }
+      for (var color in this.coins) {
+        total -= this.coins[color]
+      }
+      return total - 10
+    },
+  },
+  methods: {
+    'change': function(color, delta) {
+      const count = (this.coins[color] || 0) + delta
+      if (count < 0 || count > (this.player.coins[color] || 0)) {
+        return
+      }
+      this.$set(this.coins, color, count)
+    },
+    'give': function() {
+      const coins = {}
+      for (var color in this.coins) {
+        if (this.coins[color] > 0) {
+          coins[color] = this.coins[color]
+        }
+      }
+      this.$emit('give', coins)
+      this.coins = {}
+    },
+  },
+  template: `
+    <div>
+      <div style="font-weight: bold; text-align: center;">return coins</div>
+      <div style="height: 1em;"></div>
+      <div v-for="color in colors" class="flex-row-between">
+        <div class="coin" :class="color"><div class="num">{{coins[color] || 0}}</div></div>
+        <input type="button" class="button" value="-" @click="change(color, -1)">
+        <input type="button" class="button" value="+" @click="change(color, 1)">
+      </div>
+      <div style="height: 1em;"></div>
+      <input type="button" class="button" value="return" @click="give" :disabled="excess !== 0">
+    </div>
+  `
+}
+
 const leftPane = {
   props: {
     'game': Object,
@@ -336,6 +608,37 @@ const leftPane = {
       }
     }
   },
+  computed: {
+    'losecoin': function() {
+      return this.game.state === 'losecoin' && this.game.current === seat()
+    },
+    'freereserve': function() {
+      return this.game.state === 'reservecard' && this.game.current === seat()
+    },
+    'claimnoble': function() {
+      return this.game.state === 'claimnoble' && this.game.current === seat()
+    },
+    'me': function() {
+      return findplayer(seat(), this.game.players || [])
+    },
+    'passable': function() {
+      return islegal('pass', {})
+    },
+    'extracoin': function() {
+      return !!this.me && (this.me.posts || []).some(function(p) { return p.id === 'extracoin' })
+    },
+    'resignable': function() {
+      return this.me && !this.me.resigned && this.game.state !== 'gameover'
+    },
+    'undoable': function() {
+      const u = this.game.undo
+      return u && u.player === userid && !u.requested
+    },
+    'undoasked': function() {
+      const u = this.game.undo
+      return u && u.responder === userid && u.requested
+    },
+  },
   methods: {
     'finish': function() {
       this.menu = ''
@@ -360,7 +663,7 @@ const leftPane = {
     'take2': function(colors) {
       fetch('/api/games/'+gameid+'/take2', {
         method: 'POST',
-        body: JSON.stringify({'color': colors[0]})
+        body: JSON.stringify({'color': colors[0], 'extra': colors[1]})
       }).then(this.handle)
     },
     'reserve': function(card) {
@@ -375,10 +678,35 @@ const leftPane = {
         body: JSON.stringify(card),
       }).then(this.handle)
     },
+    'pass': function() {
+      fetch('/api/games/'+gameid+'/pass', {
+        method: 'POST',
+      }).then(this.handle)
+    },
+    'resign': function() {
+      if (!confirm('Really resign from this game?')) {
+        return
+      }
+      fetch('/api/games/'+gameid+'/resign', {
+        method: 'POST',
+      }).then(this.handle)
+    },
+    'undo': function(step) {
+      fetch('/api/games/'+gameid+'/undo'+step, {
+        method: 'POST',
+      }).then(this.handle)
+    },
+    'returncoins': function(coins) {
+      fetch('/api/games/'+gameid+'/returncoins', {
+        method: 'POST',
+        body: JSON.stringify({'coins': coins}),
+      }).then(this.handle)
+    },
   },
   components: {
     'takemenu': takemenu,
     'buymenu': buymenu,
+    'returnmenu': returnmenu,
   },
   template: `
     <div class="left-pane">
@@ -388,14 +716,48 @@ const leftPane = {
         <input type="button" class="button" value="take 2 coins" @click="menu = 'take2'">
         <input type="button" class="button" value="reserve card" @click="menu = 'reserve'">
         <input type="button" class="button" value="buy card" @click="menu = 'buy'">
+        <input type="button" class="button" value="pass" @click="pass" v-if="passable">
+        <input type="button" class="button" value="take back move" @click="undo('')" v-if="undoable">
+        <input type="button" class="button" value="resign" @click="resign" v-if="resignable">
+      </div>
+
+      <div v-if="undoasked">
+        <div style="height: 1em;"></div>
+        <div style="text-align: center;">{{game.undo.player}} wants to take back their move</div>
+        <div class="flex-row">
+          <input type="button" class="button" value="accept" @click="undo('/accept')">
+          <input type="button" class="button" value="decline" @click="undo('/decline')">
+        </div>
       </div>
 
       <div style="height: 1em;"></div>
 
       <takemenu v-show="menu==='take3'" title="take 3 coins" :num="3" @take="take3($event)" @cancel="menu = ''"></takemenu>
-      <takemenu v-show="menu==='take2'" title="take 2 coins" :num="1" @take="take2($event)" @cancel="menu = ''"></takemenu>
+      <takemenu v-show="menu==='take2'" title="take 2 coins" :num="extracoin ? 2 : 1" @take="take2($event)" @cancel="menu = ''"></takemenu>
       <buymenu v-show="menu==='reserve'" title="reserve card" label="reserve" :game="game" :selection="selection" @buy="reserve($event)" @cancel="menu = ''"></buymenu>
       <buymenu v-show="menu==='buy'" title="buy card" label="buy" :game="game" :selection="selection" @buy="buy($event)" @cancel="menu = ''"></buymenu>
+      <returnmenu v-if="losecoin && me" :player="me" @give="returncoins($event)"></returnmenu>
+
+      <div v-if="freereserve" style="text-align: center;">
+        reserve a card for free, or pass
+      </div>
+      <div v-if="claimnoble" style="text-align: center;">
+        pick any noble
+      </div>
+
+      <div v-if="game.options && game.state !== 'gameover'" style="text-align: center;">
+        playing to {{game.options.points}} points
+      </div>
+
+      <div v-if="game.state === 'gameover'">
+        <div style="font-weight: bold; text-align: center;">
+          {{game.winner ? game.winner + ' wins!' : 'shared victory!'}}
+        </div>
+        <div style="height: 1em;"></div>
+        <div v-for="s in game.standings">
+          {{s.rank}}. {{s.id}}: {{s.points}} ({{s.cards}} cards){{s.resigned ? ' (resigned)' : ''}}
+        </div>
+      </div>
     </div>
   `
 }
@@ -404,8 +766,16 @@ const centerPane = {
   props: {
     'table': Object,
   },
+  computed: {
+    // Rows with a fifth card, or a side row of Orient cards, need shrinking
+    // to fit.
+    'wide': function() {
+      return this.table.cards[0].length > 4 || !!this.table.orient
+    },
+  },
   components: {
     'nobles': nobles,
+    'cities': cities,
     'cards': cards,
     'coins': coins,
   },
@@ -417,11 +787,13 @@ const centerPane = {
   template: `
     <div class="center-pane">
       <div style="height: 1em;"></div>
-      <nobles :nobles="table.nobles"></nobles>
-      <div>
-        <cards :cards="table.cards[2]" :tier="3" :offlimits="false" @select="select($event)"></cards>
-        <cards :cards="table.cards[1]" :tier="2" :offlimits="false" @select="select($event)"></cards>
-        <cards :cards="table.cards[0]" :tier="1" :offlimits="false" @select="select($event)"></cards>
+      <cities v-if="table.cities" :cities="table.cities"></cities>
+      <nobles v-else :nobles="table.nobles"></nobles>
+      <div :class="{'wide': wide}">
+        <div v-for="tier in [3, 2, 1]" class="flex-row-evenly" :key="tier">
+          <cards :cards="table.cards[tier-1]" :tier="tier" :deck="table.decks[tier-1]" :offlimits="false" @select="select($event)"></cards>
+          <cards v-if="table.orient" class="orient" :cards="table.orient[tier-1]" :tier="tier" :deck="table.orientdecks[tier-1]" :orient="true" :offlimits="false" @select="select($event)"></cards>
+        </div>
       </div>
       <coins :coins="table.coins"></coins>
     </div>
@@ -483,16 +855,46 @@ Vue.component('game', {
   `
 })
 
+// Who the user is playing as; in a sandbox they move for every seat.
+function seat() {
+  return app.game.sandbox ? app.game.current : userid
+}
+
+function updateMoves(app) {
+  const path = app.game.type === 'duel' ? '/duel/moves' : '/moves'
+  fetch('/api/games/'+gameid+path).then(function(res) {
+    if (res.ok) {
+      res.json().then(function(json) {
+        app.moves = json.moves
+      })
+    }
+  })
+}
+
+// Watch for new moves, including undo requests, and fetch the game again
+// whenever there's a version we haven't seen. The ts alone isn't enough, since
+// it repeats after an undo. The server sends the current version as soon as
+// we connect, and the browser reconnects on its own if it drops.
+function watch(app) {
+  const events = new EventSource('/api/games/'+gameid+'/events')
+  events.onmessage = function(e) {
+    const version = JSON.parse(e.data).version
+    if (version !== app.game.version) {
+      update(app)
+    }
+  }
+}
+
 function update(app) {
   fetch('/api/games/'+gameid).then(function(res) {
     if (res.ok) {
       res.json().then(function(json) {
         app.game = json
 
-        if (json.current != userid) {
-          setTimeout(function() {
-            update(app)
-          }, 1000)
+        if (json.current == seat()) {
+          updateMoves(app)
+        } else {
+          app.moves = []
         }
       })
     } else {
@@ -510,11 +912,13 @@ const app = new Vue({
       'table': {
         'nobles': [],
         'cards': [],
+        'decks': [],
         'coins': {},
       },
     },
+    'moves': [],
   },
   created: function() {
-    update(this)
+    watch(this)
   },
 })
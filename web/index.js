@@ -21,6 +21,8 @@ const game = {
       </td>
       <td>
         {{game.players.join(', ')}}
+        <span v-if="game.type === 'duel'">(duel)</span>
+        <span v-if="game.sandbox">(sandbox)</span>
       </td>
       <td></td>
     </tr>
@@ -33,15 +35,53 @@ const newmenu = {
   },
   data: function() { return {
     selected: [],
+    timemode: '',
+    minutes: 5,
+    timeout: 'pass',
+    options: {
+      'points': '',
+      'coins': '',
+      'gold': '',
+      'nobles': '',
+      'cardspertier': '',
+      'reserveslots': '',
+    },
+    fixedseats: false,
+    cardset: '',
+    mode: '',
+    type: '',
   }},
   methods: {
     hide: function() {
       this.$emit('hide')
     },
     newGame: function() {
+      if (this.type === 'duel') {
+        this.newDuel()
+        return
+      }
+      const game = {'players': this.selected, 'options': {'fixedseats': this.fixedseats, 'cardset': this.cardset, 'mode': this.mode}}
+      for (var opt in this.options) {
+        if (this.options[opt] !== '') {
+          game.options[opt] = this.options[opt]
+        }
+      }
+      if (this.timemode !== '') {
+        game.timecontrol = {
+          'mode': this.timemode,
+          'seconds': Math.round(this.minutes * 60),
+          'timeout': this.timeout,
+        }
+      }
+      this.create(game)
+    },
+    newDuel: function() {
+      this.create({'type': 'duel', 'players': this.selected})
+    },
+    create: function(game) {
       fetch('/api/games', {
         method: 'POST',
-        body: JSON.stringify({'players': this.selected})
+        body: JSON.stringify(game)
       }).then(function(res) {
         if (res.ok) {
           res.json().then(function(json) {
@@ -68,6 +108,51 @@ const newmenu = {
           <label :for="user">{{user}}</label>
         </div>
       </div>
+      <div style="margin-top: 1em; margin-left: 2em;">
+        <select v-model="type">
+          <option value="">Splendor</option>
+          <option value="duel">Splendor Duel (two players)</option>
+        </select>
+      </div>
+      <div v-if="type === ''" style="margin-top: 1em; margin-left: 2em;">
+        <div style="font-weight: bold;">House Rules</div>
+        <div v-for="(label, opt) in {points: 'points to win', coins: 'coins per color', gold: 'gold coins', nobles: 'nobles', cardspertier: 'cards per tier', reserveslots: 'reserve slots'}">
+          <input type="number" min="1" v-model.number="options[opt]" placeholder="default" style="width: 5em;">
+          {{label}}
+        </div>
+        <div>
+          <select v-model="mode">
+            <option value="">nobles</option>
+            <option value="cities">cities</option>
+            <option value="posts">trading posts</option>
+            <option value="orient">orient</option>
+          </select>
+        </div>
+        <div>
+          <input type="text" v-model="cardset" placeholder="standard" style="width: 5em;">
+          card set
+        </div>
+        <div>
+          <input type="checkbox" id="fixedseats" v-model="fixedseats">
+          <label for="fixedseats">seat players in the order picked</label>
+        </div>
+      </div>
+      <div v-if="type === ''" style="margin-top: 1em; margin-left: 2em;">
+        <select v-model="timemode">
+          <option value="">no time limit</option>
+          <option value="move">minutes per move</option>
+          <option value="total">minutes per player</option>
+        </select>
+        <span v-if="timemode !== ''">
+          <input type="number" min="1" v-model.number="minutes" style="width: 4em;">
+          then
+          <select v-model="timeout">
+            <option value="pass">pass</option>
+            <option value="resign">resign</option>
+            <option value="bot">let a bot move</option>
+          </select>
+        </span>
+      </div>
       <div style="margin-top: 1em; text-align: center;">
         <input type="button" class="button" value="begin" @click="newGame">
       </div>
@@ -88,6 +173,9 @@ const deletemenu = {
       fetch('/api/games/'+this.id, {
         method: 'DELETE',
       }).then(function(res) {
+        if (res.status === 202) {
+          alert('The game will be deleted once every player has voted to delete it.')
+        }
         if (res.ok) {
           menu.hide()
           update(app)